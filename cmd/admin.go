@@ -0,0 +1,240 @@
+package main
+
+import (
+	"OZON/internal/admin"
+	"OZON/internal/config"
+	"OZON/internal/repository/backend"
+	"OZON/internal/repository/cache"
+	"OZON/internal/usecases"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const postsUsage = `usage: server posts [flags] list [PAGE [LIMIT]] | show ID | close-comments ID | open-comments ID
+
+  list            list the posts in feed order, 20 per page by default
+  show            print a post
+  close-comments  stop accepting comments on a post; existing ones stay
+  open-comments   accept comments on a post again
+
+"post" is the same command.`
+
+const commentsUsage = `usage: server comments [flags] tree POST_ID | delete ID
+
+  tree    print every comment of a post as a tree
+  delete  delete a comment; its replies stay in the thread
+
+"comment" is the same command.`
+
+// defaultListLimit is the page size of posts list.
+const defaultListLimit = 20
+
+// openStorage opens the configured storage for a maintenance command. An
+// in-memory storage needs a directory, see checkPersistent. With a Redis cache
+// the writes also invalidate the entries the servers read; an LRU cache
+// belongs to each server process and expires on its own.
+func openStorage(cfg *config.Config) (*backend.Storage, func(), error) {
+	if err := checkPersistent(cfg); err != nil {
+		return nil, nil, err
+	}
+	storage, err := cfg.OpenStorage()
+	if err != nil {
+		return nil, nil, err
+	}
+	closeAll := func() { storage.Close() }
+	if cfg.Cache.Type == "redis" {
+		c, err := cache.NewRedis(cfg.Cache.RedisURL)
+		if err != nil {
+			storage.Close()
+			return nil, nil, fmt.Errorf("failed to set up the cache: %w", err)
+		}
+		cache.Decorate(storage, c, cfg.Cache.TTL)
+		closeAll = func() {
+			c.Close()
+			storage.Close()
+		}
+	}
+	return storage, closeAll, nil
+}
+
+// parseArgs parses the flags of fs, which may come before or after the single
+// positional argument, and returns that argument.
+func parseArgs(fs *flag.FlagSet, args []string, name string) (string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 {
+		return "", fmt.Errorf("expected exactly one %s", name)
+	}
+	return positional[0], nil
+}
+
+// checkPersistent rejects an in-memory storage without a directory, whose
+// data would only live as long as the command.
+func checkPersistent(cfg *config.Config) error {
+	if cfg.Storage.Type == "inmemory" && cfg.Storage.InMemory.Dir == "" {
+		return errors.New("--storage inmemory needs --inmemory-dir, the data is lost otherwise")
+	}
+	return nil
+}
+
+// runPosts implements the posts subcommand.
+func runPosts(cfg *config.Config, args []string, out io.Writer) error {
+	var page, limit int32 = 1, defaultListLimit
+	switch {
+	case len(args) >= 1 && len(args) <= 3 && args[0] == "list":
+		for i, p := range []*int32{&page, &limit} {
+			if len(args) > i+1 {
+				n, err := strconv.ParseInt(args[i+1], 10, 32)
+				if err != nil || n <= 0 {
+					return fmt.Errorf("invalid number %q\n%s", args[i+1], postsUsage)
+				}
+				*p = int32(n)
+			}
+		}
+	case len(args) == 2 && (args[0] == "show" || args[0] == "close-comments" || args[0] == "open-comments"):
+	default:
+		return fmt.Errorf("unknown posts command %q\n%s", strings.Join(args, " "), postsUsage)
+	}
+
+	storage, closeStorage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+	uc := usecases.NewPostUsecase(storage.PostRepository, storage.CommentRepository)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "list":
+		posts, err := storage.PostRepository.GetPosts(ctx, page, limit)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED AT\tCOMMENTS\tOPEN\tTEXT")
+		for _, post := range posts {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", post.ID, formatTime(post.CreatedAt), post.CommentCount,
+				yesNo(post.AllowComments), admin.Excerpt(post.Text, 50))
+		}
+		return w.Flush()
+	case "show":
+		post, err := uc.GetPost(ctx, args[1], 1, 1)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID:\t%s\n", post.ID)
+		fmt.Fprintf(w, "Created at:\t%s\n", formatTime(post.CreatedAt))
+		fmt.Fprintf(w, "Updated at:\t%s\n", formatTime(post.UpdatedAt))
+		fmt.Fprintf(w, "Comments:\t%d\n", post.CommentCount)
+		fmt.Fprintf(w, "Open for comments:\t%s\n", yesNo(post.AllowComments))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "\n%s\n", post.Text)
+		return err
+	default:
+		allowed := args[0] == "open-comments"
+		if err := uc.SetCommentsAllowed(ctx, args[1], allowed); err != nil {
+			return err
+		}
+		if allowed {
+			fmt.Fprintf(out, "post %s is open for comments\n", args[1])
+		} else {
+			fmt.Fprintf(out, "post %s is closed for comments\n", args[1])
+		}
+		return nil
+	}
+}
+
+// runComments implements the comments subcommand.
+func runComments(cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) != 2 || (args[0] != "tree" && args[0] != "delete") {
+		return fmt.Errorf("unknown comments command %q\n%s", strings.Join(args, " "), commentsUsage)
+	}
+
+	storage, closeStorage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+	ctx := context.Background()
+
+	if args[0] == "delete" {
+		uc := usecases.NewCommentUsecase(storage.PostRepository, storage.CommentRepository, cfg.Limits.MaxCommentDepth)
+		if err := uc.DeleteComment(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "comment %s deleted\n", args[1])
+		return nil
+	}
+
+	post, err := usecases.NewPostUsecase(storage.PostRepository, storage.CommentRepository).GetPost(ctx, args[1], 1, 1)
+	if err != nil {
+		return err
+	}
+	comments, err := admin.Comments(ctx, storage.CommentRepository, post.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s %s\n", post.ID, admin.Excerpt(post.Text, 60))
+	return admin.WriteTree(out, comments)
+}
+
+// runStats implements the stats subcommand.
+func runStats(cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments %q\nusage: server stats [flags]", strings.Join(args, " "))
+	}
+
+	storage, closeStorage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	stats, err := admin.CollectStats(context.Background(), storage.PostRepository, storage.CommentRepository)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Posts:\t%d\n", stats.Posts)
+	fmt.Fprintf(w, "Comments:\t%d (%d deleted)\n", stats.Comments, stats.Deleted)
+	if stats.DeepestThread > 0 {
+		fmt.Fprintf(w, "Deepest thread:\t%d levels, post %s\n", stats.DeepestThread, stats.DeepestPost)
+	}
+	if stats.BusiestComments > 0 {
+		fmt.Fprintf(w, "Busiest post:\t%s, %d comments\n", stats.BusiestPost, stats.BusiestComments)
+	}
+	return w.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
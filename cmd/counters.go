@@ -0,0 +1,35 @@
+package main
+
+import (
+	"OZON/internal/config"
+	"OZON/internal/usecases"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const countersUsage = `usage: server counters [flags] rebuild
+
+  rebuild  recompute commentCount and replyCount from the stored comments`
+
+// runCounters implements the counters subcommand.
+func runCounters(cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "rebuild" {
+		return fmt.Errorf("unknown counters command %q\n%s", strings.Join(args, " "), countersUsage)
+	}
+
+	storage, closeStorage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	uc := usecases.NewCommentUsecase(storage.PostRepository, storage.CommentRepository, cfg.Limits.MaxCommentDepth)
+	repaired, err := uc.RebuildCounters(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "counters rebuilt, %d were wrong\n", repaired)
+	return nil
+}
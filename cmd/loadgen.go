@@ -0,0 +1,136 @@
+package main
+
+import (
+	"OZON/internal/config"
+	"OZON/internal/loadgen"
+	"OZON/internal/usecases"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const generateUsage = `usage: server generate [flags] POSTS [options]
+
+  Create POSTS posts with comment trees through the usecases.
+
+  --comments N    mean number of top-level comments per post, 10 by default
+  --branching B   mean number of replies per comment, 0.8 by default
+  --depth D       deepest reply level, 6 or limits.max_comment_depth if lower
+  --skew S        Zipf exponent of post popularity, 1 by default; 0 spreads
+                  the comments evenly
+  --closed R      share of posts closed for comments, 0.05 by default
+  --seed N        seed of the data set shape, 1 by default
+  --workers N     posts generated at once, 4 by default`
+
+const loadtestUsage = `usage: server loadtest URL [options]
+
+  Replay a mix of GraphQL operations against the server at URL, such as
+  http://localhost:8080/query, and report latency percentiles.
+
+  --duration D     length of the test, 30s by default
+  --concurrency N  requests in flight, 8 by default
+  --rate R         requests per second of all workers, each timed from
+                   its scheduled send; 0, the default, sends as fast as
+                   the server answers
+  --mix M          operation weights, getPosts=30,getPost=60,createComment=10
+                   by default
+  --skew S         Zipf exponent of post popularity, newest first, 1 by default
+  --seed N         seed of the request sequence, 1 by default`
+
+// runGenerate implements the generate subcommand.
+func runGenerate(cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts := loadgen.GenerateOptions{}
+	fs.Float64Var(&opts.Comments, "comments", 10, "")
+	fs.Float64Var(&opts.Branching, "branching", 0.8, "")
+	fs.IntVar(&opts.MaxDepth, "depth", 6, "")
+	fs.Float64Var(&opts.Skew, "skew", 1, "")
+	fs.Float64Var(&opts.ClosedRatio, "closed", 0.05, "")
+	fs.Uint64Var(&opts.Seed, "seed", 1, "")
+	fs.IntVar(&opts.Workers, "workers", 4, "")
+	posts, err := parseArgs(fs, args, "POSTS")
+	if err == nil {
+		if opts.Posts, err = strconv.Atoi(posts); err != nil {
+			err = fmt.Errorf("invalid number of posts %q", posts)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, generateUsage)
+	}
+	if limit := cfg.Limits.MaxCommentDepth; limit > 0 && opts.MaxDepth > limit {
+		depthSet := false
+		fs.Visit(func(f *flag.Flag) { depthSet = depthSet || f.Name == "depth" })
+		if depthSet {
+			return fmt.Errorf("--depth %d exceeds limits.max_comment_depth %d", opts.MaxDepth, limit)
+		}
+		opts.MaxDepth = limit
+	}
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("%w\n%s", err, generateUsage)
+	}
+	storage, closeStorage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var mu sync.Mutex
+	lastProgress := time.Now()
+	opts.Progress = func(posts, comments int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(lastProgress) >= time.Second {
+			lastProgress = time.Now()
+			fmt.Fprintf(os.Stderr, "%d posts and %d comments so far\n", posts, comments)
+		}
+	}
+	started := time.Now()
+	result, err := loadgen.Generate(ctx,
+		usecases.NewPostUsecase(storage.PostRepository, storage.CommentRepository),
+		usecases.NewCommentUsecase(storage.PostRepository, storage.CommentRepository, cfg.Limits.MaxCommentDepth),
+		opts)
+	fmt.Fprintf(out, "generated %d posts and %d comments in %s, deepest thread %d levels, busiest post %d comments\n",
+		result.Posts, result.Comments, time.Since(started).Round(time.Millisecond), result.DeepestThread, result.BusiestComments)
+	return err
+}
+
+// runLoadTest implements the loadtest subcommand. It only talks to the
+// server, so the storage flags do not apply.
+func runLoadTest(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts := loadgen.LoadOptions{Mix: loadgen.DefaultMix}
+	fs.DurationVar(&opts.Duration, "duration", 30*time.Second, "")
+	fs.IntVar(&opts.Concurrency, "concurrency", 8, "")
+	fs.Float64Var(&opts.Rate, "rate", 0, "")
+	fs.Func("mix", "", func(s string) (err error) {
+		opts.Mix, err = loadgen.ParseMix(s)
+		return err
+	})
+	fs.Float64Var(&opts.Skew, "skew", 1, "")
+	fs.Uint64Var(&opts.Seed, "seed", 1, "")
+	url, err := parseArgs(fs, args, "URL")
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, loadtestUsage)
+	}
+	opts.URL = url
+
+	// An interrupted test still reports what it measured.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := loadgen.LoadTest(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return report.Write(out)
+}
@@ -1,37 +1,104 @@
 package main
 
 import (
-	"OZON/graph"
 	"OZON/internal/config"
-	"OZON/internal/handlers"
-	"OZON/internal/usecases"
-	"OZON/pkg/storage"
-	"github.com/99designs/gqlgen/graphql/handler"
-	"github.com/99designs/gqlgen/graphql/playground"
-	"log"
-	"net/http"
+	"OZON/pkg/logging"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
 )
 
 func main() {
 
-	db, err := storage.NewPostgresDB()
-	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate", "counters", "queries", "posts", "comments", "stats", "export", "import", "generate", "loadtest":
+			command, args = args[0], args[1:]
+		case "post", "comment":
+			command, args = args[0]+"s", args[1:]
+		}
+	}
+
+	loaded, err := config.Load(args, os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-	cfg, err := config.NewConfig(*db)
 	if err != nil {
-		log.Fatalf("failed to initialize config: %v", err)
+		fatal("failed to load config", err)
 	}
+	cfg := loaded.Config
+	if loaded.PrintConfig {
+		fmt.Print(cfg.Redacted())
+		return
+	}
+	// From here on the standard log package writes through slog as well.
+	slog.SetDefault(logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format))
 
-	postUsecase := usecases.NewPostUsecase(cfg.PostRepository, cfg.CommentRepository)
-	commentUsecase := usecases.NewCommentUsecase(cfg.PostRepository, cfg.CommentRepository)
-
-	resolver := handlers.NewResolver(postUsecase, commentUsecase)
-
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
-
-	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	switch command {
+	case "migrate":
+		if err := runMigrate(cfg, loaded.Args, os.Stdout); err != nil {
+			fatal("migration failed", err)
+		}
+		return
+	case "counters":
+		if err := runCounters(cfg, loaded.Args, os.Stdout); err != nil {
+			fatal("counters failed", err)
+		}
+		return
+	case "queries":
+		if err := runQueries(loaded.Args, os.Stdout); err != nil {
+			fatal("queries failed", err)
+		}
+		return
+	case "posts":
+		if err := runPosts(cfg, loaded.Args, os.Stdout); err != nil {
+			fatal("posts failed", err)
+		}
+		return
+	case "comments":
+		if err := runComments(cfg, loaded.Args, os.Stdout); err != nil {
+			fatal("comments failed", err)
+		}
+		return
+	case "stats":
+		if err := runStats(cfg, loaded.Args, os.Stdout); err != nil {
+			fatal("stats failed", err)
+		}
+		return
+	case "export":
+		if err := runExport(cfg, loaded.Args, os.Stdout); err != nil {
+			fatal("export failed", err)
+		}
+		return
+	case "import":
+		if err := runImport(cfg, loaded.Args, os.Stdout); err != nil {
+			fatal("import failed", err)
+		}
+		return
+	case "generate":
+		if err := runGenerate(cfg, loaded.Args, os.Stdout); err != nil {
+			fatal("generate failed", err)
+		}
+		return
+	case "loadtest":
+		if err := runLoadTest(loaded.Args, os.Stdout); err != nil {
+			fatal("loadtest failed", err)
+		}
+		return
+	}
+	if len(loaded.Args) > 0 {
+		fatal("unexpected arguments", fmt.Errorf("%v", loaded.Args))
+	}
+	if err := runServe(cfg); err != nil {
+		fatal("server failed", err)
+	}
+}
 
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
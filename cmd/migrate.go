@@ -0,0 +1,85 @@
+package main
+
+import (
+	"OZON/internal/config"
+	"OZON/pkg/storage"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: server migrate [flags] up | down | status | to N
+
+  up      apply every pending migration
+  down    roll back the most recently applied migration
+  status  list migrations and whether they are applied
+  to N    migrate up or down to version N (0 rolls back everything)
+
+The flags and environment variables are those of the server; run
+"server -h" to list them.`
+
+// runMigrate implements the migrate subcommand. Only Postgres has versioned
+// migrations: the sqlite and inmemory backends create their schema themselves.
+func runMigrate(cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+	if cfg.Storage.Type != "postgres" {
+		return fmt.Errorf("migrations apply to postgres storage only, got %q", cfg.Storage.Type)
+	}
+
+	db, err := storage.ConnectPostgres(storage.PostgresConfig{
+		ConnString: cfg.Storage.Postgres.URL,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		err = m.Up(ctx)
+	case args[0] == "down" && len(args) == 1:
+		err = m.Down(ctx)
+	case args[0] == "to" && len(args) == 2:
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = m.To(ctx, version)
+	case args[0] == "status" && len(args) == 1:
+		// Printed below, after the other commands have run.
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		if s.Unknown {
+			applied += " (unknown to this binary)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"OZON/graph"
+	"OZON/pkg/persisted"
+	"fmt"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"io"
+	"os"
+	"strings"
+)
+
+const queriesUsage = `usage: server queries validate MANIFEST [SCHEMA]
+
+  validate  check every operation of a persisted query manifest against
+            the schema: SCHEMA if given, such as graph/schema.graphqls,
+            otherwise the one the server is built with`
+
+// runQueries implements the queries subcommand, which checks the manifest of
+// a frontend build before it is deployed with --query-allowlist.
+func runQueries(args []string, out io.Writer) error {
+	if len(args) < 2 || len(args) > 3 || args[0] != "validate" {
+		return fmt.Errorf("unknown queries command %q\n%s", strings.Join(args, " "), queriesUsage)
+	}
+
+	manifest, err := persisted.LoadManifest(args[1])
+	if err != nil {
+		return err
+	}
+	schema := graph.NewExecutableSchema(graph.Config{}).Schema()
+	if len(args) == 3 {
+		if schema, err = loadSchema(args[2]); err != nil {
+			return err
+		}
+	}
+
+	if err := manifest.Validate(schema); err != nil {
+		fmt.Fprintln(out, err)
+		return fmt.Errorf("manifest does not match the schema")
+	}
+	fmt.Fprintf(out, "%d operations are valid\n", manifest.Len())
+	return nil
+}
+
+func loadSchema(path string) (*ast.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	schema, gqlErr := gqlparser.LoadSchema(&ast.Source{Name: path, Input: string(data)})
+	if gqlErr != nil {
+		return nil, fmt.Errorf("invalid schema: %w", gqlErr)
+	}
+	return schema, nil
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"OZON/graph"
+	"OZON/internal/config"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/metrics"
+	"OZON/internal/repository/backend"
+	"OZON/internal/repository/cache"
+	"OZON/internal/usecases"
+	"OZON/pkg/logging"
+	"OZON/pkg/persisted"
+	"OZON/pkg/pubsub"
+	"OZON/pkg/ratelimit"
+	"OZON/pkg/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/vektah/gqlparser/v2/ast"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// traceFlushTimeout bounds the export of the last spans on exit.
+const traceFlushTimeout = 5 * time.Second
+
+// runServe runs the HTTP server, and the gRPC server if it has an address,
+// until SIGINT or SIGTERM, then shuts down in order: readiness fails, the
+// listeners close and in-flight requests finish, subscriptions and streams
+// end, and finally the storage is closed.
+func runServe(cfg *config.Config) error {
+	slog.Info("effective configuration", "config", cfg.Redacted())
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		File:         cfg.Tracing.File,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	// Deferred first so that it runs last, after the spans of the shutdown.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
+	tracingEnabled := cfg.Tracing.Exporter != "none"
+
+	storage, err := cfg.OpenStorage()
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			slog.Error("failed to close storage", "error", err)
+		}
+	}()
+
+	comments := pubsub.New[*domain.Comment]()
+	var m *metrics.Metrics
+	if cfg.Features.Metrics {
+		// Before the usecases are built: instrumenting replaces the repositories.
+		m = metrics.New()
+		m.InstrumentStorage(cfg.Storage.Type, storage)
+		m.RegisterBroker("comments", comments)
+	}
+	if cfg.Cache.Type != "none" {
+		// After instrumenting, so that the storage metrics only count misses.
+		c, err := newCache(cfg.Cache)
+		if err != nil {
+			return fmt.Errorf("failed to set up the cache: %w", err)
+		}
+		if closer, ok := c.(io.Closer); ok {
+			defer closer.Close()
+		}
+		cache.Decorate(storage, c, cfg.Cache.TTL)
+	}
+
+	postUsecase := usecases.NewPostUsecase(storage.PostRepository, storage.CommentRepository)
+	commentUsecase := usecases.NewCommentUsecase(storage.PostRepository, storage.CommentRepository, cfg.Limits.MaxCommentDepth)
+
+	resolver := handlers.NewResolver(postUsecase, commentUsecase, comments)
+
+	schema := graph.NewExecutableSchema(graph.Config{Resolvers: resolver})
+	srv := newGraphQLServer(schema, cfg.Features)
+	srv.SetErrorPresenter(handlers.NewErrorPresenter(cfg.Production()))
+	manifest, err := loadManifest(cfg, schema)
+	if err != nil {
+		return err
+	}
+	queries, closeQueries, err := newPersistedQueries(cfg, manifest)
+	if err != nil {
+		return err
+	}
+	defer closeQueries()
+	if queries != nil {
+		srv.Use(queries)
+	}
+	srv.Use(handlers.OperationLogger{})
+	if tracingEnabled {
+		srv.Use(handlers.Tracer{})
+	}
+	var limits handlers.RateLimit
+	if cfg.RateLimit.Enabled {
+		limits = handlers.NewRateLimit(newRateLimitStore(cfg.RateLimit, storage), map[string]ratelimit.Limit{
+			"createPost":    cfg.RateLimit.CreatePost,
+			"createComment": cfg.RateLimit.CreateComment,
+		})
+		srv.Use(limits)
+	}
+	if m != nil {
+		operations := cfg.Features.MetricsOperations
+		if manifest != nil {
+			operations = append(manifest.OperationNames(), operations...)
+		}
+		srv.Use(m.GraphQL(operations))
+	}
+	queryHandler := http.Handler(srv)
+	if cfg.Features.HTTPCache {
+		// Last, so that a 304 still shows up in the logs, traces and metrics.
+		srv.Use(handlers.NewHTTPCache(postUsecase))
+		queryHandler = handlers.HTTPCacheMiddleware(srv)
+	}
+
+	health := handlers.NewHealth(storage.Check, cfg.Production())
+
+	mux := http.NewServeMux()
+	if cfg.Features.Playground {
+		mux.Handle("/", playground.Handler("GraphQL playground", "/query"))
+	}
+	// Shutdown does not wait for hijacked connections; connections tracks the
+	// websocket handlers, which return when their connection is closed.
+	var connections sync.WaitGroup
+	mux.Handle("/query", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connections.Add(1)
+		defer connections.Done()
+		queryHandler.ServeHTTP(w, r)
+	}))
+	if cfg.Features.REST {
+		mux.Handle("/api/", handlers.NewREST(resolver, limits, cfg.Production()))
+	}
+	mux.HandleFunc("/healthz", health.Live)
+	mux.HandleFunc("/readyz", health.Ready)
+	if m != nil {
+		mux.Handle("/metrics", m.Handler())
+	}
+
+	// Cancelling the base context makes gqlgen close the websocket connections.
+	connCtx, closeConns := context.WithCancel(context.Background())
+	defer closeConns()
+	handler := logging.RequestIDMiddleware(ratelimit.ClientMiddleware(cfg.RateLimit.TrustProxy, cfg.RateLimit.UserHeader)(mux))
+	if tracingEnabled {
+		handler = traceHTTP(handler)
+	}
+	server := &http.Server{
+		Addr:              cfg.Server.ListenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return connCtx },
+	}
+
+	var grpcServer *grpc.Server
+	var grpcHealth *grpchealth.Server
+	grpcErr := make(chan error, 1)
+	if cfg.GRPC.ListenAddr != "" {
+		listener, err := net.Listen("tcp", cfg.GRPC.ListenAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for gRPC: %w", err)
+		}
+		grpcServer = handlers.NewGRPCServer(resolver, cfg.Production(), cfg.GRPC.Admin)
+		grpcHealth = grpchealth.NewServer()
+		healthpb.RegisterHealthServer(grpcServer, grpcHealth)
+		if cfg.GRPC.Reflection {
+			reflection.Register(grpcServer)
+		}
+		go func() {
+			slog.Info("listening for gRPC", "addr", cfg.GRPC.ListenAddr)
+			grpcErr <- grpcServer.Serve(listener)
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", cfg.Server.ListenAddr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		return err
+	case err := <-grpcErr:
+		server.Close()
+		return fmt.Errorf("gRPC server failed: %w", err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process instead of waiting for the drain.
+	stop()
+	slog.Info("shutting down", "drain_delay", cfg.Server.DrainDelay, "timeout", cfg.Server.ShutdownTimeout)
+
+	if grpcHealth != nil {
+		grpcHealth.Shutdown()
+	}
+	health.Drain(cfg.Server.DrainDelay)
+	slog.Info("waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("failed to drain in-flight requests", "error", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server stopped with error", "error", err)
+	}
+
+	// Completing the subscriptions before closing the connections lets the
+	// clients tell a shutdown from a network failure.
+	slog.Info("ending subscriptions", "count", comments.Close())
+	if err := comments.Wait(shutdownCtx); err != nil {
+		slog.Warn("failed to end subscriptions", "error", err)
+	}
+	closeConns()
+	if err := wait(shutdownCtx, &connections); err != nil {
+		slog.Warn("failed to close websocket connections", "error", err)
+	}
+	if grpcServer != nil {
+		// The WatchComments streams ended with the broker, so only unary
+		// calls are left to finish.
+		if err := stopGRPC(shutdownCtx, grpcServer); err != nil {
+			slog.Warn("failed to drain gRPC calls", "error", err)
+		}
+	}
+	return nil
+}
+
+// newRateLimitStore returns the store of the rate limit budgets. The postgres
+// store shares the connection pool of the storage, which validation ensures is
+// a Postgres one.
+func newRateLimitStore(cfg config.RateLimitConfig, storage *backend.Storage) ratelimit.Store {
+	if cfg.Storage == "postgres" {
+		return ratelimit.NewPostgres(storage.Pool)
+	}
+	return ratelimit.NewMemory()
+}
+
+// newCache returns the cache of the configured type.
+func newCache(cfg config.CacheConfig) (cache.Cache, error) {
+	if cfg.Type == "redis" {
+		return cache.NewRedis(cfg.RedisURL)
+	}
+	return cache.NewLRU(cfg.LRUSize)
+}
+
+// traceHTTP starts a server span for every GraphQL and REST request,
+// continuing the trace of the W3C traceparent header if the client sent one. A
+// websocket request is a single span that lasts as long as the connection; the
+// REST API renames the span after its route. Probes, metrics and the
+// playground are not traced.
+func traceHTTP(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "/query",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path == "/query" || strings.HasPrefix(r.URL.Path, "/api/")
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if r.URL.Path == "/query" {
+				return r.Method + " /query"
+			}
+			return r.Method + " /api"
+		}),
+	)
+}
+
+// stopGRPC stops the server gracefully, or at once when ctx is done.
+func stopGRPC(ctx context.Context, server *grpc.Server) error {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
+
+// wait is wg.Wait that gives up when ctx is done.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newGraphQLServer is handler.NewDefaultServer with introspection behind a feature toggle.
+func newGraphQLServer(es graphql.ExecutableSchema, features config.FeaturesConfig) *handler.Server {
+	srv := handler.New(es)
+
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+
+	if features.Introspection {
+		srv.Use(extension.Introspection{})
+	}
+	return srv
+}
+
+// loadManifest returns the query manifest, or nil when none is configured. A
+// manifest that does not match the schema is an error, as its queries would
+// fail for every client.
+func loadManifest(cfg *config.Config, schema graphql.ExecutableSchema) (*persisted.Manifest, error) {
+	if cfg.Queries.Manifest == "" {
+		return nil, nil
+	}
+	manifest, err := persisted.LoadManifest(cfg.Queries.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := manifest.Validate(schema.Schema()); err != nil {
+		return nil, fmt.Errorf("query manifest does not match the schema:\n%w", err)
+	}
+	slog.Info("loaded query manifest", "operations", manifest.Len(), "allowlist", cfg.Queries.Allowlist)
+	return manifest, nil
+}
+
+// newPersistedQueries returns the extension that resolves persisted queries:
+// the allowlist of manifest, APQ over the configured cache, or nil when both
+// are disabled. The returned function releases the cache.
+func newPersistedQueries(cfg *config.Config, manifest *persisted.Manifest) (graphql.HandlerExtension, func(), error) {
+	noop := func() {}
+	switch {
+	case cfg.Queries.Allowlist:
+		return handlers.NewAllowlist(manifest), noop, nil
+	case !cfg.Queries.APQ:
+		return nil, noop, nil
+	case cfg.Queries.APQCache == "redis":
+		store, err := cache.NewRedis(cfg.Cache.RedisURL)
+		if err != nil {
+			return nil, noop, err
+		}
+		return extension.AutomaticPersistedQuery{Cache: persisted.NewCache(store, manifest)}, func() { store.Close() }, nil
+	default:
+		store, err := cache.NewLRU(cfg.Queries.APQCacheSize)
+		if err != nil {
+			return nil, noop, err
+		}
+		return extension.AutomaticPersistedQuery{Cache: persisted.NewCache(store, manifest)}, noop, nil
+	}
+}
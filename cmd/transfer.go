@@ -0,0 +1,109 @@
+package main
+
+import (
+	"OZON/internal/admin"
+	"OZON/internal/config"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const exportUsage = `usage: server export [flags] FILE [--nested]
+
+  Write every post and comment to FILE as JSON Lines, "-" for stdout.
+
+  --nested  put the comments inside the line of their post instead of one
+            line per comment`
+
+const importUsage = `usage: server import [flags] FILE [--dry-run] [--batch-size N]
+
+  Store the posts and comments of an export read from FILE, "-" for stdin.
+  Rows whose ID is already stored are skipped.
+
+  --dry-run       only validate the input
+  --batch-size N  rows stored per batch, 500 by default`
+
+// runExport implements the export subcommand.
+func runExport(cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	nested := fs.Bool("nested", false, "")
+	path, err := parseArgs(fs, args, "FILE")
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, exportUsage)
+	}
+	storage, closeStorage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	w, closeFile := out, func() error { return nil }
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create export: %w", err)
+		}
+		w, closeFile = f, f.Close
+	}
+	counts, err := admin.Export(context.Background(), w, storage.PostRepository, storage.CommentRepository, *nested)
+	if closeErr := closeFile(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// The summary goes to stderr when the export itself goes to stdout.
+	if path == "-" {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "exported %d posts and %d comments\n", counts.Posts, counts.Comments)
+	return nil
+}
+
+// runImport implements the import subcommand.
+func runImport(cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var opts admin.ImportOptions
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "")
+	fs.IntVar(&opts.BatchSize, "batch-size", 500, "")
+	path, err := parseArgs(fs, args, "FILE")
+	if err == nil && opts.BatchSize <= 0 {
+		err = fmt.Errorf("--batch-size must be positive, got %d", opts.BatchSize)
+	}
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, importUsage)
+	}
+	storage, closeStorage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+	if storage.Importer == nil {
+		return fmt.Errorf("storage %s does not support import", cfg.Storage.Type)
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open export: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	counts, err := admin.Import(context.Background(), r, storage.PostRepository, storage.CommentRepository, storage.Importer, opts)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		fmt.Fprintf(out, "%d posts and %d comments are valid\n", counts.Posts, counts.Comments)
+		return nil
+	}
+	fmt.Fprintf(out, "imported %d posts and %d comments, skipped %d posts and %d comments already stored\n",
+		counts.Posts-counts.SkippedPosts, counts.Comments-counts.SkippedComments, counts.SkippedPosts, counts.SkippedComments)
+	return nil
+}
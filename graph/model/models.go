@@ -2,23 +2,33 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
 type Comment struct {
-	ID        string     `json:"id"`
-	Text      string     `json:"text"`
-	PostID    string     `json:"postId"`
-	ParentID  *string    `json:"parentId,omitempty"`
-	CreatedAt string     `json:"createdAt"`
-	Children  []*Comment `json:"children"`
+	ID        string  `json:"id"`
+	Text      string  `json:"text"`
+	PostID    string  `json:"postId"`
+	ParentID  *string `json:"parentId,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+	// Number of direct replies that are not deleted.
+	ReplyCount int        `json:"replyCount"`
+	Children   []*Comment `json:"children"`
 }
 
 type Mutation struct {
 }
 
 type Post struct {
-	ID            string     `json:"id"`
-	Text          string     `json:"text"`
-	AllowComments bool       `json:"allowComments"`
-	Comments      []*Comment `json:"comments"`
+	ID            string `json:"id"`
+	Text          string `json:"text"`
+	AllowComments bool   `json:"allowComments"`
+	// Number of comments on the post that are not deleted, replies included.
+	CommentCount int        `json:"commentCount"`
+	Comments     []*Comment `json:"comments"`
 }
 
 type Query struct {
@@ -26,3 +36,44 @@ type Query struct {
 
 type Subscription struct {
 }
+
+type CacheControlScope string
+
+const (
+	CacheControlScopePublic  CacheControlScope = "PUBLIC"
+	CacheControlScopePrivate CacheControlScope = "PRIVATE"
+)
+
+var AllCacheControlScope = []CacheControlScope{
+	CacheControlScopePublic,
+	CacheControlScopePrivate,
+}
+
+func (e CacheControlScope) IsValid() bool {
+	switch e {
+	case CacheControlScopePublic, CacheControlScopePrivate:
+		return true
+	}
+	return false
+}
+
+func (e CacheControlScope) String() string {
+	return string(e)
+}
+
+func (e *CacheControlScope) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CacheControlScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CacheControlScope", str)
+	}
+	return nil
+}
+
+func (e CacheControlScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,142 @@
+// Package admin holds the data inspection behind the maintenance commands of
+// the server binary. It reads through the repositories, so it works against
+// every storage backend.
+package admin
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"strings"
+)
+
+// pageSize is the page size used to walk all posts and comments.
+const pageSize = 100
+
+// Stats describes the stored data.
+type Stats struct {
+	Posts int
+	// Comments counts the comments that are not deleted, Deleted the others.
+	Comments int
+	Deleted  int
+	// DeepestThread is the nesting level of the deepest comment, top-level
+	// comments being level 1, and DeepestPost the post it is on.
+	DeepestThread int
+	DeepestPost   uuid.UUID
+	// BusiestPost has the most comments that are not deleted,
+	// BusiestComments of them; the first such post of the feed on a tie.
+	BusiestPost     uuid.UUID
+	BusiestComments int
+}
+
+// CollectStats walks every post and comment. The counters are counted from
+// the comments rather than read, so that they are right even when the stored
+// counters are not.
+func CollectStats(ctx context.Context, posts repository.PostRepository, comments repository.CommentRepository) (*Stats, error) {
+	stats := &Stats{}
+	err := EachPost(ctx, posts, func(post *domain.Post) error {
+		stats.Posts++
+		tree, err := Comments(ctx, comments, post.ID)
+		if err != nil {
+			return err
+		}
+		live := 0
+		walk(tree, 1, func(c *domain.Comment, depth int) {
+			if c.IsDeleted() {
+				stats.Deleted++
+			} else {
+				live++
+			}
+			if depth > stats.DeepestThread {
+				stats.DeepestThread, stats.DeepestPost = depth, post.ID
+			}
+		})
+		stats.Comments += live
+		if live > stats.BusiestComments {
+			stats.BusiestPost, stats.BusiestComments = post.ID, live
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// EachPost calls fn for every post in feed order, without its comments.
+func EachPost(ctx context.Context, posts repository.PostRepository, fn func(post *domain.Post) error) error {
+	for page := int32(1); ; page++ {
+		batch, err := posts.GetPosts(ctx, page, pageSize)
+		if err != nil {
+			return fmt.Errorf("failed to get posts: %w", err)
+		}
+		for _, post := range batch {
+			if err := fn(post); err != nil {
+				return err
+			}
+		}
+		if len(batch) < pageSize {
+			return nil
+		}
+	}
+}
+
+// Comments returns every top-level comment of a post with all its replies.
+func Comments(ctx context.Context, comments repository.CommentRepository, postID uuid.UUID) ([]*domain.Comment, error) {
+	var all []*domain.Comment
+	for page := int32(1); ; page++ {
+		batch, err := comments.GetCommentsForPost(ctx, postID, page, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get comments of post %s: %w", postID, err)
+		}
+		all = append(all, batch...)
+		if len(batch) < pageSize {
+			return all, nil
+		}
+	}
+}
+
+func walk(comments []*domain.Comment, depth int, fn func(c *domain.Comment, depth int)) {
+	for _, c := range comments {
+		fn(c, depth)
+		walk(c.Children, depth+1, fn)
+	}
+}
+
+// WriteTree writes a comment tree with one comment per line: its ID, a mark
+// if it is deleted, and its text shortened to a line.
+func WriteTree(w io.Writer, comments []*domain.Comment) error {
+	return writeTree(w, comments, "")
+}
+
+func writeTree(w io.Writer, comments []*domain.Comment, prefix string) error {
+	for i, c := range comments {
+		branch, indent := "├── ", "│   "
+		if i == len(comments)-1 {
+			branch, indent = "└── ", "    "
+		}
+		mark := ""
+		if c.IsDeleted() {
+			mark = "[deleted] "
+		}
+		if _, err := fmt.Fprintf(w, "%s%s%s %s%s\n", prefix, branch, c.ID, mark, Excerpt(c.Text, 60)); err != nil {
+			return err
+		}
+		if err := writeTree(w, c.Children, prefix+indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Excerpt returns text on a single line, cut to at most n characters.
+func Excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return text
+}
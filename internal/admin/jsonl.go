@@ -0,0 +1,437 @@
+package admin
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"time"
+)
+
+// FormatVersion is the version of the export format written by Export.
+const FormatVersion = 1
+
+// Record types of the export format.
+const (
+	TypeHeader  = "header"
+	TypePost    = "post"
+	TypeComment = "comment"
+)
+
+// Header is the first line of an export.
+type Header struct {
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// PostRecord is a post line of an export.
+type PostRecord struct {
+	Type          string     `json:"type"`
+	ID            uuid.UUID  `json:"id"`
+	Text          string     `json:"text"`
+	AllowComments bool       `json:"allowComments"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     *time.Time `json:"updatedAt,omitempty"`
+	// Comments holds the top-level comments of a nested export.
+	Comments []*CommentRecord `json:"comments,omitempty"`
+}
+
+// CommentRecord is a comment line of a flat export or a comment inside a
+// PostRecord.
+type CommentRecord struct {
+	// Type is empty for the comments nested in a post.
+	Type      string     `json:"type,omitempty"`
+	ID        uuid.UUID  `json:"id"`
+	PostID    uuid.UUID  `json:"postId"`
+	ParentID  *uuid.UUID `json:"parentId,omitempty"`
+	Text      string     `json:"text"`
+	CreatedAt time.Time  `json:"createdAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Replies holds the replies of a nested export.
+	Replies []*CommentRecord `json:"replies,omitempty"`
+}
+
+// Counts is the number of posts and comments an export wrote or an import
+// read; Skipped counts those an import found already stored.
+type Counts struct {
+	Posts           int
+	Comments        int
+	SkippedPosts    int
+	SkippedComments int
+}
+
+// Export writes every post and comment to w as JSON Lines: a Header, then
+// each post followed by its comments. In a flat export every comment is a
+// line of its own, after its parent; in a nested export the comments are
+// inside the line of their post. Posts are read one at a time, so the export
+// of a live store is consistent per post only.
+func Export(ctx context.Context, w io.Writer, posts repository.PostRepository, comments repository.CommentRepository, nested bool) (Counts, error) {
+	var counts Counts
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(Header{Type: TypeHeader, Version: FormatVersion, ExportedAt: time.Now().UTC()}); err != nil {
+		return counts, err
+	}
+
+	err := EachPost(ctx, posts, func(post *domain.Post) error {
+		tree, err := Comments(ctx, comments, post.ID)
+		if err != nil {
+			return err
+		}
+		record := &PostRecord{
+			Type:          TypePost,
+			ID:            post.ID,
+			Text:          post.Text,
+			AllowComments: post.AllowComments,
+			CreatedAt:     *post.CreatedAt,
+			UpdatedAt:     post.UpdatedAt,
+		}
+		counts.Posts++
+		walk(tree, 1, func(*domain.Comment, int) { counts.Comments++ })
+		if nested {
+			record.Comments = commentRecords(tree, "")
+			return enc.Encode(record)
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+		var encodeErr error
+		walk(tree, 1, func(c *domain.Comment, _ int) {
+			if encodeErr == nil {
+				encodeErr = enc.Encode(commentRecord(c, TypeComment))
+			}
+		})
+		return encodeErr
+	})
+	if err != nil {
+		return counts, err
+	}
+	return counts, bw.Flush()
+}
+
+func commentRecords(comments []*domain.Comment, typ string) []*CommentRecord {
+	records := make([]*CommentRecord, len(comments))
+	for i, c := range comments {
+		records[i] = commentRecord(c, typ)
+		records[i].Replies = commentRecords(c.Children, typ)
+	}
+	return records
+}
+
+func commentRecord(c *domain.Comment, typ string) *CommentRecord {
+	return &CommentRecord{
+		Type:      typ,
+		ID:        c.ID,
+		PostID:    c.PostID,
+		ParentID:  c.ParentID,
+		Text:      c.Text,
+		CreatedAt: *c.CreatedAt,
+		DeletedAt: c.DeletedAt,
+	}
+}
+
+// ImportOptions configure Import.
+type ImportOptions struct {
+	// BatchSize is the largest number of rows stored at once.
+	BatchSize int
+	// DryRun validates the input without storing anything.
+	DryRun bool
+}
+
+// Import reads an export from r and stores it through importer, checking
+// that every comment refers to a post and a parent of the same post that
+// come earlier in the input or are already stored. Rows already stored are
+// skipped, so an import that failed halfway can be repeated once the input is
+// fixed.
+func Import(ctx context.Context, r io.Reader, posts repository.PostRepository, comments repository.CommentRepository, importer repository.Importer, opts ImportOptions) (Counts, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	im := &importState{
+		ctx:         ctx,
+		posts:       posts,
+		comments:    comments,
+		importer:    importer,
+		opts:        opts,
+		inputPosts:  make(map[uuid.UUID]bool),
+		storedPosts: make(map[uuid.UUID]bool),
+		commentPost: make(map[uuid.UUID]uuid.UUID),
+		imported:    make(map[uuid.UUID]*domain.Post),
+	}
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			if lineErr := im.line(line, data); lineErr != nil {
+				return im.counts, fmt.Errorf("line %d: %w", line, lineErr)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return im.counts, fmt.Errorf("failed to read line %d: %w", line, err)
+		}
+	}
+	return im.counts, im.flush()
+}
+
+type importState struct {
+	ctx      context.Context
+	posts    repository.PostRepository
+	comments repository.CommentRepository
+	importer repository.Importer
+	opts     ImportOptions
+	counts   Counts
+
+	// inputPosts holds the posts read so far and storedPosts whether the
+	// other posts comments referred to are stored; commentPost maps the
+	// comments read so far to their post.
+	inputPosts  map[uuid.UUID]bool
+	storedPosts map[uuid.UUID]bool
+	commentPost map[uuid.UUID]uuid.UUID
+	// imported holds the posts this import stored, by their timestamps; they
+	// keep their UpdatedAt when their comments come in a later call.
+	imported map[uuid.UUID]*domain.Post
+
+	pendingPosts    []*domain.Post
+	pendingComments []*domain.Comment
+}
+
+func (im *importState) line(n int, data []byte) error {
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	switch typed.Type {
+	case TypeHeader:
+		var header Header
+		if err := dec.Decode(&header); err != nil {
+			return fmt.Errorf("invalid header: %w", err)
+		}
+		if n != 1 {
+			return errors.New("the header must be the first line")
+		}
+		if header.Version < 1 || header.Version > FormatVersion {
+			return fmt.Errorf("unsupported format version %d", header.Version)
+		}
+		return nil
+	case TypePost:
+		var record PostRecord
+		if err := dec.Decode(&record); err != nil {
+			return fmt.Errorf("invalid post: %w", err)
+		}
+		return im.post(&record)
+	case TypeComment:
+		var record CommentRecord
+		if err := dec.Decode(&record); err != nil {
+			return fmt.Errorf("invalid comment: %w", err)
+		}
+		if len(record.Replies) > 0 {
+			return fmt.Errorf("comment %s: replies are only allowed in a post", record.ID)
+		}
+		return im.comment(&record)
+	default:
+		return fmt.Errorf("unknown record type %q", typed.Type)
+	}
+}
+
+func (im *importState) post(record *PostRecord) error {
+	switch {
+	case record.ID == uuid.Nil:
+		return errors.New("post without id")
+	case im.inputPosts[record.ID]:
+		return fmt.Errorf("post %s: duplicate id", record.ID)
+	case record.Text == "" || len(record.Text) > 10000:
+		return fmt.Errorf("post %s: text must have 1 to 10000 bytes", record.ID)
+	case record.CreatedAt.IsZero():
+		return fmt.Errorf("post %s: createdAt is required", record.ID)
+	}
+	if err := im.makeRoom(); err != nil {
+		return err
+	}
+
+	createdAt := record.CreatedAt
+	im.inputPosts[record.ID] = true
+	im.pendingPosts = append(im.pendingPosts, &domain.Post{
+		ID:            record.ID,
+		Text:          record.Text,
+		AllowComments: record.AllowComments,
+		CreatedAt:     &createdAt,
+		UpdatedAt:     record.UpdatedAt,
+	})
+	im.counts.Posts++
+
+	var nested func(replies []*CommentRecord, parentID *uuid.UUID) error
+	nested = func(replies []*CommentRecord, parentID *uuid.UUID) error {
+		for _, c := range replies {
+			if c.Type != "" {
+				return fmt.Errorf("comment %s: nested comments have no type", c.ID)
+			}
+			if c.PostID == uuid.Nil {
+				c.PostID = record.ID
+			}
+			if c.ParentID == nil {
+				c.ParentID = parentID
+			}
+			if c.PostID != record.ID || (parentID == nil) != (c.ParentID == nil) || (parentID != nil && *c.ParentID != *parentID) {
+				return fmt.Errorf("comment %s: postId and parentId must match the nesting", c.ID)
+			}
+			if err := im.comment(c); err != nil {
+				return err
+			}
+			if err := nested(c.Replies, &c.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return nested(record.Comments, nil)
+}
+
+func (im *importState) comment(record *CommentRecord) error {
+	switch {
+	case record.ID == uuid.Nil:
+		return errors.New("comment without id")
+	case im.commentPost[record.ID] != uuid.Nil:
+		return fmt.Errorf("comment %s: duplicate id", record.ID)
+	case record.Text == "" || len(record.Text) > 2000:
+		return fmt.Errorf("comment %s: text must have 1 to 2000 bytes", record.ID)
+	case record.CreatedAt.IsZero():
+		return fmt.Errorf("comment %s: createdAt is required", record.ID)
+	}
+
+	exists, err := im.postExists(record.PostID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("comment %s: post %s not found", record.ID, record.PostID)
+	}
+	if record.ParentID != nil {
+		parentPost, err := im.parentPost(*record.ParentID)
+		if err != nil {
+			return err
+		}
+		switch parentPost {
+		case uuid.Nil:
+			return fmt.Errorf("comment %s: parent %s not found; parents must come before their replies", record.ID, *record.ParentID)
+		case record.PostID:
+		default:
+			return fmt.Errorf("comment %s: parent %s belongs to another post", record.ID, *record.ParentID)
+		}
+	}
+
+	if err := im.makeRoom(); err != nil {
+		return err
+	}
+
+	createdAt := record.CreatedAt
+	im.commentPost[record.ID] = record.PostID
+	im.pendingComments = append(im.pendingComments, &domain.Comment{
+		ID:        record.ID,
+		PostID:    record.PostID,
+		ParentID:  record.ParentID,
+		Text:      record.Text,
+		CreatedAt: &createdAt,
+		DeletedAt: record.DeletedAt,
+	})
+	im.counts.Comments++
+	return nil
+}
+
+// postExists looks for a post in the input read so far, then in the store.
+func (im *importState) postExists(id uuid.UUID) (bool, error) {
+	if im.inputPosts[id] {
+		return true, nil
+	}
+	if exists, ok := im.storedPosts[id]; ok {
+		return exists, nil
+	}
+	_, err := im.posts.IsCommentsAllowed(im.ctx, id)
+	if err != nil && !errors.Is(err, domain.ErrPostNotFound) {
+		return false, fmt.Errorf("failed to look up post %s: %w", id, err)
+	}
+	im.storedPosts[id] = err == nil
+	return err == nil, nil
+}
+
+// parentPost returns the post of a comment in the input read so far or in
+// the store, uuid.Nil if there is none.
+func (im *importState) parentPost(id uuid.UUID) (uuid.UUID, error) {
+	if postID, ok := im.commentPost[id]; ok {
+		return postID, nil
+	}
+	parent, err := im.comments.GetComment(im.ctx, id)
+	if errors.Is(err, domain.ErrCommentNotFound) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to look up comment %s: %w", id, err)
+	}
+	return parent.PostID, nil
+}
+
+// makeRoom stores the pending rows if the batch is full.
+func (im *importState) makeRoom() error {
+	if len(im.pendingPosts)+len(im.pendingComments) < im.opts.BatchSize {
+		return nil
+	}
+	return im.flush()
+}
+
+func (im *importState) flush() error {
+	posts, comments := im.pendingPosts, im.pendingComments
+	im.pendingPosts, im.pendingComments = nil, nil
+	if im.opts.DryRun || len(posts)+len(comments) == 0 {
+		return nil
+	}
+	if len(posts) > 0 {
+		stored, err := im.importer.Import(im.ctx, posts, nil)
+		if err != nil {
+			return err
+		}
+		byID := make(map[uuid.UUID]*domain.Post, len(posts))
+		for _, post := range posts {
+			byID[post.ID] = post
+		}
+		for _, id := range stored.PostIDs {
+			post := byID[id]
+			im.imported[id] = &domain.Post{ID: id, CreatedAt: post.CreatedAt, UpdatedAt: post.UpdatedAt}
+		}
+		im.counts.SkippedPosts += len(posts) - len(stored.PostIDs)
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+	// The posts this import stored are listed with their comments so they
+	// keep their UpdatedAt; the posts stored before it are updated now.
+	var listed []*domain.Post
+	seen := make(map[uuid.UUID]bool)
+	for _, comment := range comments {
+		if post := im.imported[comment.PostID]; post != nil && !seen[post.ID] {
+			seen[post.ID] = true
+			listed = append(listed, post)
+		}
+	}
+	stored, err := im.importer.Import(im.ctx, listed, comments)
+	if err != nil {
+		return err
+	}
+	im.counts.SkippedComments += len(comments) - stored.Comments
+	return nil
+}
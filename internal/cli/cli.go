@@ -1,33 +1,64 @@
+// Package cli parses the command line. It only collects the values that were
+// given; applying them on top of the configuration file and the environment is
+// up to the config package.
 package cli
 
 import (
-	"OZON/internal/repository/memory"
-	postgres "OZON/internal/repository/postrges"
-	"OZON/pkg/storage"
 	"flag"
-	"log"
+	"io"
 )
 
+// Flag describes a command-line option that overrides a configuration value.
 type Flag struct {
-	storageType string
+	Name  string
+	Usage string
+	// Bool flags may be given without a value (--playground means --playground=true).
+	Bool bool
 }
 
-func (f *Flag) ParseFlag() {
-	flag.StringVar(&f.storageType, "storage", "postgres", "Storage type: postgres or inmemory (default: postgres)")
-	flag.Parse()
+// Value is a flag given on the command line.
+type Value struct {
+	Name string
+	Raw  string
 }
 
-func ProcessFlag(db storage.DB) interface{} {
-	f := &Flag{}
-	f.ParseFlag()
-
-	switch f.storageType {
-	case "inmemory":
-		return memory.NewInMemoryRepository()
-	case "postgres":
-		return postgres.NewPostgresRepository(db)
-	default:
-		log.Fatalf("unknown storage type: %s. Use 'postgres' or 'inmemory'", f.storageType)
-		return nil
+// Args is the parsed command line.
+type Args struct {
+	ConfigPath  string
+	PrintConfig bool
+	// Values holds the configuration overrides in command-line order.
+	Values []Value
+	// Rest holds the arguments after the flags.
+	Rest []string
+}
+
+// ProcessFlag parses args against flags; parsing stops at the first argument
+// that is not a flag. --config and --print-config are always available. Usage
+// and errors are written to output; flag.ErrHelp is returned for -h and --help.
+func ProcessFlag(name string, args []string, flags []Flag, output io.Writer) (*Args, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	parsed := &Args{}
+	fs.StringVar(&parsed.ConfigPath, "config", "", "Path to a YAML configuration file (env OZON_CONFIG)")
+	fs.BoolVar(&parsed.PrintConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+
+	for _, f := range flags {
+		f := f
+		record := func(raw string) error {
+			parsed.Values = append(parsed.Values, Value{Name: f.Name, Raw: raw})
+			return nil
+		}
+		if f.Bool {
+			fs.BoolFunc(f.Name, f.Usage, record)
+		} else {
+			fs.Func(f.Name, f.Usage, record)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
 	}
+	parsed.Rest = fs.Args()
+	return parsed, nil
 }
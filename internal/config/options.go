@@ -0,0 +1,197 @@
+package config
+
+import (
+	"OZON/internal/cli"
+	"encoding"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// option binds a configuration value to its environment variable and flag.
+// The YAML key is given by the struct tags of Config.
+type option struct {
+	env   string
+	flag  string
+	usage string
+	field func(c *Config) interface{}
+}
+
+// options lists every setting that can be overridden from the environment or
+// the command line. MAX_COMMENT_DEPTH, APP_ENV and POSTGRES_CONNECTION_STRING
+// keep the names they had before the configuration file was introduced.
+var options = []option{
+	{"OZON_LISTEN_ADDR", "listen-addr", "HTTP listen address, host:port",
+		func(c *Config) interface{} { return &c.Server.ListenAddr }},
+	{"APP_ENV", "env", "Environment: development or production",
+		func(c *Config) interface{} { return &c.Server.Environment }},
+	{"OZON_SHUTDOWN_TIMEOUT", "shutdown-timeout", "How long to wait for in-flight requests on SIGTERM",
+		func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+	{"OZON_DRAIN_DELAY", "drain-delay", "How long to keep serving after readiness fails on SIGTERM",
+		func(c *Config) interface{} { return &c.Server.DrainDelay }},
+
+	{"OZON_STORAGE", "storage", "Storage type: postgres, inmemory or sqlite",
+		func(c *Config) interface{} { return &c.Storage.Type }},
+	{"POSTGRES_CONNECTION_STRING", "postgres-url", "Postgres connection URL",
+		func(c *Config) interface{} { return &c.Storage.Postgres.URL }},
+	{"OZON_POSTGRES_MAX_OPEN_CONNS", "postgres-max-open-conns", "Maximum number of open Postgres connections; 0 means unlimited",
+		func(c *Config) interface{} { return &c.Storage.Postgres.MaxOpenConns }},
+	{"OZON_POSTGRES_MAX_IDLE_CONNS", "postgres-max-idle-conns", "Maximum number of idle Postgres connections",
+		func(c *Config) interface{} { return &c.Storage.Postgres.MaxIdleConns }},
+	{"OZON_POSTGRES_CONN_MAX_LIFETIME", "postgres-conn-max-lifetime", "Close Postgres connections older than this; 0 means never",
+		func(c *Config) interface{} { return &c.Storage.Postgres.ConnMaxLifetime }},
+	{"OZON_POSTGRES_CONN_MAX_IDLE_TIME", "postgres-conn-max-idle-time", "Close Postgres connections idle for this long; 0 means never",
+		func(c *Config) interface{} { return &c.Storage.Postgres.ConnMaxIdleTime }},
+	{"OZON_POSTGRES_AUTO_MIGRATE", "postgres-auto-migrate", "Apply pending Postgres migrations at startup",
+		func(c *Config) interface{} { return &c.Storage.Postgres.AutoMigrate }},
+	{"OZON_SQLITE_PATH", "sqlite-path", "Path to the database file for --storage sqlite",
+		func(c *Config) interface{} { return &c.Storage.SQLite.Path }},
+	{"OZON_INMEMORY_DIR", "inmemory-dir", "Directory for the write-ahead log and snapshots of --storage inmemory; empty disables persistence",
+		func(c *Config) interface{} { return &c.Storage.InMemory.Dir }},
+	{"OZON_INMEMORY_FSYNC", "inmemory-fsync", "When to fsync the in-memory write-ahead log: always, interval or never",
+		func(c *Config) interface{} { return &c.Storage.InMemory.Fsync }},
+	{"OZON_INMEMORY_FSYNC_INTERVAL", "inmemory-fsync-interval", "Fsync period for --inmemory-fsync interval",
+		func(c *Config) interface{} { return &c.Storage.InMemory.FsyncInterval }},
+	{"OZON_INMEMORY_SNAPSHOT_INTERVAL", "inmemory-snapshot-interval", "Period of in-memory snapshots; 0 disables them",
+		func(c *Config) interface{} { return &c.Storage.InMemory.SnapshotInterval }},
+
+	{"MAX_COMMENT_DEPTH", "max-comment-depth", "Maximum nesting depth of replies; 0 means no limit",
+		func(c *Config) interface{} { return &c.Limits.MaxCommentDepth }},
+
+	{"OZON_LOG_LEVEL", "log-level", "Log level: debug, info, warn or error",
+		func(c *Config) interface{} { return &c.Log.Level }},
+	{"OZON_LOG_FORMAT", "log-format", "Log format: text or json",
+		func(c *Config) interface{} { return &c.Log.Format }},
+
+	{"OZON_PLAYGROUND", "playground", "Serve the GraphQL playground at /",
+		func(c *Config) interface{} { return &c.Features.Playground }},
+	{"OZON_INTROSPECTION", "introspection", "Allow GraphQL introspection queries",
+		func(c *Config) interface{} { return &c.Features.Introspection }},
+	{"OZON_METRICS", "metrics", "Serve Prometheus metrics at /metrics",
+		func(c *Config) interface{} { return &c.Features.Metrics }},
+	{"OZON_METRICS_OPERATIONS", "metrics-operations", "Comma-separated operation names that label the metrics, besides those of --query-manifest",
+		func(c *Config) interface{} { return &c.Features.MetricsOperations }},
+	{"OZON_HTTP_CACHE", "http-cache", "Send ETag and Cache-Control headers for GET queries",
+		func(c *Config) interface{} { return &c.Features.HTTPCache }},
+	{"OZON_REST", "rest", "Serve the REST API under /api",
+		func(c *Config) interface{} { return &c.Features.REST }},
+
+	{"OZON_GRPC_LISTEN_ADDR", "grpc-listen-addr", "gRPC listen address, host:port; empty disables the gRPC server",
+		func(c *Config) interface{} { return &c.GRPC.ListenAddr }},
+	{"OZON_GRPC_REFLECTION", "grpc-reflection", "Register the gRPC reflection service",
+		func(c *Config) interface{} { return &c.GRPC.Reflection }},
+	{"OZON_GRPC_ADMIN", "grpc-admin", "Enable the unauthenticated DeleteComment and RebuildCounters gRPC methods",
+		func(c *Config) interface{} { return &c.GRPC.Admin }},
+
+	{"OZON_TRACING_EXPORTER", "tracing-exporter", "Trace exporter: none, otlp or file",
+		func(c *Config) interface{} { return &c.Tracing.Exporter }},
+	{"OZON_TRACING_OTLP_ENDPOINT", "tracing-otlp-endpoint", "OTLP/HTTP collector URL; empty uses the OTEL_EXPORTER_OTLP_* variables",
+		func(c *Config) interface{} { return &c.Tracing.OTLPEndpoint }},
+	{"OZON_TRACING_FILE", "tracing-file", "File the spans are appended to for --tracing-exporter file",
+		func(c *Config) interface{} { return &c.Tracing.File }},
+	{"OZON_TRACING_SAMPLE_RATIO", "tracing-sample-ratio", "Fraction of new traces to record, from 0 to 1",
+		func(c *Config) interface{} { return &c.Tracing.SampleRatio }},
+
+	{"OZON_RATELIMIT", "ratelimit", "Limit how often each client may call the mutations",
+		func(c *Config) interface{} { return &c.RateLimit.Enabled }},
+	{"OZON_RATELIMIT_STORAGE", "ratelimit-storage", "Where rate limit budgets are kept: memory or postgres (shared by replicas)",
+		func(c *Config) interface{} { return &c.RateLimit.Storage }},
+	{"OZON_RATELIMIT_TRUST_PROXY", "ratelimit-trust-proxy", "Take the client address from X-Forwarded-For",
+		func(c *Config) interface{} { return &c.RateLimit.TrustProxy }},
+	{"OZON_RATELIMIT_USER_HEADER", "ratelimit-user-header", "Header with the user id set by the proxy; needs --ratelimit-trust-proxy",
+		func(c *Config) interface{} { return &c.RateLimit.UserHeader }},
+	{"OZON_RATELIMIT_CREATE_POST", "ratelimit-create-post", "createPost budget per client, count/period such as 5/1m; 0 means unlimited",
+		func(c *Config) interface{} { return &c.RateLimit.CreatePost }},
+	{"OZON_RATELIMIT_CREATE_COMMENT", "ratelimit-create-comment", "createComment budget per client, count/period such as 30/1m; 0 means unlimited",
+		func(c *Config) interface{} { return &c.RateLimit.CreateComment }},
+
+	{"OZON_CACHE", "cache", "Cache for posts and first comment pages: none, lru or redis",
+		func(c *Config) interface{} { return &c.Cache.Type }},
+	{"OZON_CACHE_TTL", "cache-ttl", "How long cached posts are served",
+		func(c *Config) interface{} { return &c.Cache.TTL }},
+	{"OZON_CACHE_LRU_SIZE", "cache-lru-size", "Maximum number of entries of --cache lru",
+		func(c *Config) interface{} { return &c.Cache.LRUSize }},
+	{"OZON_CACHE_REDIS_URL", "cache-redis-url", "Server URL for --cache redis",
+		func(c *Config) interface{} { return &c.Cache.RedisURL }},
+
+	{"OZON_APQ", "apq", "Accept automatic persisted queries",
+		func(c *Config) interface{} { return &c.Queries.APQ }},
+	{"OZON_APQ_CACHE", "apq-cache", "Where persisted queries are registered: lru or redis (--cache-redis-url)",
+		func(c *Config) interface{} { return &c.Queries.APQCache }},
+	{"OZON_APQ_CACHE_SIZE", "apq-cache-size", "Maximum number of persisted queries of --apq-cache lru",
+		func(c *Config) interface{} { return &c.Queries.APQCacheSize }},
+	{"OZON_QUERY_MANIFEST", "query-manifest", "Persisted query manifest of the frontend build",
+		func(c *Config) interface{} { return &c.Queries.Manifest }},
+	{"OZON_QUERY_ALLOWLIST", "query-allowlist", "Execute only the queries of --query-manifest",
+		func(c *Config) interface{} { return &c.Queries.Allowlist }},
+}
+
+func flags() []cli.Flag {
+	out := make([]cli.Flag, 0, len(options))
+	for _, opt := range options {
+		_, isBool := opt.field(Default()).(*bool)
+		out = append(out, cli.Flag{
+			Name:  opt.flag,
+			Usage: fmt.Sprintf("%s (env %s)", opt.usage, opt.env),
+			Bool:  isBool,
+		})
+	}
+	return out
+}
+
+func optionByFlag(name string) option {
+	for _, opt := range options {
+		if opt.flag == name {
+			return opt
+		}
+	}
+	// cli.ProcessFlag only accepts the flags built from options.
+	panic(fmt.Sprintf("config: no option for flag %q", name))
+}
+
+// set parses raw according to the type of the option's field and stores it.
+func (o option) set(c *Config, raw string) error {
+	switch p := o.field(c).(type) {
+	case *string:
+		*p = raw
+	case *int:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		*p = v
+	case *bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		*p = v
+	case *float64:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		*p = v
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	case *time.Duration:
+		v, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", raw)
+		}
+		*p = v
+	case encoding.TextUnmarshaler:
+		if err := p.UnmarshalText([]byte(raw)); err != nil {
+			return err
+		}
+	default:
+		panic(fmt.Sprintf("config: unsupported type %T for %s", p, o.env))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"OZON/internal/repository/backend"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Validate checks every value and reports all problems at once, naming each
+// by its key in the configuration file.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if err := validateListenAddr(c.Server.ListenAddr); err != nil {
+		fail("server.listen_addr", "%v", err)
+	}
+	oneOf(fail, "server.environment", c.Server.Environment, "development", "production")
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout", "must be positive, got %s", c.Server.ShutdownTimeout)
+	}
+	if c.Server.DrainDelay < 0 {
+		fail("server.drain_delay", "must not be negative, got %s", c.Server.DrainDelay)
+	}
+
+	if addr := c.GRPC.ListenAddr; addr != "" {
+		if err := validateListenAddr(addr); err != nil {
+			fail("grpc.listen_addr", "%v", err)
+		} else if addr == c.Server.ListenAddr {
+			fail("grpc.listen_addr", "must differ from server.listen_addr")
+		}
+	}
+
+	oneOf(fail, "storage.type", c.Storage.Type, backend.Names()...)
+	pg := c.Storage.Postgres
+	if c.Storage.Type == "postgres" && pg.URL == "" {
+		fail("storage.postgres.url", "must be set for postgres storage")
+	}
+	if pg.MaxOpenConns < 0 {
+		fail("storage.postgres.max_open_conns", "must not be negative, got %d", pg.MaxOpenConns)
+	}
+	if pg.MaxIdleConns < 0 {
+		fail("storage.postgres.max_idle_conns", "must not be negative, got %d", pg.MaxIdleConns)
+	}
+	if pg.MaxOpenConns > 0 && pg.MaxIdleConns > pg.MaxOpenConns {
+		fail("storage.postgres.max_idle_conns", "must not exceed max_open_conns (%d), got %d", pg.MaxOpenConns, pg.MaxIdleConns)
+	}
+	if pg.ConnMaxLifetime < 0 {
+		fail("storage.postgres.conn_max_lifetime", "must not be negative, got %s", pg.ConnMaxLifetime)
+	}
+	if pg.ConnMaxIdleTime < 0 {
+		fail("storage.postgres.conn_max_idle_time", "must not be negative, got %s", pg.ConnMaxIdleTime)
+	}
+	if c.Storage.Type == "sqlite" && c.Storage.SQLite.Path == "" {
+		fail("storage.sqlite.path", "must be set for sqlite storage")
+	}
+	mem := c.Storage.InMemory
+	oneOf(fail, "storage.inmemory.fsync", mem.Fsync, "always", "interval", "never")
+	if mem.Fsync == "interval" && mem.FsyncInterval <= 0 {
+		fail("storage.inmemory.fsync_interval", "must be positive when fsync is interval, got %s", mem.FsyncInterval)
+	}
+	if mem.SnapshotInterval < 0 {
+		fail("storage.inmemory.snapshot_interval", "must not be negative, got %s", mem.SnapshotInterval)
+	}
+
+	if c.Limits.MaxCommentDepth < 0 {
+		fail("limits.max_comment_depth", "must not be negative, got %d", c.Limits.MaxCommentDepth)
+	}
+
+	oneOf(fail, "log.level", c.Log.Level, "debug", "info", "warn", "error")
+	oneOf(fail, "log.format", c.Log.Format, "text", "json")
+
+	tr := c.Tracing
+	oneOf(fail, "tracing.exporter", tr.Exporter, "none", "otlp", "file")
+	if tr.Exporter == "otlp" && tr.OTLPEndpoint != "" {
+		if u, err := url.Parse(tr.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("tracing.otlp_endpoint", "must be an http or https URL, got %q", tr.OTLPEndpoint)
+		}
+	}
+	if tr.Exporter == "file" && tr.File == "" {
+		fail("tracing.file", "must be set for the file exporter")
+	}
+	if tr.SampleRatio < 0 || tr.SampleRatio > 1 {
+		fail("tracing.sample_ratio", "must be between 0 and 1, got %g", tr.SampleRatio)
+	}
+
+	rl := c.RateLimit
+	oneOf(fail, "ratelimit.storage", rl.Storage, "memory", "postgres")
+	if rl.Enabled && rl.Storage == "postgres" && c.Storage.Type != "postgres" {
+		fail("ratelimit.storage", "postgres needs postgres storage, got %q", c.Storage.Type)
+	}
+	if rl.UserHeader != "" && !rl.TrustProxy {
+		fail("ratelimit.user_header", "needs ratelimit.trust_proxy, or clients could choose their user")
+	}
+
+	ca := c.Cache
+	oneOf(fail, "cache.type", ca.Type, "none", "lru", "redis")
+	if ca.Type != "none" && ca.TTL <= 0 {
+		fail("cache.ttl", "must be positive, got %s", ca.TTL)
+	}
+	if ca.Type == "lru" && ca.LRUSize <= 0 {
+		fail("cache.lru_size", "must be positive, got %d", ca.LRUSize)
+	}
+
+	q := c.Queries
+	oneOf(fail, "queries.apq_cache", q.APQCache, "lru", "redis")
+	if q.APQ && q.APQCache == "lru" && q.APQCacheSize <= 0 {
+		fail("queries.apq_cache_size", "must be positive, got %d", q.APQCacheSize)
+	}
+	if q.Allowlist && q.Manifest == "" {
+		fail("queries.allowlist", "needs queries.manifest")
+	}
+	// The post cache and APQ share the Redis server.
+	if ca.Type == "redis" || (q.APQ && !q.Allowlist && q.APQCache == "redis") {
+		if u, err := url.Parse(ca.RedisURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+			fail("cache.redis_url", "must be a redis:// or rediss:// URL")
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func oneOf(fail func(key, format string, args ...interface{}), key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("must be host:port, got %q", addr)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
@@ -8,9 +8,17 @@ import (
 type Post struct {
 	ID            uuid.UUID  `gorm:"primaryKey;type:uuid"`
 	Text          string     `gorm:"type:text;not null"`
-	AllowComments bool       `gorm:"type:boolean;not null;default:true"`
+	AllowComments bool       `gorm:"type:boolean;not null"` // no GORM default: it would replace an explicit false on insert
 	Comments      []*Comment `gorm:"foreignKey:PostID"`
 	CreatedAt     *time.Time `gorm:"type:timestamp with time zone;not null"`
+	// CommentCount is the number of comments on the post that are not deleted,
+	// replies included. Repositories maintain it; it is ignored on create.
+	CommentCount int `gorm:"not null"`
+	// UpdatedAt is when the post or its discussion last changed: a comment was
+	// created or deleted, comments were opened or closed, or a counter repaired.
+	// It versions the post for HTTP caching. Repositories maintain it; it is
+	// ignored on create.
+	UpdatedAt *time.Time `gorm:"type:timestamp with time zone;not null;autoCreateTime:false;autoUpdateTime:false"`
 }
 
 type Comment struct {
@@ -19,7 +27,15 @@ type Comment struct {
 	PostID    uuid.UUID  `gorm:"type:uuid;not null"`
 	ParentID  *uuid.UUID `gorm:"type:uuid"`
 	CreatedAt *time.Time `gorm:"type:timestamp with time zone;not null;default:now()"`
+	DeletedAt *time.Time `gorm:"type:timestamp with time zone"`
 	Children  []*Comment `gorm:"foreignKey:ParentID"`
+	// ReplyCount is the number of direct replies that are not deleted.
+	// Repositories maintain it; it is ignored on create.
+	ReplyCount int `gorm:"not null"`
+}
+
+func (c *Comment) IsDeleted() bool {
+	return c.DeletedAt != nil
 }
 
 func (Post) TableName() string {
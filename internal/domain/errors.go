@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Error kinds. Every error returned by repositories and usecases that a client
+// can act on matches exactly one of them with errors.Is; anything else is an
+// internal failure.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrValidation       = errors.New("validation failed")
+	ErrForbidden        = errors.New("forbidden")
+	ErrCommentsDisabled = errors.New("comments are disabled for this post")
+	ErrConflict         = errors.New("conflict")
+	ErrRateLimited      = errors.New("rate limit exceeded")
+)
+
+var (
+	ErrPostNotFound    = newKindError(ErrNotFound, "post not found")
+	ErrCommentNotFound = newKindError(ErrNotFound, "comment not found")
+
+	ErrParentNotFound     = NewValidationError("parentId", "parent comment not found")
+	ErrParentPostMismatch = NewValidationError("parentId", "parent comment belongs to a different post")
+	ErrParentDeleted      = NewValidationError("parentId", "parent comment is deleted")
+	ErrMaxDepthExceeded   = NewValidationError("parentId", "maximum comment nesting depth exceeded")
+)
+
+const (
+	CodeNotFound         = "NOT_FOUND"
+	CodeValidation       = "BAD_USER_INPUT"
+	CodeForbidden        = "FORBIDDEN"
+	CodeCommentsDisabled = "COMMENTS_DISABLED"
+	CodeConflict         = "CONFLICT"
+	CodeRateLimited      = "RATE_LIMITED"
+	CodeInternal         = "INTERNAL_SERVER_ERROR"
+)
+
+// ErrorCode returns the client-facing code for err. The second value is false
+// when err is not a domain error and its details should not leak to clients.
+func ErrorCode(err error) (string, bool) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return CodeNotFound, true
+	case errors.Is(err, ErrValidation):
+		return CodeValidation, true
+	case errors.Is(err, ErrForbidden):
+		return CodeForbidden, true
+	case errors.Is(err, ErrCommentsDisabled):
+		return CodeCommentsDisabled, true
+	case errors.Is(err, ErrConflict):
+		return CodeConflict, true
+	case errors.Is(err, ErrRateLimited):
+		return CodeRateLimited, true
+	default:
+		return CodeInternal, false
+	}
+}
+
+// ValidationError reports an invalid input value. Field holds the name of the
+// offending argument as clients see it in the API.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func NewValidationError(field, message string) *ValidationError {
+	return &ValidationError{Field: field, Message: message}
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// RateLimitError reports that the caller has used up its budget for an
+// operation. RetryAfter is how long until the next call will be accepted.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func NewRateLimitError(retryAfter time.Duration) *RateLimitError {
+	return &RateLimitError{RetryAfter: retryAfter}
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry in %d s", e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds returns RetryAfter in whole seconds, rounded up so that a
+// client waiting that long is not rejected again.
+func (e *RateLimitError) RetryAfterSeconds() int {
+	s := int((e.RetryAfter + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// NewNotFoundError returns an error matching ErrNotFound with a custom message.
+func NewNotFoundError(message string) error {
+	return newKindError(ErrNotFound, message)
+}
+
+// NewConflictError returns an error matching ErrConflict with a custom message.
+func NewConflictError(message string) error {
+	return newKindError(ErrConflict, message)
+}
+
+type kindError struct {
+	kind    error
+	message string
+}
+
+func newKindError(kind error, message string) error {
+	return &kindError{kind: kind, message: message}
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"OZON/internal/domain"
+	"context"
+	"errors"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"log/slog"
+)
+
+const internalErrorMessage = "internal server error"
+
+// NewErrorPresenter returns a gqlgen error presenter that adds extensions.code
+// to every resolver error, along with extensions.field for validation errors
+// and extensions.retryAfter, in seconds, for rate limited calls. In production
+// mode errors that are not domain errors are replaced with a generic message so
+// that database and infrastructure details do not reach clients.
+func NewErrorPresenter(production bool) graphql.ErrorPresenterFunc {
+	return func(ctx context.Context, err error) *gqlerror.Error {
+		gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+		// Errors produced by gqlgen itself (parsing, argument coercion) carry no
+		// cause and already describe the problem with the request.
+		if gqlErr.Err == nil {
+			return gqlErr
+		}
+
+		code, known := domain.ErrorCode(gqlErr.Err)
+		if gqlErr.Extensions == nil {
+			gqlErr.Extensions = make(map[string]interface{})
+		}
+		gqlErr.Extensions["code"] = code
+
+		var validationErr *domain.ValidationError
+		if errors.As(gqlErr.Err, &validationErr) {
+			gqlErr.Extensions["field"] = validationErr.Field
+		}
+		var rateLimitErr *domain.RateLimitError
+		if errors.As(gqlErr.Err, &rateLimitErr) {
+			gqlErr.Extensions["retryAfter"] = rateLimitErr.RetryAfterSeconds()
+		}
+
+		if !known {
+			slog.ErrorContext(ctx, "graphql resolver failed", "path", gqlErr.Path.String(), "error", gqlErr.Err)
+			if production {
+				gqlErr.Message = internalErrorMessage
+			}
+		}
+		return gqlErr
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"OZON/graph/model"
 	"OZON/internal/domain"
 	"OZON/internal/usecases"
+	"OZON/pkg/pubsub"
 	"context"
 	"fmt"
 	"github.com/google/uuid"
@@ -16,32 +17,36 @@ import (
 type Resolver struct {
 	postUsecase    *usecases.PostUsecase
 	commentUsecase *usecases.CommentUsecase
+	// comments delivers created comments to newComment subscribers, by post ID.
+	comments *pubsub.Broker[*domain.Comment]
 }
 
-func NewResolver(postUsecase *usecases.PostUsecase, commentUsecase *usecases.CommentUsecase) *Resolver {
+func NewResolver(postUsecase *usecases.PostUsecase, commentUsecase *usecases.CommentUsecase, comments *pubsub.Broker[*domain.Comment]) *Resolver {
 	return &Resolver{
 		postUsecase:    postUsecase,
 		commentUsecase: commentUsecase,
+		comments:       comments,
 	}
 }
 
 // CreatePost is the resolver for the createPost field.
 func (r *mutationResolver) CreatePost(ctx context.Context, text string, allowComments *bool) (*model.Post, error) {
 	if text == "" {
-		return nil, fmt.Errorf("post text cannot be empty")
+		return nil, domain.NewValidationError("text", "post text cannot be empty")
 	}
 	if len(text) > 10000 {
-		return nil, fmt.Errorf("post text too long")
+		return nil, domain.NewValidationError("text", "post text too long")
 	}
 
 	domainPost, err := r.postUsecase.CreatePost(ctx, text, allowComments)
 	if err != nil {
-		return nil, fmt.Errorf("%v", err)
+		return nil, err
 	}
 	return &model.Post{
 		ID:            domainPost.ID.String(),
 		Text:          domainPost.Text,
 		AllowComments: domainPost.AllowComments,
+		CommentCount:  domainPost.CommentCount,
 		Comments:      convertComments(domainPost.Comments, nil, nil),
 	}, nil
 }
@@ -49,23 +54,23 @@ func (r *mutationResolver) CreatePost(ctx context.Context, text string, allowCom
 // CreateComment is the resolver for the createComment field.
 func (r *mutationResolver) CreateComment(ctx context.Context, postID string, text string, parentID *string) (*model.Comment, error) {
 	if postID == "" {
-		return nil, fmt.Errorf("post ID cannot be empty")
+		return nil, domain.NewValidationError("postId", "post ID cannot be empty")
 	}
 	uuidPostID, err := uuid.Parse(postID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid post ID format: %v", err)
+		return nil, domain.NewValidationError("postId", fmt.Sprintf("invalid post ID format: %v", err))
 	}
 	if text == "" {
-		return nil, fmt.Errorf("comment text cannot be empty")
+		return nil, domain.NewValidationError("text", "comment text cannot be empty")
 	}
 	if len(text) > 2000 {
-		return nil, fmt.Errorf("comment text exceeds 2000 characters")
+		return nil, domain.NewValidationError("text", "comment text exceeds 2000 characters")
 	}
 	var uuidParentID *uuid.UUID
 	if parentID != nil {
 		pid, err := uuid.Parse(*parentID)
 		if err != nil {
-			return nil, fmt.Errorf("invalid parent ID format: %v", err)
+			return nil, domain.NewValidationError("parentId", fmt.Sprintf("invalid parent ID format: %v", err))
 		}
 		uuidParentID = &pid
 	}
@@ -77,31 +82,20 @@ func (r *mutationResolver) CreateComment(ctx context.Context, postID string, tex
 	}
 	createdComment, err := r.commentUsecase.CreateComment(ctx, domainComment)
 	if err != nil {
-		return nil, fmt.Errorf("%v", err)
+		return nil, err
 	}
-	var parentIDStr *string
-	if createdComment.ParentID != nil {
-		str := createdComment.ParentID.String()
-		parentIDStr = &str
-	}
-	return &model.Comment{
-		ID:        createdComment.ID.String(),
-		Text:      createdComment.Text,
-		PostID:    createdComment.PostID.String(),
-		ParentID:  parentIDStr,
-		CreatedAt: createdComment.CreatedAt.Format(time.RFC3339),
-		Children:  convertComments(createdComment.Children, nil, nil),
-	}, nil
+	r.comments.Publish(createdComment.PostID.String(), createdComment)
+	return convertComment(createdComment, nil, nil), nil
 }
 
 // GetPost is the resolver for the getPost field.
 func (r *queryResolver) GetPost(ctx context.Context, id string, commentPage *int, commentLimit *int) (*model.Post, error) {
 	if id == "" {
-		return nil, fmt.Errorf("post ID cannot be empty")
+		return nil, domain.NewValidationError("id", "post ID cannot be empty")
 	}
 	uuidID, err := uuid.Parse(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid post ID format: %v", err)
+		return nil, domain.NewValidationError("id", fmt.Sprintf("invalid post ID format: %v", err))
 	}
 
 	limit := int32(10)
@@ -113,20 +107,21 @@ func (r *queryResolver) GetPost(ctx context.Context, id string, commentPage *int
 		page = int32(*commentPage)
 	}
 	if page <= 0 {
-		return nil, fmt.Errorf("comment page must be greater than 0")
+		return nil, domain.NewValidationError("commentPage", "comment page must be greater than 0")
 	}
 	if limit <= 0 {
-		return nil, fmt.Errorf("comment limit must be greater than 0")
+		return nil, domain.NewValidationError("commentLimit", "comment limit must be greater than 0")
 	}
 
 	domainPost, err := r.postUsecase.GetPost(ctx, uuidID.String(), page, limit)
 	if err != nil {
-		return nil, fmt.Errorf("%v", err)
+		return nil, err
 	}
 	return &model.Post{
 		ID:            domainPost.ID.String(),
 		Text:          domainPost.Text,
 		AllowComments: domainPost.AllowComments,
+		CommentCount:  domainPost.CommentCount,
 		Comments:      convertComments(domainPost.Comments, nil, nil),
 	}, nil
 }
@@ -142,15 +137,15 @@ func (r *queryResolver) GetPosts(ctx context.Context, page *int, limit *int) ([]
 		pa = int32(*page)
 	}
 	if pa <= 0 {
-		return nil, fmt.Errorf("page must be greater than 0")
+		return nil, domain.NewValidationError("page", "page must be greater than 0")
 	}
 	if lim <= 0 {
-		return nil, fmt.Errorf("limit must be greater than 0")
+		return nil, domain.NewValidationError("limit", "limit must be greater than 0")
 	}
 
 	domainPosts, err := r.postUsecase.GetPosts(ctx, pa, lim)
 	if err != nil {
-		return nil, fmt.Errorf("%v", err)
+		return nil, err
 	}
 	var posts []*model.Post
 	for _, dp := range domainPosts {
@@ -158,6 +153,7 @@ func (r *queryResolver) GetPosts(ctx context.Context, page *int, limit *int) ([]
 			ID:            dp.ID.String(),
 			Text:          dp.Text,
 			AllowComments: dp.AllowComments,
+			CommentCount:  dp.CommentCount,
 			Comments:      convertComments(dp.Comments, nil, nil),
 		})
 	}
@@ -187,12 +183,13 @@ func convertComments(domainComments []*domain.Comment, page *int, limit *int) []
 			parentID = &parentIDStr
 		}
 		comments = append(comments, &model.Comment{
-			ID:        v.ID.String(),
-			Text:      v.Text,
-			PostID:    v.PostID.String(),
-			ParentID:  parentID,
-			CreatedAt: v.CreatedAt.Format(time.RFC3339),
-			Children:  convertComments(v.Children, page, limit),
+			ID:         v.ID.String(),
+			Text:       v.Text,
+			PostID:     v.PostID.String(),
+			ParentID:   parentID,
+			CreatedAt:  v.CreatedAt.Format(time.RFC3339),
+			ReplyCount: v.ReplyCount,
+			Children:   convertComments(v.Children, page, limit),
 		})
 	}
 	return comments
@@ -200,8 +197,33 @@ func convertComments(domainComments []*domain.Comment, page *int, limit *int) []
 
 // NewComment is the resolver for the newComment field.
 func (r *subscriptionResolver) NewComment(ctx context.Context, postID string) (<-chan *model.Comment, error) {
-
-	return nil, nil
+	if postID == "" {
+		return nil, domain.NewValidationError("postId", "post ID cannot be empty")
+	}
+	uuidPostID, err := uuid.Parse(postID)
+	if err != nil {
+		return nil, domain.NewValidationError("postId", fmt.Sprintf("invalid post ID format: %v", err))
+	}
+	if _, err := r.postUsecase.GetPost(ctx, uuidPostID.String(), 1, 1); err != nil {
+		return nil, err
+	}
+	// The channel is closed when the client unsubscribes or the server shuts down.
+	comments, err := r.comments.Subscribe(ctx, uuidPostID.String())
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *model.Comment)
+	go func() {
+		defer close(out)
+		for comment := range comments {
+			select {
+			case out <- convertComment(comment, nil, nil):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
 }
 
 func convertComment(domainComment *domain.Comment, page *int, limit *int) *model.Comment {
@@ -211,12 +233,13 @@ func convertComment(domainComment *domain.Comment, page *int, limit *int) *model
 		parentID = &parentIDStr
 	}
 	return &model.Comment{
-		ID:        domainComment.ID.String(),
-		Text:      domainComment.Text,
-		PostID:    domainComment.PostID.String(),
-		ParentID:  parentID,
-		CreatedAt: domainComment.CreatedAt.Format(time.RFC3339),
-		Children:  convertComments(domainComment.Children, page, limit),
+		ID:         domainComment.ID.String(),
+		Text:       domainComment.Text,
+		PostID:     domainComment.PostID.String(),
+		ParentID:   parentID,
+		CreatedAt:  domainComment.CreatedAt.Format(time.RFC3339),
+		ReplyCount: domainComment.ReplyCount,
+		Children:   convertComments(domainComment.Children, page, limit),
 	}
 }
 
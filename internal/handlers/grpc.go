@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	ozonv1 "OZON/api/ozon/v1"
+	"OZON/internal/domain"
+	"OZON/pkg/logging"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// grpcErrorDomain is the domain of the ErrorInfo details of gRPC errors.
+const grpcErrorDomain = "ozon"
+
+// grpcCodes maps the error codes to gRPC codes.
+var grpcCodes = map[string]codes.Code{
+	domain.CodeNotFound:         codes.NotFound,
+	domain.CodeValidation:       codes.InvalidArgument,
+	domain.CodeForbidden:        codes.PermissionDenied,
+	domain.CodeCommentsDisabled: codes.FailedPrecondition,
+	domain.CodeConflict:         codes.Aborted,
+	domain.CodeRateLimited:      codes.ResourceExhausted,
+	domain.CodeInternal:         codes.Internal,
+}
+
+// NewGRPCServer returns a gRPC server with the PostService and CommentService
+// of api/ozon/v1 over the usecases of resolver, for internal consumers. It
+// logs every call, takes the request ID from the x-request-id metadata, and
+// turns domain errors into statuses with the gRPC code of their kind and an
+// ErrorInfo whose reason is the GraphQL error code. In production mode
+// internal errors are reported without details, as by NewErrorPresenter.
+// Calls are not rate limited: the callers are trusted services. DeleteComment
+// and RebuildCounters are not authenticated either; unless admin is set they
+// fail with PermissionDenied.
+func NewGRPCServer(resolver *Resolver, production, admin bool, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unaryInterceptor(production)),
+		grpc.ChainStreamInterceptor(streamInterceptor(production)),
+	)
+	s := grpc.NewServer(opts...)
+	ozonv1.RegisterPostServiceServer(s, &grpcPosts{resolver: resolver})
+	ozonv1.RegisterCommentServiceServer(s, &grpcComments{resolver: resolver, admin: admin})
+	return s
+}
+
+func unaryInterceptor(production bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = withGRPCRequestID(ctx)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		err = grpcError(ctx, err, production)
+		slog.InfoContext(ctx, "grpc call",
+			"method", info.FullMethod, "code", status.Code(err).String(), slog.Duration("duration", time.Since(start)))
+		return resp, err
+	}
+}
+
+// streamInterceptor logs streams once, when they start, like GraphQL
+// subscriptions.
+func streamInterceptor(production bool) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := withGRPCRequestID(ss.Context())
+		slog.InfoContext(ctx, "grpc stream", "method", info.FullMethod)
+		return grpcError(ctx, handler(srv, &serverStream{ServerStream: ss, ctx: ctx}), production)
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// withGRPCRequestID gives the call an ID as RequestIDMiddleware does for HTTP
+// and sends it back in the response header.
+func withGRPCRequestID(ctx context.Context) context.Context {
+	var sent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(logging.Header); len(values) > 0 {
+			sent = values[0]
+		}
+	}
+	id := logging.NewRequestID(sent)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(logging.Header, id))
+	return logging.WithRequestID(ctx, id)
+}
+
+// grpcError returns the status of err.
+func grpcError(ctx context.Context, err error, production bool) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	code, known := domain.ErrorCode(err)
+	message := err.Error()
+	if !known {
+		slog.ErrorContext(ctx, "grpc call failed", "error", err)
+		if production {
+			message = internalErrorMessage
+		}
+	}
+	st := status.New(grpcCodes[code], message)
+
+	info := &errdetails.ErrorInfo{Reason: code, Domain: grpcErrorDomain}
+	details := []protoadapt.MessageV1{info}
+	var validationErr *domain.ValidationError
+	if errors.As(err, &validationErr) {
+		field := protoFieldName(validationErr.Field)
+		info.Metadata = map[string]string{"field": field}
+		details = append(details, &errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: validationErr.Message},
+		}})
+	}
+	var rateLimitErr *domain.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(rateLimitErr.RetryAfter)})
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+type grpcPosts struct {
+	ozonv1.UnimplementedPostServiceServer
+	resolver *Resolver
+}
+
+func (s *grpcPosts) GetPost(ctx context.Context, req *ozonv1.GetPostRequest) (*ozonv1.Post, error) {
+	post, err := s.resolver.postUsecase.GetPost(ctx, req.GetId(), orDefault(req.GetCommentPage(), 1), orDefault(req.GetCommentLimit(), defaultPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return toProtoPost(post), nil
+}
+
+func (s *grpcPosts) ListPosts(ctx context.Context, req *ozonv1.ListPostsRequest) (*ozonv1.ListPostsResponse, error) {
+	posts, err := s.resolver.postUsecase.GetPosts(ctx, orDefault(req.GetPage(), 1), orDefault(req.GetLimit(), defaultPageSize))
+	if err != nil {
+		return nil, err
+	}
+	resp := &ozonv1.ListPostsResponse{Posts: make([]*ozonv1.Post, 0, len(posts))}
+	for _, post := range posts {
+		resp.Posts = append(resp.Posts, toProtoPost(post))
+	}
+	return resp, nil
+}
+
+func (s *grpcPosts) CreatePost(ctx context.Context, req *ozonv1.CreatePostRequest) (*ozonv1.Post, error) {
+	post, err := s.resolver.postUsecase.CreatePost(ctx, req.GetText(), req.AllowComments)
+	if err != nil {
+		return nil, err
+	}
+	return toProtoPost(post), nil
+}
+
+func (s *grpcPosts) IsCommentsAllowed(ctx context.Context, req *ozonv1.IsCommentsAllowedRequest) (*ozonv1.IsCommentsAllowedResponse, error) {
+	allowed, err := s.resolver.postUsecase.IsCommentsAllowed(ctx, req.GetPostId())
+	if err != nil {
+		return nil, err
+	}
+	return &ozonv1.IsCommentsAllowedResponse{Allowed: allowed}, nil
+}
+
+type grpcComments struct {
+	ozonv1.UnimplementedCommentServiceServer
+	resolver *Resolver
+	// admin enables the methods that change data of other users.
+	admin bool
+}
+
+func (s *grpcComments) checkAdmin(method string) error {
+	if !s.admin {
+		return fmt.Errorf("%w: %s is disabled, enable grpc.admin to call it", domain.ErrForbidden, method)
+	}
+	return nil
+}
+
+func (s *grpcComments) CreateComment(ctx context.Context, req *ozonv1.CreateCommentRequest) (*ozonv1.Comment, error) {
+	postID, err := uuid.Parse(req.GetPostId())
+	if err != nil {
+		return nil, domain.NewValidationError("postId", fmt.Sprintf("invalid post ID format: %v", err))
+	}
+	comment := &domain.Comment{PostID: postID, Text: req.GetText()}
+	if req.ParentId != nil {
+		parentID, err := uuid.Parse(req.GetParentId())
+		if err != nil {
+			return nil, domain.NewValidationError("parentId", fmt.Sprintf("invalid parent ID format: %v", err))
+		}
+		comment.ParentID = &parentID
+	}
+
+	created, err := s.resolver.commentUsecase.CreateComment(ctx, comment)
+	if err != nil {
+		return nil, err
+	}
+	s.resolver.comments.Publish(created.PostID.String(), created)
+	return toProtoComment(created), nil
+}
+
+func (s *grpcComments) ListComments(ctx context.Context, req *ozonv1.ListCommentsRequest) (*ozonv1.ListCommentsResponse, error) {
+	comments, err := s.resolver.commentUsecase.GetCommentsForPost(ctx, req.GetPostId(), orDefault(req.GetPage(), 1), orDefault(req.GetLimit(), defaultPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return &ozonv1.ListCommentsResponse{Comments: toProtoComments(comments)}, nil
+}
+
+func (s *grpcComments) DeleteComment(ctx context.Context, req *ozonv1.DeleteCommentRequest) (*ozonv1.DeleteCommentResponse, error) {
+	if err := s.checkAdmin("DeleteComment"); err != nil {
+		return nil, err
+	}
+	if err := s.resolver.commentUsecase.DeleteComment(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	return &ozonv1.DeleteCommentResponse{}, nil
+}
+
+func (s *grpcComments) RebuildCounters(ctx context.Context, _ *ozonv1.RebuildCountersRequest) (*ozonv1.RebuildCountersResponse, error) {
+	if err := s.checkAdmin("RebuildCounters"); err != nil {
+		return nil, err
+	}
+	repaired, err := s.resolver.commentUsecase.RebuildCounters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ozonv1.RebuildCountersResponse{Repaired: repaired}, nil
+}
+
+// WatchComments forwards the comments the newComment subscription receives.
+func (s *grpcComments) WatchComments(req *ozonv1.WatchCommentsRequest, stream grpc.ServerStreamingServer[ozonv1.Comment]) error {
+	ctx := stream.Context()
+	postID, err := uuid.Parse(req.GetPostId())
+	if err != nil {
+		return domain.NewValidationError("postId", fmt.Sprintf("invalid post ID format: %v", err))
+	}
+	if _, err := s.resolver.postUsecase.GetPost(ctx, postID.String(), 1, 1); err != nil {
+		return err
+	}
+	comments, err := s.resolver.comments.Subscribe(ctx, postID.String())
+	if err != nil {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	// Headers are sent with the first message otherwise; clients should know
+	// at once that the subscription is active.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for comment := range comments {
+		if err := stream.Send(toProtoComment(comment)); err != nil {
+			return err
+		}
+	}
+	// The broker closes the channel when the call ends, when the client falls
+	// behind, or when the server shuts down.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return status.Error(codes.Unavailable, "comment stream ended, list the comments and watch again")
+}
+
+// protoFieldName turns the GraphQL name of a field, such as postId, into that
+// of the request message, post_id.
+func protoFieldName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			b.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func orDefault(v, def int32) int32 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func toProtoPost(post *domain.Post) *ozonv1.Post {
+	return &ozonv1.Post{
+		Id:            post.ID.String(),
+		Text:          post.Text,
+		AllowComments: post.AllowComments,
+		Comments:      toProtoComments(post.Comments),
+		CreatedAt:     protoTime(post.CreatedAt),
+		CommentCount:  int32(post.CommentCount),
+		UpdatedAt:     protoTime(post.UpdatedAt),
+	}
+}
+
+func toProtoComments(comments []*domain.Comment) []*ozonv1.Comment {
+	out := make([]*ozonv1.Comment, 0, len(comments))
+	for _, c := range comments {
+		out = append(out, toProtoComment(c))
+	}
+	return out
+}
+
+func toProtoComment(comment *domain.Comment) *ozonv1.Comment {
+	c := &ozonv1.Comment{
+		Id:         comment.ID.String(),
+		Text:       comment.Text,
+		PostId:     comment.PostID.String(),
+		CreatedAt:  protoTime(comment.CreatedAt),
+		DeletedAt:  protoTime(comment.DeletedAt),
+		Children:   toProtoComments(comment.Children),
+		ReplyCount: int32(comment.ReplyCount),
+	}
+	if comment.ParentID != nil {
+		parentID := comment.ParentID.String()
+		c.ParentId = &parentID
+	}
+	return c
+}
+
+func protoTime(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
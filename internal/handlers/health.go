@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readyTimeout bounds the storage check of a single readiness probe.
+const readyTimeout = 2 * time.Second
+
+// Health serves the liveness (/healthz) and readiness (/readyz) probes.
+type Health struct {
+	check      func(ctx context.Context) error
+	production bool
+	draining   atomic.Bool
+}
+
+// NewHealth returns probes that consult check, typically Storage.Check, for
+// readiness. In production mode the reason of a failed check is only logged.
+func NewHealth(check func(ctx context.Context) error, production bool) *Health {
+	return &Health{check: check, production: production}
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Live reports that the process is up and serving HTTP. It does not look at
+// the storage: restarting the server would not fix an unreachable database.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// Ready reports whether the server should receive traffic: it is not shutting
+// down and the storage is reachable with an up-to-date schema.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Error: "shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := h.check(ctx); err != nil {
+		slog.WarnContext(r.Context(), "readiness check failed", "error", err)
+		resp := healthResponse{Status: "unavailable"}
+		if !h.production {
+			resp.Error = err.Error()
+		}
+		writeHealth(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// Drain makes Ready fail from now on and then waits for delay, so that load
+// balancers notice the failing probe and stop sending new requests before the
+// server stops accepting them.
+func (h *Health) Drain(delay time.Duration) {
+	h.draining.Store(true)
+	time.Sleep(delay)
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
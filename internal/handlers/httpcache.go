@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	"OZON/internal/usecases"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPCache is a gqlgen extension that makes GET queries cacheable by clients
+// and CDNs. A query gets a weak ETag derived from its text, its variables and
+// the data version of each root field: the UpdatedAt of the post for getPost,
+// the feed version for getPosts; a response with data from a
+// cache that is older than that gets no ETag. A request whose If-None-Match
+// matches is answered with 304 Not Modified without running the query. A
+// successful query also gets a Cache-Control header from the @cacheControl
+// hints of the fields it selects. It only acts on requests that went through
+// HTTPCacheMiddleware.
+type HTTPCache struct {
+	posts  *usecases.PostUsecase
+	schema *ast.Schema
+}
+
+var (
+	_ graphql.HandlerExtension    = (*HTTPCache)(nil)
+	_ graphql.ResponseInterceptor = (*HTTPCache)(nil)
+)
+
+// NewHTTPCache returns the extension, reading data versions from posts.
+func NewHTTPCache(posts *usecases.PostUsecase) *HTTPCache {
+	return &HTTPCache{posts: posts}
+}
+
+func (*HTTPCache) ExtensionName() string {
+	return "HTTPCache"
+}
+
+func (c *HTTPCache) Validate(es graphql.ExecutableSchema) error {
+	c.schema = es.Schema()
+	return nil
+}
+
+func (c *HTTPCache) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	state, _ := ctx.Value(httpCacheKey{}).(*httpCacheState)
+	oc := graphql.GetOperationContext(ctx)
+	if state == nil || oc.Operation == nil || oc.Operation.Operation != ast.Query {
+		return next(ctx)
+	}
+
+	cacheControl := c.cacheControl(oc.Operation.SelectionSet)
+	etag, versioned := c.etag(ctx, oc)
+	if versioned && etagMatches(state.ifNoneMatch, etag) {
+		state.etag, state.cacheControl, state.notModified = etag, cacheControl, true
+		return &graphql.Response{Data: []byte("null")}
+	}
+
+	ctx, reads := repository.WithCachedReads(ctx)
+	resp := next(ctx)
+	// Errors may be transient; neither they nor a validator for them should
+	// be cached.
+	if len(resp.Errors) == 0 {
+		if versioned && c.fresh(ctx, reads) {
+			state.etag = etag
+		}
+		state.cacheControl = cacheControl
+	}
+	return resp
+}
+
+// etag returns the ETag of a query, or false if a root field has no known
+// data version. The version is read before the query runs, so a change in
+// between labels the newer data with the older version; the next request
+// then gets the full response again. The data itself may come from a cache
+// that lags behind the version, which fresh checks once the query has run.
+func (c *HTTPCache) etag(ctx context.Context, oc *graphql.OperationContext) (string, bool) {
+	h := sha256.New()
+	variables, err := json.Marshal(oc.Variables)
+	if err != nil {
+		return "", false
+	}
+	fmt.Fprintf(h, "%s\x00%s\x00%s", oc.RawQuery, oc.OperationName, variables)
+
+	for _, field := range graphql.CollectFields(oc, oc.Operation.SelectionSet, []string{"Query"}) {
+		var (
+			postID  string
+			version int64
+			err     error
+		)
+		switch field.Name {
+		case "__typename":
+			continue
+		case "getPost":
+			postID, _ = field.ArgumentMap(oc.Variables)["id"].(string)
+			if postID == "" {
+				return "", false
+			}
+			var modified time.Time
+			modified, err = c.posts.LastModified(ctx, postID)
+			version = modified.UnixNano()
+		case "getPosts":
+			version, err = c.posts.FeedVersion(ctx)
+		default:
+			return "", false
+		}
+		if err != nil {
+			// A missing post or an invalid ID is reported by the query itself.
+			if _, known := domain.ErrorCode(err); !known {
+				slog.WarnContext(ctx, "failed to get data version", "field", field.Name, "error", err)
+			}
+			return "", false
+		}
+		fmt.Fprintf(h, "\x00%s:%s:%d", field.Name, postID, version)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, true
+}
+
+// fresh reports whether every post the query read from a cache was served at
+// its current version. A stale response must not get the ETag of the current
+// data, or clients would revalidate it with 304 until the cache expires.
+func (c *HTTPCache) fresh(ctx context.Context, reads *repository.CachedReads) bool {
+	for postID, served := range reads.Versions() {
+		modified, err := c.posts.LastModified(ctx, postID.String())
+		if err != nil || modified.After(served) {
+			return false
+		}
+	}
+	return true
+}
+
+// etagMatches compares the entity tags of If-None-Match with etag; weakly, as
+// RFC 9110 requires for this header.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl returns the Cache-Control header of a query: the smallest
+// maxAge of its fields, each taken from @cacheControl on the field or else on
+// the type it returns. Root fields and object fields without a hint forbid
+// caching, other fields inherit the hint of their parent. A PRIVATE scope on
+// any field keeps the response out of shared caches. Responses that must not
+// be reused are still stored, to be revalidated with their ETag.
+func (c *HTTPCache) cacheControl(selection ast.SelectionSet) string {
+	maxAge, private := math.MaxInt, false
+	c.collectHints(selection, true, &maxAge, &private)
+	if maxAge == math.MaxInt || maxAge <= 0 {
+		return "no-cache"
+	}
+	scope := "public"
+	if private {
+		scope = "private"
+	}
+	return scope + ", max-age=" + strconv.Itoa(maxAge)
+}
+
+func (c *HTTPCache) collectHints(selection ast.SelectionSet, root bool, maxAge *int, private *bool) {
+	for _, sel := range selection {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if sel.Definition == nil {
+				continue
+			}
+			typ := c.schema.Types[sel.Definition.Type.Name()]
+			age, hasAge, isPrivate := cacheHint(sel.Definition.Directives)
+			if !hasAge && typ != nil {
+				var typePrivate bool
+				age, hasAge, typePrivate = cacheHint(typ.Directives)
+				isPrivate = isPrivate || typePrivate
+			}
+			switch {
+			case hasAge:
+				*maxAge = min(*maxAge, age)
+			case root || (typ != nil && typ.IsCompositeType()):
+				*maxAge = 0
+			}
+			*private = *private || isPrivate
+			c.collectHints(sel.SelectionSet, false, maxAge, private)
+		case *ast.InlineFragment:
+			c.collectHints(sel.SelectionSet, root, maxAge, private)
+		case *ast.FragmentSpread:
+			if sel.Definition != nil {
+				c.collectHints(sel.Definition.SelectionSet, root, maxAge, private)
+			}
+		}
+	}
+}
+
+// cacheHint reads the arguments of @cacheControl from directives.
+func cacheHint(directives ast.DirectiveList) (maxAge int, hasMaxAge, private bool) {
+	d := directives.ForName("cacheControl")
+	if d == nil {
+		return 0, false, false
+	}
+	if arg := d.Arguments.ForName("maxAge"); arg != nil && arg.Value != nil {
+		if n, err := strconv.Atoi(arg.Value.Raw); err == nil {
+			maxAge, hasMaxAge = n, true
+		}
+	}
+	if arg := d.Arguments.ForName("scope"); arg != nil && arg.Value != nil {
+		private = arg.Value.Raw == "PRIVATE"
+	}
+	return maxAge, hasMaxAge, private
+}
+
+type httpCacheKey struct{}
+
+// httpCacheState carries the request validator to HTTPCache and the headers it
+// chose back to the middleware.
+type httpCacheState struct {
+	ifNoneMatch  string
+	etag         string
+	cacheControl string
+	notModified  bool
+}
+
+// HTTPCacheMiddleware lets HTTPCache answer GET requests: it hands
+// If-None-Match to the extension and writes the ETag and Cache-Control headers
+// the extension chose, or 304 Not Modified without a body. Other methods and
+// websocket upgrades pass through unchanged.
+func HTTPCacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		state := &httpCacheState{ifNoneMatch: r.Header.Get("If-None-Match")}
+		ctx := context.WithValue(r.Context(), httpCacheKey{}, state)
+		next.ServeHTTP(&httpCacheWriter{ResponseWriter: w, state: state}, r.WithContext(ctx))
+	})
+}
+
+// httpCacheWriter adds the headers of the state when the response starts.
+type httpCacheWriter struct {
+	http.ResponseWriter
+	state       *httpCacheState
+	wroteHeader bool
+}
+
+func (w *httpCacheWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK {
+		h := w.Header()
+		if w.state.etag != "" {
+			h.Set("ETag", w.state.etag)
+		}
+		if w.state.cacheControl != "" {
+			h.Set("Cache-Control", w.state.cacheControl)
+		}
+		if w.state.notModified {
+			h.Del("Content-Type")
+			code = http.StatusNotModified
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *httpCacheWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.state.notModified {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *httpCacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"OZON/pkg/logging"
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"log/slog"
+	"time"
+)
+
+// OperationLogger is a gqlgen extension that logs every GraphQL operation
+// with its name, type and redacted variables. Queries and mutations are
+// logged when they complete, with their duration and error count, including
+// those rejected before execution; subscriptions are logged once, when they
+// start, rather than for every event.
+type OperationLogger struct{}
+
+var (
+	_ graphql.HandlerExtension     = OperationLogger{}
+	_ graphql.OperationInterceptor = OperationLogger{}
+	_ graphql.ResponseInterceptor  = OperationLogger{}
+)
+
+func (OperationLogger) ExtensionName() string {
+	return "OperationLogger"
+}
+
+func (OperationLogger) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (OperationLogger) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	if oc := graphql.GetOperationContext(ctx); isSubscription(oc) {
+		slog.InfoContext(ctx, "graphql subscription", operationAttrs(oc)...)
+	}
+	return next(ctx)
+}
+
+func (OperationLogger) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if !graphql.HasOperationContext(ctx) {
+		return resp
+	}
+	oc := graphql.GetOperationContext(ctx)
+	if isSubscription(oc) {
+		return resp
+	}
+
+	attrs := operationAttrs(oc)
+	if !oc.Stats.OperationStart.IsZero() {
+		attrs = append(attrs, slog.Duration("duration", time.Since(oc.Stats.OperationStart)))
+	}
+	errCount := 0
+	if resp != nil {
+		errCount = len(resp.Errors)
+	}
+	slog.InfoContext(ctx, "graphql operation", append(attrs, slog.Int("errors", errCount))...)
+	return resp
+}
+
+func isSubscription(oc *graphql.OperationContext) bool {
+	return oc.Operation != nil && oc.Operation.Operation == ast.Subscription
+}
+
+func operationAttrs(oc *graphql.OperationContext) []any {
+	// Clients may name the operation in the document only.
+	name := oc.OperationName
+	if name == "" && oc.Operation != nil {
+		name = oc.Operation.Name
+	}
+	attrs := []any{slog.String("operation", name)}
+	if oc.Operation != nil {
+		attrs = append(attrs, slog.String("type", string(oc.Operation.Operation)))
+	}
+	return append(attrs, slog.Any("variables", logging.RedactVariables(oc.Variables, sensitiveVariables(oc))))
+}
+
+// sensitiveVariables returns the variables the operation passes to sensitive
+// arguments or input fields, whatever their names. Without a valid operation
+// their use is unknown, so all of them are.
+func sensitiveVariables(oc *graphql.OperationContext) map[string]bool {
+	sensitive := make(map[string]bool)
+	if oc.Operation == nil {
+		for name := range oc.Variables {
+			sensitive[name] = true
+		}
+		return sensitive
+	}
+	visited := make(map[string]bool)
+	var walk func(set ast.SelectionSet)
+	walk = func(set ast.SelectionSet) {
+		for _, sel := range set {
+			switch sel := sel.(type) {
+			case *ast.Field:
+				for _, arg := range sel.Arguments {
+					markVariables(arg.Name, arg.Value, sensitive)
+				}
+				walk(sel.SelectionSet)
+			case *ast.InlineFragment:
+				walk(sel.SelectionSet)
+			case *ast.FragmentSpread:
+				if sel.Definition != nil && !visited[sel.Name] {
+					visited[sel.Name] = true
+					walk(sel.Definition.SelectionSet)
+				}
+			}
+		}
+	}
+	walk(oc.Operation.SelectionSet)
+	return sensitive
+}
+
+// markVariables marks the variables in the value of a sensitive argument or
+// input field, and looks for sensitive fields in the other values.
+func markVariables(name string, value *ast.Value, sensitive map[string]bool) {
+	if value == nil {
+		return
+	}
+	if value.Kind == ast.Variable {
+		if logging.Sensitive(name) {
+			sensitive[value.Raw] = true
+		}
+		return
+	}
+	for _, child := range value.Children {
+		childName := name
+		if value.Kind == ast.ObjectValue {
+			childName = child.Name
+		}
+		markVariables(childName, child.Value, sensitive)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"OZON/pkg/persisted"
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"log/slog"
+)
+
+const (
+	codePersistedQueryNotFound = "PERSISTED_QUERY_NOT_FOUND"
+	codeQueryNotAllowed        = "QUERY_NOT_ALLOWED"
+)
+
+// Allowlist is a gqlgen extension that executes only the operations of a
+// manifest. Clients may send an operation by its APQ hash or in full; a full
+// query is accepted only if its text is exactly that of the manifest. It
+// replaces AutomaticPersistedQuery, since clients must not register queries.
+type Allowlist struct {
+	manifest *persisted.Manifest
+}
+
+var (
+	_ graphql.HandlerExtension          = Allowlist{}
+	_ graphql.OperationParameterMutator = Allowlist{}
+)
+
+// NewAllowlist returns the extension for the operations of manifest.
+func NewAllowlist(manifest *persisted.Manifest) Allowlist {
+	return Allowlist{manifest: manifest}
+}
+
+func (Allowlist) ExtensionName() string {
+	return "Allowlist"
+}
+
+func (Allowlist) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (a Allowlist) MutateOperationParameters(ctx context.Context, params *graphql.RawParams) *gqlerror.Error {
+	if params.Query == "" {
+		hash := persistedQueryHash(params.Extensions)
+		if hash == "" {
+			// gqlgen reports the missing query itself.
+			return nil
+		}
+		query, ok := a.manifest.Lookup(hash)
+		if !ok {
+			err := gqlerror.Errorf("PersistedQueryNotFound")
+			errcode.Set(err, codePersistedQueryNotFound)
+			return err
+		}
+		params.Query = query
+		return nil
+	}
+
+	if _, ok := a.manifest.Lookup(persisted.Hash(params.Query)); !ok {
+		// Usually a frontend deployed without its manifest.
+		slog.WarnContext(ctx, "query not in the allowlist", "operation", params.OperationName)
+		err := gqlerror.Errorf("query is not in the allowlist")
+		errcode.Set(err, codeQueryNotAllowed)
+		return err
+	}
+	return nil
+}
+
+// persistedQueryHash returns the sha256Hash of the persistedQuery extension.
+func persistedQueryHash(extensions map[string]interface{}) string {
+	pq, _ := extensions["persistedQuery"].(map[string]interface{})
+	hash, _ := pq["sha256Hash"].(string)
+	return hash
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"OZON/internal/domain"
+	"OZON/pkg/ratelimit"
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"log/slog"
+)
+
+// RateLimit is a gqlgen extension that charges every mutation to the budget
+// the caller has for it. Each mutation field has its own limit and bucket;
+// fields without a limit are not counted. A call over budget fails with a
+// RateLimitError before its resolver runs.
+type RateLimit struct {
+	store  ratelimit.Store
+	limits map[string]ratelimit.Limit
+}
+
+var (
+	_ graphql.HandlerExtension = RateLimit{}
+	_ graphql.FieldInterceptor = RateLimit{}
+)
+
+// NewRateLimit returns the extension; limits is keyed by mutation field name,
+// such as createPost.
+func NewRateLimit(store ratelimit.Store, limits map[string]ratelimit.Limit) RateLimit {
+	return RateLimit{store: store, limits: limits}
+}
+
+func (RateLimit) ExtensionName() string {
+	return "RateLimit"
+}
+
+func (RateLimit) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (l RateLimit) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Object != "Mutation" {
+		return next(ctx)
+	}
+	if err := l.take(ctx, fc.Field.Name); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+// take charges a call of mutation to the budget of the caller. The REST API
+// charges its writes to the budget of the matching mutation, so that clients
+// share one budget whichever API they use.
+func (l RateLimit) take(ctx context.Context, mutation string) error {
+	limit := l.limits[mutation]
+	if l.store == nil || limit.Unlimited() {
+		return nil
+	}
+
+	ok, retryAfter, err := l.store.Take(ctx, ratelimit.Subject(ctx)+"|"+mutation, limit)
+	if err != nil {
+		// Rejecting every mutation while the store is unreachable would turn a
+		// limiter outage into a full outage.
+		slog.ErrorContext(ctx, "rate limit check failed", "mutation", mutation, "error", err)
+		return nil
+	}
+	if !ok {
+		return domain.NewRateLimitError(retryAfter)
+	}
+	return nil
+}
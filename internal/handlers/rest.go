@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"OZON/internal/domain"
+	"OZON/pkg/openapi"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPageSize is the page size of REST and gRPC lists when the client
+	// sets no limit, the same as in the GraphQL API.
+	defaultPageSize = 10
+	// maxRESTBody bounds request bodies; the longest valid one, a post, is
+	// about 10 KB.
+	maxRESTBody = 1 << 20
+)
+
+// REST serves a JSON API over the same usecases as the GraphQL API, for
+// clients that cannot use GraphQL. Errors carry the codes of the GraphQL
+// error extensions. Its OpenAPI spec is generated from the route table and
+// served at /api/openapi.json.
+type REST struct {
+	resolver   *Resolver
+	limits     RateLimit
+	production bool
+	mux        *http.ServeMux
+	spec       []byte
+}
+
+// NewREST returns the API of resolver. Writes are charged to the budgets of
+// limits for createPost and createComment; a zero RateLimit disables them. In
+// production mode internal errors are reported without details, as by
+// NewErrorPresenter.
+func NewREST(resolver *Resolver, limits RateLimit, production bool) *REST {
+	a := &REST{resolver: resolver, limits: limits, production: production, mux: http.NewServeMux()}
+	gen := openapi.NewGenerator(openapi.Info{
+		Title:       "OZON posts API",
+		Version:     "1.0.0",
+		Description: "Posts and comment threads. Errors use the codes of the GraphQL API.",
+	})
+	gen.Name = func(t reflect.Type) string {
+		name := strings.TrimPrefix(t.Name(), "rest")
+		return strings.ToUpper(name[:1]) + name[1:]
+	}
+
+	for _, route := range a.routes() {
+		a.mux.HandleFunc(route.method+" "+route.path, func(w http.ResponseWriter, r *http.Request) {
+			a.serve(w, r, route)
+		})
+		gen.Add(route.method, route.path, route.operation(gen))
+	}
+	a.mux.HandleFunc("GET /api/openapi.json", a.serveSpec)
+	a.mux.HandleFunc("/api/", a.notFound)
+
+	spec, err := json.MarshalIndent(gen.Document(), "", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode the OpenAPI spec: %v", err))
+	}
+	a.spec = spec
+	return a
+}
+
+func (a *REST) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// restRoute is an endpoint of the API. The spec is derived from its
+// parameters and from the types of request and response.
+type restRoute struct {
+	method, path string
+	id, summary  string
+	params       []openapi.Parameter
+	// request is the type of the body, nil for none.
+	request any
+	// response is the type of the body of a success, sent with status.
+	response any
+	status   int
+	// mutation is the GraphQL mutation whose rate limit applies, if any.
+	mutation string
+	handle   func(r *http.Request) (any, error)
+}
+
+func (a *REST) routes() []restRoute {
+	one := 1.0
+	postID := openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}}
+	page := []openapi.Parameter{
+		{Name: "limit", In: "query", Description: "Page size, 10 by default. Ignored with a cursor.",
+			Schema: &openapi.Schema{Type: "integer", Format: "int32", Minimum: &one}},
+		{Name: "cursor", In: "query", Description: "The nextCursor of the previous page.",
+			Schema: &openapi.Schema{Type: "string"}},
+	}
+
+	return []restRoute{
+		{
+			method: http.MethodGet, path: "/api/posts", id: "listPosts",
+			summary: "List posts, oldest first", params: page,
+			response: restPostPage{}, status: http.StatusOK,
+			handle: a.listPosts,
+		},
+		{
+			method: http.MethodPost, path: "/api/posts", id: "createPost",
+			summary: "Create a post", request: restCreatePost{},
+			response: restPost{}, status: http.StatusCreated, mutation: "createPost",
+			handle: a.createPost,
+		},
+		{
+			method: http.MethodGet, path: "/api/posts/{id}", id: "getPost",
+			summary: "Get a post", params: []openapi.Parameter{postID},
+			response: restPost{}, status: http.StatusOK,
+			handle: a.getPost,
+		},
+		{
+			method: http.MethodGet, path: "/api/posts/{id}/comments", id: "listComments",
+			summary:  "List the threads of a post: its top-level comments, oldest first, with all their replies",
+			params:   append([]openapi.Parameter{postID}, page...),
+			response: restCommentPage{}, status: http.StatusOK,
+			handle: a.listComments,
+		},
+		{
+			method: http.MethodPost, path: "/api/posts/{id}/comments", id: "createComment",
+			summary: "Comment on a post or reply to a comment", params: []openapi.Parameter{postID},
+			request: restCreateComment{}, response: restComment{}, status: http.StatusCreated, mutation: "createComment",
+			handle: a.createComment,
+		},
+	}
+}
+
+type restPost struct {
+	ID            string    `json:"id" doc:"UUID of the post"`
+	Text          string    `json:"text"`
+	AllowComments bool      `json:"allowComments"`
+	CommentCount  int       `json:"commentCount" doc:"Number of comments that are not deleted, replies included"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type restComment struct {
+	ID         string        `json:"id" doc:"UUID of the comment"`
+	Text       string        `json:"text"`
+	PostID     string        `json:"postId"`
+	ParentID   *string       `json:"parentId" doc:"The comment this one replies to; null for a top-level comment"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	ReplyCount int           `json:"replyCount" doc:"Number of direct replies that are not deleted"`
+	Children   []restComment `json:"children" doc:"Replies, oldest first"`
+}
+
+type restPostPage struct {
+	Posts      []restPost `json:"posts"`
+	NextCursor string     `json:"nextCursor,omitempty" doc:"Cursor of the next page; absent on the last one"`
+}
+
+type restCommentPage struct {
+	Comments   []restComment `json:"comments"`
+	NextCursor string        `json:"nextCursor,omitempty" doc:"Cursor of the next page; absent on the last one"`
+}
+
+type restCreatePost struct {
+	Text          string `json:"text" doc:"Up to 10000 bytes"`
+	AllowComments *bool  `json:"allowComments,omitempty" doc:"true by default"`
+}
+
+type restCreateComment struct {
+	Text     string  `json:"text" doc:"Up to 2000 bytes"`
+	ParentID *string `json:"parentId,omitempty" doc:"The comment to reply to"`
+}
+
+type restError struct {
+	Error restErrorBody `json:"error"`
+}
+
+type restErrorBody struct {
+	Code       string `json:"code" enum:"NOT_FOUND,BAD_USER_INPUT,FORBIDDEN,COMMENTS_DISABLED,CONFLICT,RATE_LIMITED,INTERNAL_SERVER_ERROR"`
+	Message    string `json:"message"`
+	Field      string `json:"field,omitempty" doc:"The invalid parameter, for BAD_USER_INPUT"`
+	RetryAfter int    `json:"retryAfter,omitempty" doc:"Seconds until the call is accepted, for RATE_LIMITED"`
+}
+
+func (a *REST) listPosts(r *http.Request) (any, error) {
+	page, limit, err := restPage(r)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := a.resolver.postUsecase.GetPosts(r.Context(), page, limit)
+	if err != nil {
+		return nil, err
+	}
+	resp := restPostPage{Posts: make([]restPost, 0, len(posts))}
+	for _, post := range posts {
+		resp.Posts = append(resp.Posts, toRESTPost(post))
+	}
+	resp.NextCursor = nextCursor(len(posts), page, limit)
+	return resp, nil
+}
+
+func (a *REST) createPost(r *http.Request) (any, error) {
+	var req restCreatePost
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	post, err := a.resolver.postUsecase.CreatePost(r.Context(), req.Text, req.AllowComments)
+	if err != nil {
+		return nil, err
+	}
+	return toRESTPost(post), nil
+}
+
+func (a *REST) getPost(r *http.Request) (any, error) {
+	// The limit of the GraphQL default shares its cache entries.
+	post, err := a.resolver.postUsecase.GetPost(r.Context(), r.PathValue("id"), 1, defaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return toRESTPost(post), nil
+}
+
+func (a *REST) listComments(r *http.Request) (any, error) {
+	page, limit, err := restPage(r)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := a.resolver.commentUsecase.GetCommentsForPost(r.Context(), r.PathValue("id"), page, limit)
+	if err != nil {
+		return nil, err
+	}
+	resp := restCommentPage{Comments: toRESTComments(comments), NextCursor: nextCursor(len(comments), page, limit)}
+	return resp, nil
+}
+
+func (a *REST) createComment(r *http.Request) (any, error) {
+	var req restCreateComment
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, domain.NewValidationError("id", fmt.Sprintf("invalid post ID format: %v", err))
+	}
+	comment := &domain.Comment{PostID: postID, Text: req.Text}
+	if req.ParentID != nil {
+		parentID, err := uuid.Parse(*req.ParentID)
+		if err != nil {
+			return nil, domain.NewValidationError("parentId", fmt.Sprintf("invalid parent ID format: %v", err))
+		}
+		comment.ParentID = &parentID
+	}
+
+	created, err := a.resolver.commentUsecase.CreateComment(r.Context(), comment)
+	if err != nil {
+		return nil, err
+	}
+	// newComment subscribers see comments from either API.
+	a.resolver.comments.Publish(created.PostID.String(), created)
+	return toRESTComment(created), nil
+}
+
+// restPage returns the page to read: that of the cursor, or the first one
+// with the limit of the query.
+func restPage(r *http.Request) (page, limit int32, err error) {
+	query := r.URL.Query()
+	if cursor := query.Get("cursor"); cursor != "" {
+		page, limit, ok := decodeCursor(cursor)
+		if !ok {
+			return 0, 0, domain.NewValidationError("cursor", "invalid cursor")
+		}
+		return page, limit, nil
+	}
+	limit = defaultPageSize
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || n <= 0 {
+			return 0, 0, domain.NewValidationError("limit", "limit must be a positive integer")
+		}
+		limit = int32(n)
+	}
+	return 1, limit, nil
+}
+
+// Cursors are opaque to clients. They hold the page after the one returned
+// and its limit, so that every page of a listing has the same size.
+func encodeCursor(page, limit int32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", page, limit)))
+}
+
+func decodeCursor(cursor string) (page, limit int32, ok bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, false
+	}
+	p, l, found := strings.Cut(string(raw), ":")
+	pn, perr := strconv.ParseInt(p, 10, 32)
+	ln, lerr := strconv.ParseInt(l, 10, 32)
+	if !found || perr != nil || lerr != nil || pn <= 0 || ln <= 0 {
+		return 0, 0, false
+	}
+	return int32(pn), int32(ln), true
+}
+
+// nextCursor returns the cursor after a page of n items, or "" when the page
+// was not full. A full last page is followed by an empty one.
+func nextCursor(n int, page, limit int32) string {
+	if n < int(limit) {
+		return ""
+	}
+	return encodeCursor(page+1, limit)
+}
+
+func decodeBody(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return domain.NewValidationError("", "request body too large")
+		}
+		return domain.NewValidationError("", fmt.Sprintf("invalid JSON body: %v", err))
+	}
+	return nil
+}
+
+func toRESTPost(post *domain.Post) restPost {
+	p := restPost{
+		ID:            post.ID.String(),
+		Text:          post.Text,
+		AllowComments: post.AllowComments,
+		CommentCount:  post.CommentCount,
+	}
+	if post.CreatedAt != nil {
+		p.CreatedAt = *post.CreatedAt
+	}
+	return p
+}
+
+func toRESTComments(comments []*domain.Comment) []restComment {
+	out := make([]restComment, 0, len(comments))
+	for _, c := range comments {
+		out = append(out, toRESTComment(c))
+	}
+	return out
+}
+
+func toRESTComment(comment *domain.Comment) restComment {
+	c := restComment{
+		ID:         comment.ID.String(),
+		Text:       comment.Text,
+		PostID:     comment.PostID.String(),
+		ReplyCount: comment.ReplyCount,
+		Children:   toRESTComments(comment.Children),
+	}
+	if comment.ParentID != nil {
+		parentID := comment.ParentID.String()
+		c.ParentID = &parentID
+	}
+	if comment.CreatedAt != nil {
+		c.CreatedAt = *comment.CreatedAt
+	}
+	return c
+}
+
+func (a *REST) serve(w http.ResponseWriter, r *http.Request, route restRoute) {
+	// The HTTP span is named before routing; name it after the route.
+	span := trace.SpanFromContext(r.Context())
+	span.SetName(route.method + " " + route.path)
+	span.SetAttributes(attribute.String("http.route", route.path))
+
+	if route.mutation != "" {
+		if err := a.limits.take(r.Context(), route.mutation); err != nil {
+			a.writeError(w, r, err)
+			return
+		}
+	}
+	if route.request != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRESTBody)
+	}
+	resp, err := route.handle(r)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, route.status, resp)
+}
+
+// notFound answers requests that match no route, with 405 if the path has
+// routes for other methods.
+func (a *REST) notFound(w http.ResponseWriter, r *http.Request) {
+	var allow []string
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := a.mux.Handler(probe); pattern != "/api/" {
+			allow = append(allow, method)
+		}
+	}
+	if len(allow) == 0 {
+		a.writeError(w, r, domain.NewNotFoundError("no such endpoint"))
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, restError{Error: restErrorBody{
+		Code:    domain.CodeValidation,
+		Message: "method " + r.Method + " is not allowed, use " + strings.Join(allow, " or "),
+	}})
+}
+
+func (a *REST) serveSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(a.spec)
+}
+
+// restStatus maps the error codes to HTTP statuses.
+var restStatus = map[string]int{
+	domain.CodeNotFound:         http.StatusNotFound,
+	domain.CodeValidation:       http.StatusBadRequest,
+	domain.CodeForbidden:        http.StatusForbidden,
+	domain.CodeCommentsDisabled: http.StatusForbidden,
+	domain.CodeConflict:         http.StatusConflict,
+	domain.CodeRateLimited:      http.StatusTooManyRequests,
+	domain.CodeInternal:         http.StatusInternalServerError,
+}
+
+func (a *REST) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code, known := domain.ErrorCode(err)
+	body := restErrorBody{Code: code, Message: err.Error()}
+
+	var validationErr *domain.ValidationError
+	if errors.As(err, &validationErr) {
+		body.Field = validationErr.Field
+	}
+	var rateLimitErr *domain.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		body.RetryAfter = rateLimitErr.RetryAfterSeconds()
+		w.Header().Set("Retry-After", strconv.Itoa(body.RetryAfter))
+	}
+	if !known {
+		slog.ErrorContext(r.Context(), "rest handler failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		if a.production {
+			body.Message = internalErrorMessage
+		}
+	}
+	writeJSON(w, restStatus[code], restError{Error: body})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// operation describes the route in the spec.
+func (route restRoute) operation(gen *openapi.Generator) openapi.Operation {
+	op := openapi.Operation{
+		OperationID: route.id,
+		Summary:     route.summary,
+		Parameters:  route.params,
+		Responses: map[string]openapi.Response{
+			strconv.Itoa(route.status): {Description: http.StatusText(route.status), Content: gen.JSON(route.response)},
+			"default":                  {Description: "An error", Content: gen.JSON(restError{})},
+		},
+	}
+	if route.request != nil {
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: gen.JSON(route.request)}
+	}
+	if route.mutation != "" {
+		op.Responses["429"] = openapi.Response{
+			Description: "Rate limited; shares the budget of the " + route.mutation + " mutation",
+			Headers: map[string]openapi.Header{
+				"Retry-After": {Description: "Seconds until the call is accepted", Schema: &openapi.Schema{Type: "integer"}},
+			},
+			Content: gen.JSON(restError{}),
+		}
+	}
+	return op
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"OZON/internal/domain"
+	"OZON/pkg/tracing"
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is a gqlgen extension that starts a span for every query and
+// mutation, named after the operation, and a child span for every field that
+// has a resolver. The spans continue the trace of the HTTP request. A
+// subscription only gets the span of its resolver: its events are not traced.
+type Tracer struct{}
+
+var (
+	_ graphql.HandlerExtension    = Tracer{}
+	_ graphql.ResponseInterceptor = Tracer{}
+	_ graphql.FieldInterceptor    = Tracer{}
+)
+
+func (Tracer) ExtensionName() string {
+	return "Tracer"
+}
+
+func (Tracer) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (Tracer) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	if !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+	oc := graphql.GetOperationContext(ctx)
+	if isSubscription(oc) {
+		return next(ctx)
+	}
+
+	// Operations rejected before execution have no parsed operation.
+	opType := "invalid"
+	name := oc.OperationName
+	if oc.Operation != nil {
+		opType = string(oc.Operation.Operation)
+		if name == "" {
+			name = oc.Operation.Name
+		}
+	}
+	spanName := opType
+	if name != "" {
+		spanName += " " + name
+	}
+	ctx, span := tracing.Start(ctx, spanName, trace.WithAttributes(
+		attribute.String("graphql.operation.type", opType),
+		attribute.String("graphql.operation.name", name),
+	))
+	defer span.End()
+
+	resp := next(ctx)
+	if resp == nil {
+		return resp
+	}
+	span.SetAttributes(attribute.Int("graphql.errors", len(resp.Errors)))
+	for _, err := range resp.Errors {
+		// The error presenter has set the code of resolver errors; errors
+		// without one are about the request itself.
+		if code, _ := err.Extensions["code"].(string); code == domain.CodeInternal {
+			span.SetStatus(codes.Error, err.Message)
+			break
+		}
+	}
+	return resp
+}
+
+func (Tracer) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+	ctx, span := tracing.Start(ctx, fc.Object+"."+fc.Field.Name, trace.WithAttributes(
+		attribute.String("graphql.field.path", fc.Path().String()),
+	))
+	res, err := next(ctx)
+	tracing.End(span, err, func(err error) bool {
+		_, ok := domain.ErrorCode(err)
+		return ok
+	})
+	return res, err
+}
@@ -0,0 +1,251 @@
+// Package loadgen produces synthetic load for performance work: data sets of
+// posts and comment trees created through the usecases, and a mix of GraphQL
+// operations replayed against a running server.
+package loadgen
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/usecases"
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+)
+
+// GenerateOptions describe the shape of a generated data set.
+type GenerateOptions struct {
+	Posts int
+	// Comments is the mean number of top-level comments per post.
+	Comments float64
+	// Branching is the mean number of direct replies per comment, drawn from
+	// a Poisson distribution; above 1 the threads grow until MaxDepth.
+	Branching float64
+	// MaxDepth is the deepest level of a reply, top-level comments being
+	// level 1.
+	MaxDepth int
+	// Skew is the Zipf exponent of post popularity: the top-level comments
+	// go to the post of popularity rank r with a weight of 1/r^Skew. Zero
+	// spreads them evenly.
+	Skew float64
+	// ClosedRatio is the share of posts closed for comments after their
+	// comments are created.
+	ClosedRatio float64
+	// Seed makes the data set reproducible but for the IDs and timestamps.
+	Seed uint64
+	// Workers is the number of posts generated at once.
+	Workers int
+	// Progress, if set, is called after each post with the totals so far.
+	Progress func(posts, comments int)
+}
+
+// Validate reports the first invalid option.
+func (o GenerateOptions) Validate() error {
+	switch {
+	case o.Posts <= 0:
+		return fmt.Errorf("posts must be positive, got %d", o.Posts)
+	case o.Comments < 0:
+		return fmt.Errorf("comments must not be negative, got %g", o.Comments)
+	case o.Branching < 0 || o.Branching > 10:
+		return fmt.Errorf("branching must be between 0 and 10, got %g", o.Branching)
+	case o.MaxDepth <= 0:
+		return fmt.Errorf("depth must be positive, got %d", o.MaxDepth)
+	case o.Skew < 0:
+		return fmt.Errorf("skew must not be negative, got %g", o.Skew)
+	case o.ClosedRatio < 0 || o.ClosedRatio > 1:
+		return fmt.Errorf("closed ratio must be between 0 and 1, got %g", o.ClosedRatio)
+	case o.Workers <= 0:
+		return fmt.Errorf("workers must be positive, got %d", o.Workers)
+	}
+	return nil
+}
+
+// GenerateResult describes a generated data set.
+type GenerateResult struct {
+	Posts    int
+	Comments int
+	// DeepestThread is the level of the deepest comment.
+	DeepestThread int
+	// BusiestComments is the number of comments of the busiest post.
+	BusiestComments int
+}
+
+// Generate creates the posts and comments through the usecases, so that they
+// pass the same validation and update the same counters and caches as the
+// API. The plan of every post is drawn up front from the seed, so the shape of
+// the data set does not depend on Workers.
+func Generate(ctx context.Context, posts *usecases.PostUsecase, comments *usecases.CommentUsecase, opts GenerateOptions) (GenerateResult, error) {
+	if err := opts.Validate(); err != nil {
+		return GenerateResult{}, err
+	}
+	rng := rand.New(rand.NewPCG(opts.Seed, 0))
+	roots := spread(rng, opts.Posts, int(math.Round(opts.Comments*float64(opts.Posts))), opts.Skew)
+	plans := make([]postPlan, opts.Posts)
+	for i := range plans {
+		plans[i] = postPlan{
+			roots:  roots[i],
+			closed: rng.Float64() < opts.ClosedRatio,
+			seed:   rng.Uint64(),
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		result   GenerateResult
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	next := make(chan postPlan)
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for plan := range next {
+				stats, err := generatePost(ctx, posts, comments, plan, opts)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				result.Posts += stats.Posts
+				result.Comments += stats.Comments
+				result.DeepestThread = max(result.DeepestThread, stats.DeepestThread)
+				result.BusiestComments = max(result.BusiestComments, stats.Comments)
+				if opts.Progress != nil && err == nil {
+					opts.Progress(result.Posts, result.Comments)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, plan := range plans {
+		select {
+		case next <- plan:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	// A failed post cancels the others; its error is the one reported.
+	if firstErr == nil {
+		firstErr = parent.Err()
+	}
+	return result, firstErr
+}
+
+type postPlan struct {
+	roots  int
+	closed bool
+	seed   uint64
+}
+
+type postStats struct {
+	Posts         int
+	Comments      int
+	DeepestThread int
+}
+
+func generatePost(ctx context.Context, posts *usecases.PostUsecase, comments *usecases.CommentUsecase, plan postPlan, opts GenerateOptions) (postStats, error) {
+	var stats postStats
+	rng := rand.New(rand.NewPCG(plan.seed, 1))
+	post, err := posts.CreatePost(ctx, text(rng, 40, 1000), nil)
+	if err != nil {
+		return stats, err
+	}
+	stats.Posts = 1
+
+	// Parents are created before their replies, breadth first.
+	type pending struct {
+		parent *domain.Comment
+		depth  int
+	}
+	queue := make([]pending, plan.roots)
+	for i := range queue {
+		queue[i] = pending{depth: 1}
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		comment := &domain.Comment{PostID: post.ID, Text: text(rng, 5, 400)}
+		if p.parent != nil {
+			comment.ParentID = &p.parent.ID
+		}
+		created, err := comments.CreateComment(ctx, comment)
+		if err != nil {
+			return stats, fmt.Errorf("failed to create comment on post %s: %w", post.ID, err)
+		}
+		stats.Comments++
+		stats.DeepestThread = max(stats.DeepestThread, p.depth)
+		if p.depth < opts.MaxDepth {
+			for n := poisson(rng, opts.Branching); n > 0; n-- {
+				queue = append(queue, pending{parent: created, depth: p.depth + 1})
+			}
+		}
+	}
+
+	if plan.closed {
+		if err := posts.SetCommentsAllowed(ctx, post.ID.String(), false); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// spread deals n items among buckets with Zipf weights over a random
+// popularity ranking; every bucket gets its expected share rounded down and
+// the remainder is drawn by weight.
+func spread(rng *rand.Rand, buckets, n int, skew float64) []int {
+	byRank := zipf(buckets, skew)
+	weights := make([]float64, buckets)
+	total := 0.0
+	for i, r := range rng.Perm(buckets) {
+		weights[i] = byRank[r]
+		total += weights[i]
+	}
+	counts := make([]int, buckets)
+	dealt := 0
+	for i, w := range weights {
+		counts[i] = int(float64(n) * w / total)
+		dealt += counts[i]
+	}
+	s := newSampler(weights)
+	for ; dealt < n; dealt++ {
+		counts[s.pick(rng)]++
+	}
+	return counts
+}
+
+// poisson draws from a Poisson distribution with Knuth's method, which is
+// fast enough for the small means of Branching.
+func poisson(rng *rand.Rand, mean float64) int {
+	limit, k, p := math.Exp(-mean), 0, rng.Float64()
+	for p > limit {
+		k++
+		p *= rng.Float64()
+	}
+	return k
+}
+
+var words = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod
+tempor incididunt ut labore et dolore magna aliqua пост комментарий ответ ветка лента сервер
+запрос кэш страница дерево глубина`)
+
+// text returns words up to a random length between minLen and maxLen bytes.
+func text(rng *rand.Rand, minLen, maxLen int) string {
+	target := minLen + rng.IntN(maxLen-minLen+1)
+	var b strings.Builder
+	for b.Len() < target {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(words[rng.IntN(len(words))])
+	}
+	return b.String()
+}
@@ -0,0 +1,479 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// Operations of a load test.
+const (
+	OpGetPosts      = "getPosts"
+	OpGetPost       = "getPost"
+	OpCreateComment = "createComment"
+)
+
+var operations = []string{OpGetPosts, OpGetPost, OpCreateComment}
+
+const (
+	getPostsQuery = `query($page: Int, $limit: Int) {
+  getPosts(page: $page, limit: $limit) { id text allowComments commentCount }
+}`
+	getPostQuery = `query($id: ID!) {
+  getPost(id: $id, commentPage: 1, commentLimit: 20) {
+    id text allowComments commentCount
+    comments { id text replyCount children(limit: 5) { id text replyCount } }
+  }
+}`
+	createCommentQuery = `mutation($postId: ID!, $text: String!, $parentId: ID) {
+  createComment(postId: $postId, text: $text, parentId: $parentId) { id }
+}`
+)
+
+// feedPageSize is the limit of the getPosts operations; discoverPosts is the
+// most posts a load test learns before it starts.
+const (
+	feedPageSize  = 10
+	discoverPosts = 1000
+)
+
+// Mix holds the relative weights of the operations of a load test.
+type Mix map[string]int
+
+// DefaultMix is a read-heavy mix.
+var DefaultMix = Mix{OpGetPosts: 30, OpGetPost: 60, OpCreateComment: 10}
+
+// ParseMix parses weights such as "getPosts=30,getPost=60,createComment=10";
+// the operations left out get no requests.
+func ParseMix(s string) (Mix, error) {
+	mix := make(Mix)
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mix entry %q, want OPERATION=WEIGHT", part)
+		}
+		if !isOperation(name) {
+			return nil, fmt.Errorf("unknown operation %q, want one of %s", name, strings.Join(operations, ", "))
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q of %s", value, name)
+		}
+		mix[name] = weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, errors.New("the mix has no weight")
+	}
+	return mix, nil
+}
+
+func isOperation(name string) bool {
+	for _, op := range operations {
+		if op == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadOptions configure LoadTest.
+type LoadOptions struct {
+	// URL is the GraphQL endpoint, such as http://localhost:8080/query.
+	URL         string
+	Duration    time.Duration
+	Concurrency int
+	// Rate is the number of requests per second of all workers together.
+	// Each request then has a scheduled send time, and its latency counts
+	// from that time, so that requests delayed by a slow server report the
+	// wait too. Zero sends each request as soon as the previous one of its
+	// worker is answered and counts from the send.
+	Rate float64
+	Mix  Mix
+	// Skew is the Zipf exponent of the popularity of posts and feed pages,
+	// newest first.
+	Skew   float64
+	Seed   uint64
+	Client *http.Client
+}
+
+// OpReport holds the results of one operation. The latencies are those of
+// the successful requests.
+type OpReport struct {
+	Op       string
+	Requests int
+	Errors   int
+	// FirstError is the first error returned, to tell what went wrong.
+	FirstError         string
+	P50, P90, P99, Max time.Duration
+}
+
+// LoadReport holds the results of a load test.
+type LoadReport struct {
+	Duration time.Duration
+	Ops      []OpReport
+}
+
+// Write writes the report as a table.
+func (r *LoadReport) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OPERATION\tREQUESTS\tERRORS\tRPS\tP50\tP90\tP99\tMAX\t")
+	for _, op := range r.Ops {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t\n", op.Op, op.Requests, op.Errors,
+			float64(op.Requests)/r.Duration.Seconds(), round(op.P50), round(op.P90), round(op.P99), round(op.Max))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, op := range r.Ops {
+		if op.FirstError != "" {
+			if _, err := fmt.Fprintf(w, "%s: first error: %s\n", op.Op, op.FirstError); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
+
+// LoadTest replays the operations of opts.Mix against a running server for
+// opts.Duration. The posts come from the first pages of the feed, and the
+// replies go to the comments seen in the getPost answers, so the server needs
+// data to start with, such as a data set of Generate.
+func LoadTest(ctx context.Context, opts LoadOptions) (*LoadReport, error) {
+	switch {
+	case opts.Duration <= 0:
+		return nil, fmt.Errorf("duration must be positive, got %s", opts.Duration)
+	case opts.Concurrency <= 0:
+		return nil, fmt.Errorf("concurrency must be positive, got %d", opts.Concurrency)
+	case opts.Rate < 0:
+		return nil, fmt.Errorf("rate must not be negative, got %g", opts.Rate)
+	case opts.Skew < 0:
+		return nil, fmt.Errorf("skew must not be negative, got %g", opts.Skew)
+	}
+	if opts.Mix == nil {
+		opts.Mix = DefaultMix
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	lt := &loadTest{opts: opts, comments: make(map[string][]string)}
+	if err := lt.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	var weights []float64
+	for _, op := range operations {
+		weights = append(weights, float64(opts.Mix[op]))
+	}
+	ops := newSampler(weights)
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+	start := time.Now()
+	var sched *schedule
+	if opts.Rate > 0 {
+		sched = newSchedule(start, opts.Rate)
+	}
+	results := make([]map[string]*opResult, opts.Concurrency)
+	var wg sync.WaitGroup
+	for w := range results {
+		results[w] = make(map[string]*opResult)
+		wg.Add(1)
+		go func(rng *rand.Rand, results map[string]*opResult) {
+			defer wg.Done()
+			for {
+				began := time.Now()
+				if sched != nil {
+					var ok bool
+					if began, ok = sched.wait(ctx); !ok {
+						return
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				op := operations[ops.pick(rng)]
+				err := lt.run(ctx, rng, op)
+				elapsed := time.Since(began)
+				if ctx.Err() != nil {
+					// Requests cut short by the end of the test are not counted.
+					return
+				}
+				res := results[op]
+				if res == nil {
+					res = &opResult{}
+					results[op] = res
+				}
+				if err != nil {
+					res.errors++
+					if res.firstErr == "" {
+						res.firstErr = err.Error()
+					}
+					continue
+				}
+				res.latencies = append(res.latencies, elapsed)
+			}
+		}(rand.New(rand.NewPCG(opts.Seed, uint64(w))), results[w])
+	}
+	wg.Wait()
+
+	report := &LoadReport{Duration: time.Since(start)}
+	for _, op := range operations {
+		if opts.Mix[op] == 0 {
+			continue
+		}
+		merged := &opResult{}
+		for _, res := range results {
+			if r := res[op]; r != nil {
+				merged.latencies = append(merged.latencies, r.latencies...)
+				merged.errors += r.errors
+				if merged.firstErr == "" {
+					merged.firstErr = r.firstErr
+				}
+			}
+		}
+		report.Ops = append(report.Ops, merged.report(op))
+	}
+	return report, nil
+}
+
+// schedule hands out the send times of an open-loop test: one every interval
+// from start, whether or not the server keeps up. Measuring from these times
+// rather than from the actual send keeps a slow server from hiding the time
+// requests spent waiting for a free worker (coordinated omission).
+type schedule struct {
+	start    time.Time
+	interval time.Duration
+	next     atomic.Int64
+}
+
+func newSchedule(start time.Time, rate float64) *schedule {
+	return &schedule{start: start, interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait claims the next send time and sleeps until it comes. It returns false
+// if ctx ends first.
+func (s *schedule) wait(ctx context.Context) (time.Time, bool) {
+	at := s.start.Add(time.Duration(s.next.Add(1)-1) * s.interval)
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return at, true
+	case <-ctx.Done():
+		return time.Time{}, false
+	}
+}
+
+type opResult struct {
+	latencies []time.Duration
+	errors    int
+	firstErr  string
+}
+
+func (r *opResult) report(op string) OpReport {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	report := OpReport{Op: op, Requests: len(r.latencies) + r.errors, Errors: r.errors, FirstError: r.firstErr}
+	if len(r.latencies) > 0 {
+		report.P50 = percentile(r.latencies, 50)
+		report.P90 = percentile(r.latencies, 90)
+		report.P99 = percentile(r.latencies, 99)
+		report.Max = r.latencies[len(r.latencies)-1]
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+type loadTest struct {
+	opts LoadOptions
+
+	// posts are the posts found by discover, newest first; open holds the
+	// indexes of those open for comments.
+	posts []feedPost
+	open  []int
+	// postSampler picks from posts, openSampler from open and pageSampler a
+	// page of the feed.
+	postSampler, openSampler, pageSampler *sampler
+
+	// comments holds the IDs of the comments seen so far by post, top-level
+	// comments and their first replies only, so that replies do not run into
+	// the depth limit.
+	mu       sync.Mutex
+	comments map[string][]string
+}
+
+type feedPost struct {
+	ID            string `json:"id"`
+	AllowComments bool   `json:"allowComments"`
+}
+
+func (lt *loadTest) discover(ctx context.Context) error {
+	for page := 1; len(lt.posts) < discoverPosts; page++ {
+		var data struct {
+			GetPosts []feedPost `json:"getPosts"`
+		}
+		if err := lt.do(ctx, getPostsQuery, map[string]interface{}{"page": page, "limit": 100}, &data); err != nil {
+			return fmt.Errorf("failed to list posts: %w", err)
+		}
+		lt.posts = append(lt.posts, data.GetPosts...)
+		if len(data.GetPosts) < 100 {
+			break
+		}
+	}
+	if len(lt.posts) == 0 {
+		return errors.New("the server has no posts; create some with the generate command first")
+	}
+	for i, post := range lt.posts {
+		if post.AllowComments {
+			lt.open = append(lt.open, i)
+		}
+	}
+	if len(lt.open) == 0 && lt.opts.Mix[OpCreateComment] > 0 {
+		return errors.New("no post is open for comments")
+	}
+	lt.postSampler = newSampler(zipf(len(lt.posts), lt.opts.Skew))
+	lt.openSampler = newSampler(zipf(len(lt.open), lt.opts.Skew))
+	lt.pageSampler = newSampler(zipf((len(lt.posts)+feedPageSize-1)/feedPageSize, lt.opts.Skew))
+	return nil
+}
+
+func (lt *loadTest) run(ctx context.Context, rng *rand.Rand, op string) error {
+	switch op {
+	case OpGetPosts:
+		page := lt.pageSampler.pick(rng) + 1
+		return lt.do(ctx, getPostsQuery, map[string]interface{}{"page": page, "limit": feedPageSize}, nil)
+	case OpGetPost:
+		id := lt.posts[lt.postSampler.pick(rng)].ID
+		var data struct {
+			GetPost *struct {
+				Comments []struct {
+					ID       string `json:"id"`
+					Children []struct {
+						ID string `json:"id"`
+					} `json:"children"`
+				} `json:"comments"`
+			} `json:"getPost"`
+		}
+		if err := lt.do(ctx, getPostQuery, map[string]interface{}{"id": id}, &data); err != nil {
+			return err
+		}
+		if data.GetPost == nil {
+			return fmt.Errorf("post %s not found", id)
+		}
+		var seen []string
+		for _, c := range data.GetPost.Comments {
+			seen = append(seen, c.ID)
+			for _, child := range c.Children {
+				seen = append(seen, child.ID)
+			}
+		}
+		lt.mu.Lock()
+		lt.comments[id] = seen
+		lt.mu.Unlock()
+		return nil
+	default:
+		id := lt.posts[lt.open[lt.openSampler.pick(rng)]].ID
+		vars := map[string]interface{}{"postId": id, "text": text(rng, 5, 400)}
+		lt.mu.Lock()
+		if seen := lt.comments[id]; len(seen) > 0 && rng.IntN(2) == 0 {
+			vars["parentId"] = seen[rng.IntN(len(seen))]
+		}
+		lt.mu.Unlock()
+		return lt.do(ctx, createCommentQuery, vars, nil)
+	}
+}
+
+// do sends a GraphQL request and decodes its data into out, if not nil.
+func (lt *loadTest) do(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lt.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := lt.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("HTTP %d: invalid response: %w", resp.StatusCode, err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, result.Errors[0].Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+// sampler picks indexes with the given weights.
+type sampler struct {
+	cumulative []float64
+}
+
+func newSampler(weights []float64) *sampler {
+	s := &sampler{cumulative: make([]float64, len(weights))}
+	sum := 0.0
+	for i, w := range weights {
+		sum += w
+		s.cumulative[i] = sum
+	}
+	return s
+}
+
+func (s *sampler) pick(rng *rand.Rand) int {
+	if len(s.cumulative) == 0 {
+		return 0
+	}
+	// The point is in (0, total], so that no index of weight zero is picked.
+	total := s.cumulative[len(s.cumulative)-1]
+	i := sort.SearchFloat64s(s.cumulative, (1-rng.Float64())*total)
+	return min(i, len(s.cumulative)-1)
+}
+
+// zipf returns the weights 1/r^skew of the ranks 1 to n.
+func zipf(n int, skew float64) []float64 {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1 / math.Pow(float64(i+1), skew)
+	}
+	return weights
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"OZON/pkg/pubsub"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Broker is the part of pubsub.Broker that the metrics read.
+type Broker interface {
+	Stats() pubsub.Stats
+}
+
+// RegisterBroker exports the subscriber count, queue depths and dropped
+// subscribers of b under the broker label name.
+func (m *Metrics) RegisterBroker(name string, b Broker) {
+	labels := prometheus.Labels{"broker": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pubsub", metric), help, nil, labels)
+	}
+	m.registry.MustRegister(&brokerCollector{
+		broker:      b,
+		subscribers: desc("subscribers", "Active subscriptions."),
+		queued:      desc("queued_messages", "Published messages not yet received, over all subscribers."),
+		maxQueued:   desc("max_queued_messages", "Backlog of the slowest subscriber."),
+		dropped:     desc("dropped_subscribers_total", "Subscribers removed for falling behind."),
+	})
+}
+
+// brokerCollector reads the statistics once per scrape so that the reported
+// values are consistent with each other.
+type brokerCollector struct {
+	broker                                  Broker
+	subscribers, queued, maxQueued, dropped *prometheus.Desc
+}
+
+func (c *brokerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.subscribers
+	ch <- c.queued
+	ch <- c.maxQueued
+	ch <- c.dropped
+}
+
+func (c *brokerCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.broker.Stats()
+	ch <- prometheus.MustNewConstMetric(c.subscribers, prometheus.GaugeValue, float64(s.Subscribers))
+	ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(s.Queued))
+	ch <- prometheus.MustNewConstMetric(c.maxQueued, prometheus.GaugeValue, float64(s.MaxQueued))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(s.Dropped))
+}
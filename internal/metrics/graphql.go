@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vektah/gqlparser/v2/ast"
+	"time"
+)
+
+// GraphQL returns a gqlgen extension that records the duration of every query
+// and mutation and of every field that has a resolver. Subscriptions are
+// long-lived and are counted by the broker metrics instead. Operation names
+// come from clients, so only the given ones are used as label values; other
+// named operations are reported as "other".
+func (m *Metrics) GraphQL(operations []string) graphql.HandlerExtension {
+	known := make(map[string]bool, len(operations))
+	for _, name := range operations {
+		known[name] = true
+	}
+	return graphqlExtension{m: m, known: known}
+}
+
+type graphqlExtension struct {
+	m     *Metrics
+	known map[string]bool
+}
+
+var (
+	_ graphql.ResponseInterceptor = graphqlExtension{}
+	_ graphql.FieldInterceptor    = graphqlExtension{}
+)
+
+func (graphqlExtension) ExtensionName() string {
+	return "Metrics"
+}
+
+func (graphqlExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e graphqlExtension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if !graphql.HasOperationContext(ctx) {
+		return resp
+	}
+	oc := graphql.GetOperationContext(ctx)
+
+	// Operations rejected before execution have no parsed operation.
+	opType := "invalid"
+	name := oc.OperationName
+	if oc.Operation != nil {
+		if oc.Operation.Operation == ast.Subscription {
+			return resp
+		}
+		opType = string(oc.Operation.Operation)
+		if name == "" {
+			name = oc.Operation.Name
+		}
+	}
+	status := "ok"
+	if resp == nil || len(resp.Errors) > 0 {
+		status = "error"
+	}
+	if !oc.Stats.OperationStart.IsZero() {
+		e.m.operationDuration.WithLabelValues(e.operationLabel(name), opType, status).
+			Observe(time.Since(oc.Stats.OperationStart).Seconds())
+	}
+	return resp
+}
+
+func (e graphqlExtension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	// Fields read from a struct cost nothing and would only add series.
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	start := time.Now()
+	res, err := next(ctx)
+	labels := prometheus.Labels{"object": fc.Object, "field": fc.Field.Name}
+	e.m.resolverDuration.With(labels).Observe(time.Since(start).Seconds())
+	if err != nil {
+		e.m.resolverErrors.With(labels).Inc()
+	}
+	return res, err
+}
+
+// operationLabel keeps the number of series bounded by the known names.
+func (e graphqlExtension) operationLabel(name string) string {
+	switch {
+	case name == "":
+		return "anonymous"
+	case e.known[name]:
+		return name
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,79 @@
+// Package metrics collects the Prometheus metrics of the server: GraphQL
+// operations and resolvers, repository calls, the database connection pool and
+// the subscription broker. Metrics are registered on the registry of a Metrics
+// value rather than the global one, so that tests can create their own.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "ozon"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	operationDuration  *prometheus.HistogramVec
+	resolverDuration   *prometheus.HistogramVec
+	resolverErrors     *prometheus.CounterVec
+	repositoryDuration *prometheus.HistogramVec
+	repositoryErrors   *prometheus.CounterVec
+}
+
+// New creates the metrics together with the Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "graphql",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of GraphQL queries and mutations by operation name, type and status (ok or error).",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "type", "status"}),
+		resolverDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "graphql",
+			Name:      "resolver_duration_seconds",
+			Help:      "Duration of GraphQL field resolvers by object and field.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"object", "field"}),
+		resolverErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "graphql",
+			Name:      "resolver_errors_total",
+			Help:      "Errors returned by GraphQL field resolvers by object and field.",
+		}, []string{"object", "field"}),
+		repositoryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "repository",
+			Name:      "call_duration_seconds",
+			Help:      "Duration of repository calls by storage backend and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "method"}),
+		repositoryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "repository",
+			Name:      "errors_total",
+			Help:      "Errors returned by repository calls by storage backend, method and error code.",
+		}, []string{"backend", "method", "code"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.operationDuration,
+		m.resolverDuration,
+		m.resolverErrors,
+		m.repositoryDuration,
+		m.repositoryErrors,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	"OZON/internal/repository/backend"
+	"context"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"time"
+)
+
+// InstrumentStorage wraps the repositories of s so that every call is timed
+// and every error counted under the backend label name, and exports the
+// statistics of its connection pool, if it has one.
+func (m *Metrics) InstrumentStorage(name string, s *backend.Storage) {
+	s.PostRepository = &postRepository{next: s.PostRepository, observer: observer{m, name}}
+	s.CommentRepository = &commentRepository{next: s.CommentRepository, observer: observer{m, name}}
+	if s.Pool != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(s.Pool, name))
+	}
+}
+
+type observer struct {
+	m       *Metrics
+	backend string
+}
+
+// observe records a call to method that started at start and returned err.
+func (o observer) observe(method string, start time.Time, err error) {
+	o.m.repositoryDuration.WithLabelValues(o.backend, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		code, _ := domain.ErrorCode(err)
+		o.m.repositoryErrors.WithLabelValues(o.backend, method, code).Inc()
+	}
+}
+
+type postRepository struct {
+	next repository.PostRepository
+	observer
+}
+
+func (r *postRepository) GetPost(ctx context.Context, id uuid.UUID, commentPage, commentLimit int32) (*domain.Post, error) {
+	start := time.Now()
+	post, err := r.next.GetPost(ctx, id, commentPage, commentLimit)
+	r.observe("GetPost", start, err)
+	return post, err
+}
+
+func (r *postRepository) GetPosts(ctx context.Context, page, limit int32) ([]*domain.Post, error) {
+	start := time.Now()
+	posts, err := r.next.GetPosts(ctx, page, limit)
+	r.observe("GetPosts", start, err)
+	return posts, err
+}
+
+func (r *postRepository) CreatePost(ctx context.Context, post *domain.Post, allowComments *bool) (*domain.Post, error) {
+	start := time.Now()
+	created, err := r.next.CreatePost(ctx, post, allowComments)
+	r.observe("CreatePost", start, err)
+	return created, err
+}
+
+func (r *postRepository) IsCommentsAllowed(ctx context.Context, postID uuid.UUID) (bool, error) {
+	start := time.Now()
+	allowed, err := r.next.IsCommentsAllowed(ctx, postID)
+	r.observe("IsCommentsAllowed", start, err)
+	return allowed, err
+}
+
+func (r *postRepository) SetCommentsAllowed(ctx context.Context, postID uuid.UUID, allowed bool) error {
+	start := time.Now()
+	err := r.next.SetCommentsAllowed(ctx, postID, allowed)
+	r.observe("SetCommentsAllowed", start, err)
+	return err
+}
+
+func (r *postRepository) LastModified(ctx context.Context, postID uuid.UUID) (time.Time, error) {
+	start := time.Now()
+	modified, err := r.next.LastModified(ctx, postID)
+	r.observe("LastModified", start, err)
+	return modified, err
+}
+
+func (r *postRepository) FeedVersion(ctx context.Context) (int64, error) {
+	start := time.Now()
+	version, err := r.next.FeedVersion(ctx)
+	r.observe("FeedVersion", start, err)
+	return version, err
+}
+
+type commentRepository struct {
+	next repository.CommentRepository
+	observer
+}
+
+func (r *commentRepository) CreateComment(ctx context.Context, comment *domain.Comment) (*domain.Comment, error) {
+	start := time.Now()
+	created, err := r.next.CreateComment(ctx, comment)
+	r.observe("CreateComment", start, err)
+	return created, err
+}
+
+func (r *commentRepository) GetComment(ctx context.Context, id uuid.UUID) (*domain.Comment, error) {
+	start := time.Now()
+	comment, err := r.next.GetComment(ctx, id)
+	r.observe("GetComment", start, err)
+	return comment, err
+}
+
+func (r *commentRepository) GetCommentsForPost(ctx context.Context, postID uuid.UUID, page, limit int32) ([]*domain.Comment, error) {
+	start := time.Now()
+	comments, err := r.next.GetCommentsForPost(ctx, postID, page, limit)
+	r.observe("GetCommentsForPost", start, err)
+	return comments, err
+}
+
+func (r *commentRepository) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	start := time.Now()
+	err := r.next.DeleteComment(ctx, id)
+	r.observe("DeleteComment", start, err)
+	return err
+}
+
+func (r *commentRepository) RebuildCounters(ctx context.Context) (int64, error) {
+	start := time.Now()
+	repaired, err := r.next.RebuildCounters(ctx)
+	r.observe("RebuildCounters", start, err)
+	return repaired, err
+}
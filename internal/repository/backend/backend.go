@@ -0,0 +1,123 @@
+// Package backend is a registry of storage backends. Each backend registers a
+// factory under the name used by --storage; only the selected one is opened, and
+// it owns its connections until Storage.Close is called.
+package backend
+
+import (
+	"OZON/internal/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings carries the options of every backend; each factory reads its own.
+type Settings struct {
+	PostgresURL          string
+	PostgresMaxOpenConns int
+	PostgresMaxIdleConns int
+	// Zero lifetimes keep connections open indefinitely.
+	PostgresConnMaxLifetime time.Duration
+	PostgresConnMaxIdleTime time.Duration
+	// PostgresNoMigrate makes the backend fail on a schema with pending
+	// migrations instead of applying them.
+	PostgresNoMigrate bool
+
+	SQLitePath string
+
+	InMemoryDir              string
+	InMemorySync             string
+	InMemorySyncInterval     time.Duration
+	InMemorySnapshotInterval time.Duration
+}
+
+// Storage is an opened backend.
+type Storage struct {
+	PostRepository    repository.PostRepository
+	CommentRepository repository.CommentRepository
+	// Pool is the connection pool of SQL backends and nil for the others; it
+	// is exposed for monitoring.
+	Pool *sql.DB
+	// Importer loads exported data; nil if the backend cannot.
+	Importer repository.Importer
+
+	check func(ctx context.Context) error
+	close func() error
+}
+
+// NewStorage wraps the repositories of a backend. check reports whether the
+// backend can serve requests and close releases it; either may be nil.
+func NewStorage(posts repository.PostRepository, comments repository.CommentRepository, check func(ctx context.Context) error, close func() error) *Storage {
+	return &Storage{
+		PostRepository:    posts,
+		CommentRepository: comments,
+		check:             check,
+		close:             close,
+	}
+}
+
+// Check returns an error when the backend cannot serve requests, for example
+// because the database is unreachable or its schema is out of date.
+func (s *Storage) Check(ctx context.Context) error {
+	if s.check == nil {
+		return nil
+	}
+	return s.check(ctx)
+}
+
+// Close releases the connections and files held by the backend.
+func (s *Storage) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+type Factory func(settings Settings) (*Storage, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a backend available under name. It panics if the name is
+// already taken, like database/sql.Register.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("backend: %q registered twice", name))
+	}
+	factories[name] = factory
+}
+
+// Open builds the backend registered under name.
+func Open(name string, settings Settings) (*Storage, error) {
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage type: %s. Use one of: %s", name, strings.Join(Names(), ", "))
+	}
+
+	s, err := factory(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s storage: %w", name, err)
+	}
+	return s, nil
+}
+
+// Names returns the registered backend names in alphabetical order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,288 @@
+// Package cache adds a read-through cache in front of the repositories: posts
+// and the first page of their comments are served from an in-process LRU or
+// from Redis until they change or their TTL runs out.
+//
+// The entries of a post are stored under a version token of that post, and
+// every write that changes the post or its comments replaces the token. An
+// invalidated entry thus can never be read again, even when a reader that
+// fetched the old data stores it after the write: it lands under the old
+// token. With Redis the token is shared, so a comment created on one replica
+// invalidates the post on all of them; the in-process LRU only sees the
+// writes of its own server, and the TTL bounds how stale the others get.
+//
+// Every entry also records the UpdatedAt of its post when it was read, and a
+// hit reports it with repository.RecordCachedRead, so that a response is
+// never labelled with a newer data version than the one it holds.
+package cache
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	"OZON/internal/repository/backend"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"time"
+)
+
+// Cache stores opaque values by key; a missing or expired key is a miss.
+type Cache interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Decorate wraps the repositories of s so that GetPost and GetCommentsForPost
+// read the first comment page through c, keeping entries for ttl.
+func Decorate(s *backend.Storage, c Cache, ttl time.Duration) {
+	st := &store{cache: c, posts: s.PostRepository, ttl: ttl}
+	s.PostRepository = &postRepository{next: s.PostRepository, store: st}
+	s.CommentRepository = &commentRepository{next: s.CommentRepository, store: st}
+	if s.Importer != nil {
+		s.Importer = &importer{next: s.Importer, store: st}
+	}
+}
+
+type store struct {
+	cache Cache
+	// posts is the undecorated repository the data versions are read from.
+	posts repository.PostRepository
+	ttl   time.Duration
+}
+
+func versionKey(postID uuid.UUID) string {
+	return "post:" + postID.String() + ":version"
+}
+
+// version returns the current version token of a post, creating one if the
+// post has none. ok is false when the cache cannot be used.
+func (s *store) version(ctx context.Context, postID uuid.UUID) (string, bool) {
+	token, ok, err := s.cache.Get(ctx, versionKey(postID))
+	if err != nil {
+		slog.WarnContext(ctx, "cache read failed", "error", err)
+		return "", false
+	}
+	if ok {
+		return string(token), true
+	}
+	return s.bump(ctx, postID)
+}
+
+// bump gives a post a new version token, which orphans all its entries.
+func (s *store) bump(ctx context.Context, postID uuid.UUID) (string, bool) {
+	token := uuid.NewString()
+	// The token must outlive the entries stored under it; should it expire
+	// early, the entries are only orphaned.
+	if err := s.cache.Set(ctx, versionKey(postID), []byte(token), 2*s.ttl); err != nil {
+		slog.WarnContext(ctx, "cache write failed", "error", err)
+		return "", false
+	}
+	return token, true
+}
+
+func entryKey(postID uuid.UUID, version, name string) string {
+	return "post:" + postID.String() + ":" + version + ":" + name
+}
+
+// entry is the stored form of a cached value.
+type entry struct {
+	// Modified is the UpdatedAt of the post when the value was read.
+	Modified time.Time       `json:"modified"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// slot is where a missed entry is to be stored.
+type slot struct {
+	// version is the version token of the post; empty when the cache cannot
+	// be used.
+	version string
+	// modified is the UpdatedAt of the post, read before the repository is
+	// queried so that it is at most as new as the stored value.
+	modified time.Time
+}
+
+// get decodes the entry name of a post into v and reports whether it was
+// found; a hit is recorded with repository.RecordCachedRead. On a miss the
+// returned slot is the one to store the entry in.
+func (s *store) get(ctx context.Context, postID uuid.UUID, name string, v interface{}) (slot, bool) {
+	version, ok := s.version(ctx, postID)
+	if !ok {
+		return slot{}, false
+	}
+	data, ok, err := s.cache.Get(ctx, entryKey(postID, version, name))
+	if err != nil {
+		slog.WarnContext(ctx, "cache read failed", "error", err)
+		return slot{}, false
+	}
+	if ok {
+		var e entry
+		err = json.Unmarshal(data, &e)
+		if err == nil && e.Value == nil {
+			err = errors.New("no value")
+		}
+		if err == nil {
+			err = json.Unmarshal(e.Value, v)
+		}
+		if err == nil {
+			repository.RecordCachedRead(ctx, postID, e.Modified)
+			return slot{}, true
+		}
+		slog.WarnContext(ctx, "invalid cache entry", "key", entryKey(postID, version, name), "error", err)
+	}
+	// A missing post is reported by the repository itself.
+	modified, err := s.posts.LastModified(ctx, postID)
+	if err != nil {
+		return slot{}, false
+	}
+	return slot{version: version, modified: modified}, false
+}
+
+// set stores v as the entry name of a post in the slot returned by get.
+func (s *store) set(ctx context.Context, postID uuid.UUID, to slot, name string, v interface{}) {
+	if to.version == "" {
+		return
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to encode cache entry", "error", err)
+		return
+	}
+	data, err := json.Marshal(entry{Modified: to.modified, Value: value})
+	if err != nil {
+		slog.WarnContext(ctx, "failed to encode cache entry", "error", err)
+		return
+	}
+	if err := s.cache.Set(ctx, entryKey(postID, to.version, name), data, s.ttl); err != nil {
+		slog.WarnContext(ctx, "cache write failed", "error", err)
+	}
+}
+
+type postRepository struct {
+	next repository.PostRepository
+	*store
+}
+
+// GetPost caches the post together with its first comment page, one entry
+// per page size.
+func (r *postRepository) GetPost(ctx context.Context, id uuid.UUID, commentPage, commentLimit int32) (*domain.Post, error) {
+	if commentPage != 1 {
+		return r.next.GetPost(ctx, id, commentPage, commentLimit)
+	}
+	name := fmt.Sprintf("post:%d", commentLimit)
+	var cached domain.Post
+	to, hit := r.get(ctx, id, name, &cached)
+	if hit {
+		return &cached, nil
+	}
+	post, err := r.next.GetPost(ctx, id, commentPage, commentLimit)
+	if err == nil {
+		r.set(ctx, id, to, name, post)
+	}
+	return post, err
+}
+
+func (r *postRepository) GetPosts(ctx context.Context, page, limit int32) ([]*domain.Post, error) {
+	return r.next.GetPosts(ctx, page, limit)
+}
+
+func (r *postRepository) CreatePost(ctx context.Context, post *domain.Post, allowComments *bool) (*domain.Post, error) {
+	return r.next.CreatePost(ctx, post, allowComments)
+}
+
+func (r *postRepository) IsCommentsAllowed(ctx context.Context, postID uuid.UUID) (bool, error) {
+	return r.next.IsCommentsAllowed(ctx, postID)
+}
+
+// SetCommentsAllowed invalidates the post, whose allowComments has changed.
+func (r *postRepository) SetCommentsAllowed(ctx context.Context, postID uuid.UUID, allowed bool) error {
+	if err := r.next.SetCommentsAllowed(ctx, postID, allowed); err != nil {
+		return err
+	}
+	r.bump(ctx, postID)
+	return nil
+}
+
+// LastModified is not cached: it must see writes of other replicas at once.
+func (r *postRepository) LastModified(ctx context.Context, postID uuid.UUID) (time.Time, error) {
+	return r.next.LastModified(ctx, postID)
+}
+
+// FeedVersion is not cached for the same reason.
+func (r *postRepository) FeedVersion(ctx context.Context) (int64, error) {
+	return r.next.FeedVersion(ctx)
+}
+
+type commentRepository struct {
+	next repository.CommentRepository
+	*store
+}
+
+// CreateComment invalidates the post: its comment count and possibly its
+// first page have changed.
+func (r *commentRepository) CreateComment(ctx context.Context, comment *domain.Comment) (*domain.Comment, error) {
+	created, err := r.next.CreateComment(ctx, comment)
+	if err == nil {
+		r.bump(ctx, created.PostID)
+	}
+	return created, err
+}
+
+func (r *commentRepository) GetComment(ctx context.Context, id uuid.UUID) (*domain.Comment, error) {
+	return r.next.GetComment(ctx, id)
+}
+
+func (r *commentRepository) GetCommentsForPost(ctx context.Context, postID uuid.UUID, page, limit int32) ([]*domain.Comment, error) {
+	if page != 1 {
+		return r.next.GetCommentsForPost(ctx, postID, page, limit)
+	}
+	name := fmt.Sprintf("comments:%d", limit)
+	var cached []*domain.Comment
+	to, hit := r.get(ctx, postID, name, &cached)
+	if hit {
+		return cached, nil
+	}
+	comments, err := r.next.GetCommentsForPost(ctx, postID, page, limit)
+	if err == nil {
+		r.set(ctx, postID, to, name, comments)
+	}
+	return comments, err
+}
+
+// DeleteComment invalidates the post of the comment, which it looks up first.
+func (r *commentRepository) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	comment, lookupErr := r.next.GetComment(ctx, id)
+	if err := r.next.DeleteComment(ctx, id); err != nil {
+		return err
+	}
+	if lookupErr == nil {
+		r.bump(ctx, comment.PostID)
+	}
+	return nil
+}
+
+// RebuildCounters does not invalidate anything: the posts it repairs are not
+// known. Cached counters catch up when their entries expire.
+func (r *commentRepository) RebuildCounters(ctx context.Context) (int64, error) {
+	return r.next.RebuildCounters(ctx)
+}
+
+type importer struct {
+	next repository.Importer
+	*store
+}
+
+// Import invalidates the posts that received comments. New posts have no
+// entries yet, and a failed batch may have stored part of its rows.
+func (r *importer) Import(ctx context.Context, posts []*domain.Post, comments []*domain.Comment) (repository.ImportResult, error) {
+	result, err := r.next.Import(ctx, posts, comments)
+	bumped := make(map[uuid.UUID]bool)
+	for _, comment := range comments {
+		if !bumped[comment.PostID] {
+			bumped[comment.PostID] = true
+			r.bump(ctx, comment.PostID)
+		}
+	}
+	return result, err
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"time"
+)
+
+// LRU is an in-process Cache that holds at most a fixed number of entries,
+// evicting the least recently used one first.
+type LRU struct {
+	entries *lru.Cache[string, lruEntry]
+}
+
+type lruEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU returns an empty cache of size entries.
+func NewLRU(size int) (*LRU, error) {
+	entries, err := lru.New[string, lruEntry](size)
+	if err != nil {
+		return nil, err
+	}
+	return &LRU{entries: entries}, nil
+}
+
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	e, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if !time.Now().Before(e.expires) {
+		c.entries.Remove(key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.entries.Add(key, lruEntry{value: value, expires: time.Now().Add(ttl)})
+	return nil
+}
+
+// Len returns the number of entries, expired ones included.
+func (c *LRU) Len() int {
+	return c.entries.Len()
+}
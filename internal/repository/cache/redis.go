@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// keyPrefix keeps the keys of the server apart from other users of the database.
+const keyPrefix = "ozon:"
+
+// Redis is a Cache shared by every replica, kept in Redis or a server that
+// speaks its protocol.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the server at url, such as redis://localhost:6379/0.
+// Connections are opened lazily: an unreachable server only makes the cache
+// miss.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	return &Redis{client: redis.NewClient(opts)}, nil
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, keyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, keyPrefix+key, value, ttl).Err()
+}
+
+// Close closes the connections to the server.
+func (c *Redis) Close() error {
+	return c.client.Close()
+}
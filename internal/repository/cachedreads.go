@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// CachedReads collects the posts whose data a request was served from a cache,
+// each with the version of that data: the UpdatedAt of the post when the entry
+// was stored. A cache may lag behind the store, so whoever labels a response
+// with a data version, such as an ETag, checks these against the store.
+type CachedReads struct {
+	mu       sync.Mutex
+	versions map[uuid.UUID]time.Time
+}
+
+type cachedReadsKey struct{}
+
+// WithCachedReads returns a context in which cache hits are recorded to the
+// returned CachedReads.
+func WithCachedReads(ctx context.Context) (context.Context, *CachedReads) {
+	reads := &CachedReads{versions: make(map[uuid.UUID]time.Time)}
+	return context.WithValue(ctx, cachedReadsKey{}, reads), reads
+}
+
+// RecordCachedRead notes that data of a post at version was served from a
+// cache. It does nothing unless ctx comes from WithCachedReads.
+func RecordCachedRead(ctx context.Context, postID uuid.UUID, version time.Time) {
+	reads, _ := ctx.Value(cachedReadsKey{}).(*CachedReads)
+	if reads == nil {
+		return
+	}
+	reads.mu.Lock()
+	defer reads.mu.Unlock()
+	if old, ok := reads.versions[postID]; !ok || version.Before(old) {
+		reads.versions[postID] = version
+	}
+}
+
+// Versions returns the oldest version served of each post.
+func (r *CachedReads) Versions() map[uuid.UUID]time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	versions := make(map[uuid.UUID]time.Time, len(r.versions))
+	for id, v := range r.versions {
+		versions[id] = v
+	}
+	return versions
+}
@@ -0,0 +1,29 @@
+package memory
+
+import "OZON/internal/repository/backend"
+
+func init() {
+	backend.Register("inmemory", open)
+}
+
+func open(settings backend.Settings) (*backend.Storage, error) {
+	if settings.InMemoryDir == "" {
+		repo := NewInMemoryRepository()
+		s := backend.NewStorage(repo, repo, nil, nil)
+		s.Importer = repo
+		return s, nil
+	}
+
+	repo, err := NewPersistentInMemoryRepository(PersistenceOptions{
+		Dir:              settings.InMemoryDir,
+		Sync:             SyncPolicy(settings.InMemorySync),
+		SyncInterval:     settings.InMemorySyncInterval,
+		SnapshotInterval: settings.InMemorySnapshotInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := backend.NewStorage(repo, repo, nil, repo.Close)
+	s.Importer = repo
+	return s, nil
+}
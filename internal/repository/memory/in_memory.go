@@ -2,88 +2,101 @@ package memory
 
 import (
 	"OZON/internal/domain"
+	"OZON/internal/repository"
 	"context"
 	"fmt"
 	"github.com/google/uuid"
-	"sort"
 	"sync"
 	"time"
 )
 
 type InMemoryRepository struct {
-	posts    sync.Map
-	comments sync.Map
+	// writeMu serializes the writes, so that the checks of a write, such as
+	// whether the parent of a comment is deleted, still hold when its change
+	// is applied; mu only guards the maps for readers.
+	writeMu  sync.Mutex
+	mu       sync.RWMutex
+	posts    map[uuid.UUID]*domain.Post
+	comments map[uuid.UUID]*domain.Comment
+
+	// postOrder holds every post sorted by created_at, id, so a page of the
+	// feed is a slice of it.
+	postOrder []*domain.Post
+	// roots and replies hold the root comments of each post and the direct
+	// replies of each comment, sorted by created_at, id. A comment page and its
+	// reply trees are read without scanning unrelated comments.
+	roots   map[uuid.UUID][]*domain.Comment
+	replies map[uuid.UUID][]*domain.Comment
+
+	// commentCounts and replyCounts hold Post.CommentCount by post ID and
+	// Comment.ReplyCount by comment ID. They change together with the indexes
+	// under mu, so readers always see counters that match the comments; the
+	// stored posts and comments never carry the counters themselves.
+	commentCounts map[uuid.UUID]int
+	replyCounts   map[uuid.UUID]int
+	// updatedAt holds Post.UpdatedAt by post ID, derived like the counters
+	// from the timestamps of the posts and comments. feedVersion grows with
+	// every change under mu; it starts from the clock so that it keeps
+	// growing across restarts.
+	updatedAt   map[uuid.UUID]time.Time
+	feedVersion int64
+
+	// persistence is nil unless the repository was created with
+	// NewPersistentInMemoryRepository.
+	persistence *persistence
 }
 
 func NewInMemoryRepository() *InMemoryRepository {
-	return &InMemoryRepository{}
+	return &InMemoryRepository{
+		posts:    make(map[uuid.UUID]*domain.Post),
+		comments: make(map[uuid.UUID]*domain.Comment),
+		roots:    make(map[uuid.UUID][]*domain.Comment),
+		replies:  make(map[uuid.UUID][]*domain.Comment),
+
+		commentCounts: make(map[uuid.UUID]int),
+		replyCounts:   make(map[uuid.UUID]int),
+		updatedAt:     make(map[uuid.UUID]time.Time),
+	}
 }
 
 func (r *InMemoryRepository) GetPost(ctx context.Context, id uuid.UUID, commentPage, commentLimit int32) (*domain.Post, error) {
 	if commentPage <= 0 {
-		return nil, fmt.Errorf("comment page must be greater than 0")
+		return nil, domain.NewValidationError("commentPage", "comment page must be greater than 0")
 	}
 	if commentLimit <= 0 {
-		return nil, fmt.Errorf("comment limit must be greater than or equal to 0")
+		return nil, domain.NewValidationError("commentLimit", "comment limit must be greater than or equal to 0")
 	}
 
-	if v, ok := r.posts.Load(id); ok {
-		post, ok := v.(*domain.Post)
-		if !ok {
-			return nil, fmt.Errorf("invalid post type")
-		}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-		postCopy := *post
-		postCopy.Comments = r.getCommentsForPost(post.ID, commentPage, commentLimit)
-		return &postCopy, nil
+	post, ok := r.posts[id]
+	if !ok {
+		return nil, domain.ErrPostNotFound
 	}
-	return nil, fmt.Errorf("post not found")
+	postCopy := r.copyPost(post)
+	postCopy.Comments = r.getCommentsForPost(post.ID, commentPage, commentLimit)
+	return postCopy, nil
 }
 
 func (r *InMemoryRepository) GetPosts(ctx context.Context, page, limit int32) ([]*domain.Post, error) {
 	if page <= 0 {
-		return nil, fmt.Errorf("page must be greater than 0")
+		return nil, domain.NewValidationError("page", "page must be greater than 0")
 	}
 	if limit <= 0 {
-		return nil, fmt.Errorf("limit must be greater than or equal to 0")
+		return nil, domain.NewValidationError("limit", "limit must be greater than or equal to 0")
 	}
 
-	var allPosts []*domain.Post
-	r.posts.Range(func(key, value interface{}) bool {
-		if post, ok := value.(*domain.Post); ok {
-			allPosts = append(allPosts, post)
-		}
-		return true
-	})
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	sort.Slice(allPosts, func(i, j int) bool {
-		if allPosts[i].CreatedAt == nil || allPosts[j].CreatedAt == nil {
-			return allPosts[i].ID.String() < allPosts[j].ID.String()
-		}
-		return allPosts[i].CreatedAt.Before(*allPosts[j].CreatedAt)
-	})
-
-	offset := (page - 1) * limit
-	if offset < 0 {
-		offset = 0
+	start, end, ok := pageBounds(len(r.postOrder), page, limit)
+	if !ok {
+		return []*domain.Post{}, nil
 	}
-	if offset > int32(len(allPosts)) {
-		return nil, fmt.Errorf("page out of range")
-	}
-	end := offset + limit
-	if end > int32(len(allPosts)) {
-		end = int32(len(allPosts))
-	}
-
-	paginatedPosts := make([]*domain.Post, 0, limit)
-	for _, post := range allPosts[offset:end] {
-		postCopy := *post
-		postCopy.Comments = r.getCommentsForPost(post.ID, page, limit)
-		paginatedPosts = append(paginatedPosts, &postCopy)
-	}
-
-	if len(paginatedPosts) == 0 {
-		return nil, fmt.Errorf("no posts found")
+	paginatedPosts := make([]*domain.Post, 0, end-start)
+	for _, post := range r.postOrder[start:end] {
+		paginatedPosts = append(paginatedPosts, r.copyPost(post))
 	}
 	return paginatedPosts, nil
 }
@@ -101,23 +114,65 @@ func (r *InMemoryRepository) CreatePost(ctx context.Context, post *domain.Post,
 	if allowComments != nil {
 		allow = *allowComments
 	}
+
 	post.AllowComments = allow
 	post.Comments = nil
+	post.CommentCount = 0
+	updatedAt := *post.CreatedAt
+	post.UpdatedAt = &updatedAt
 
-	r.posts.Store(post.ID, post)
+	unlock := r.lockWrites()
+	defer unlock()
+
+	if err := r.appendLog(logRecord{Op: opCreatePost, Post: post}); err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+	r.storePost(post)
 	return post, nil
 }
 
 func (r *InMemoryRepository) IsCommentsAllowed(ctx context.Context, postID uuid.UUID) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	if v, ok := r.posts.Load(postID); ok {
-		allow, ok := v.(*domain.Post)
-		if !ok {
-			return false, fmt.Errorf("invalid post type")
-		}
-		return allow.AllowComments, nil
+	post, ok := r.posts[postID]
+	if !ok {
+		return false, domain.ErrPostNotFound
+	}
+	return post.AllowComments, nil
+}
+
+func (r *InMemoryRepository) SetCommentsAllowed(ctx context.Context, postID uuid.UUID, allowed bool) error {
+	unlock := r.lockWrites()
+	defer unlock()
+
+	current, err := r.IsCommentsAllowed(ctx, postID)
+	if err != nil || current == allowed {
+		return err
+	}
+	now := time.Now()
+	if err := r.appendLog(logRecord{Op: opSetCommentsAllowed, Post: &domain.Post{ID: postID, AllowComments: allowed, UpdatedAt: &now}}); err != nil {
+		return fmt.Errorf("failed to set comments allowed: %w", err)
+	}
+	r.setCommentsAllowed(postID, allowed, now)
+	return nil
+}
+
+func (r *InMemoryRepository) LastModified(ctx context.Context, postID uuid.UUID) (time.Time, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.posts[postID]; !ok {
+		return time.Time{}, domain.ErrPostNotFound
 	}
-	return false, fmt.Errorf("post not found")
+	return r.updatedAt[postID], nil
+}
+
+func (r *InMemoryRepository) FeedVersion(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.feedVersion, nil
 }
 
 func (r *InMemoryRepository) CreateComment(ctx context.Context, comment *domain.Comment) (*domain.Comment, error) {
@@ -126,96 +181,331 @@ func (r *InMemoryRepository) CreateComment(ctx context.Context, comment *domain.
 		now := time.Now()
 		comment.CreatedAt = &now
 	}
-	if val, ok := r.posts.Load(comment.PostID); ok {
-		post, ok := val.(*domain.Post)
-		if !ok {
-			return nil, fmt.Errorf("invalid post type")
+	comment.ReplyCount = 0
+	unlock := r.lockWrites()
+	defer unlock()
+
+	allowed, err := r.IsCommentsAllowed(ctx, comment.PostID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, domain.ErrCommentsDisabled
+	}
+	if comment.ParentID != nil {
+		if err := repository.ValidateParent(ctx, r, comment.PostID, *comment.ParentID, 0); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.appendLog(logRecord{Op: opCreateComment, Comment: comment}); err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+	r.storeComment(comment)
+	// A comment given a CreatedAt in the past must change the post as well.
+	r.mu.Lock()
+	r.touch(comment.PostID, time.Now())
+	r.mu.Unlock()
+	return comment, nil
+}
+
+func (r *InMemoryRepository) GetComment(ctx context.Context, id uuid.UUID) (*domain.Comment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	comment, ok := r.comments[id]
+	if !ok {
+		return nil, domain.ErrCommentNotFound
+	}
+	return r.copyComment(comment), nil
+}
+
+func (r *InMemoryRepository) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	unlock := r.lockWrites()
+	defer unlock()
+
+	r.mu.RLock()
+	comment, ok := r.comments[id]
+	deleted := ok && comment.IsDeleted()
+	r.mu.RUnlock()
+	if !ok {
+		return domain.ErrCommentNotFound
+	}
+	if deleted {
+		return nil
+	}
+
+	now := time.Now()
+	if err := r.appendLog(logRecord{Op: opDeleteComment, Comment: &domain.Comment{ID: id, DeletedAt: &now}}); err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	r.markDeleted(id, now)
+	return nil
+}
+
+// RebuildCounters recomputes the counters from the stored comments. They are
+// maintained under the same lock as the comments, so this only finds
+// differences if that invariant is broken.
+func (r *InMemoryRepository) RebuildCounters(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	commentCounts := make(map[uuid.UUID]int)
+	replyCounts := make(map[uuid.UUID]int)
+	for _, c := range r.comments {
+		if c.IsDeleted() {
+			continue
+		}
+		commentCounts[c.PostID]++
+		if c.ParentID != nil {
+			replyCounts[*c.ParentID]++
+		}
+	}
+
+	var repaired int64
+	now := time.Now()
+	for id := range r.posts {
+		if r.commentCounts[id] != commentCounts[id] {
+			repaired++
+			r.touch(id, now)
+		}
+	}
+	for id := range r.comments {
+		if r.replyCounts[id] != replyCounts[id] {
+			repaired++
 		}
-		if !post.AllowComments {
-			return nil, fmt.Errorf("comments not allowed for this post")
+	}
+	r.commentCounts = commentCounts
+	r.replyCounts = replyCounts
+	return repaired, nil
+}
+
+// Import logs every stored row like CreatePost and CreateComment do.
+func (r *InMemoryRepository) Import(ctx context.Context, posts []*domain.Post, comments []*domain.Comment) (repository.ImportResult, error) {
+	unlock := r.lockWrites()
+	defer unlock()
+
+	var result repository.ImportResult
+	listed := make(map[uuid.UUID]bool, len(posts))
+	for _, post := range posts {
+		listed[post.ID] = true
+		r.mu.RLock()
+		_, exists := r.posts[post.ID]
+		r.mu.RUnlock()
+		if exists {
+			continue
 		}
-		if comment.ParentID != nil {
-			if parent, ok := r.comments.Load(*comment.ParentID); ok {
-				if _, ok := parent.(*domain.Comment); ok {
-				} else {
-					return nil, fmt.Errorf("parent not found or invalid type")
-				}
-			} else {
-				return nil, fmt.Errorf("parent not found")
-			}
+		postCopy := *post
+		if postCopy.UpdatedAt == nil {
+			postCopy.UpdatedAt = postCopy.CreatedAt
+		}
+		if err := r.appendLog(logRecord{Op: opCreatePost, Post: &postCopy}); err != nil {
+			return result, fmt.Errorf("failed to import post: %w", err)
 		}
-		r.comments.Store(comment.ID, comment)
-		return comment, nil
+		r.storePost(&postCopy)
+		result.PostIDs = append(result.PostIDs, post.ID)
 	}
-	return nil, fmt.Errorf("post not found")
+
+	touched := make(map[uuid.UUID]bool)
+	for _, comment := range comments {
+		r.mu.RLock()
+		_, exists := r.comments[comment.ID]
+		r.mu.RUnlock()
+		if exists {
+			continue
+		}
+		if err := r.appendLog(logRecord{Op: opCreateComment, Comment: comment}); err != nil {
+			return result, fmt.Errorf("failed to import comment: %w", err)
+		}
+		r.storeComment(comment)
+		if !listed[comment.PostID] {
+			touched[comment.PostID] = true
+		}
+		result.Comments++
+	}
+
+	now := time.Now()
+	for postID := range touched {
+		if err := r.appendLog(logRecord{Op: opTouchPost, Post: &domain.Post{ID: postID, UpdatedAt: &now}}); err != nil {
+			return result, fmt.Errorf("failed to import comment: %w", err)
+		}
+		r.mu.Lock()
+		r.touch(postID, now)
+		r.mu.Unlock()
+	}
+	return result, nil
 }
 
 func (r *InMemoryRepository) GetCommentsForPost(ctx context.Context, postID uuid.UUID, page, limit int32) ([]*domain.Comment, error) {
 	if page <= 0 {
-		return nil, fmt.Errorf("page must be greater than 0")
+		return nil, domain.NewValidationError("page", "page must be greater than 0")
 	}
 	if limit <= 0 {
-		return nil, fmt.Errorf("limit must be greater than 0")
+		return nil, domain.NewValidationError("limit", "limit must be greater than 0")
 	}
 
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.posts[postID]; !ok {
+		return nil, domain.ErrPostNotFound
+	}
 	return r.getCommentsForPost(postID, page, limit), nil
 }
 
+// getCommentsForPost must be called with r.mu held.
 func (r *InMemoryRepository) getCommentsForPost(postID uuid.UUID, page, limit int32) []*domain.Comment {
-	var rootComments []*domain.Comment
-	offset := (page - 1) * limit
-	if offset < 0 {
-		offset = 0
-	}
-
-	var count int
-	r.comments.Range(func(key, value interface{}) bool {
-		if comment, ok := value.(*domain.Comment); ok {
-			if comment.PostID == postID && comment.ParentID == nil {
-				if count >= int(offset) && count < int(offset)+int(limit) {
-					commentCopy := *comment
-					commentCopy.Children = make([]*domain.Comment, 0)
-					rootComments = append(rootComments, &commentCopy)
-				}
-				count++
-			}
-		}
-		return true
-	})
+	roots := r.roots[postID]
+	start, end, ok := pageBounds(len(roots), page, limit)
+	if !ok {
+		return []*domain.Comment{}
+	}
 
-	sort.Slice(rootComments, func(i, j int) bool {
-		if rootComments[i].CreatedAt == nil || rootComments[j].CreatedAt == nil {
-			return rootComments[i].ID.String() < rootComments[j].ID.String()
-		}
-		return rootComments[i].CreatedAt.Before(*rootComments[j].CreatedAt)
-	})
+	paginated := make([]*domain.Comment, 0, end-start)
+	for _, root := range roots[start:end] {
+		commentCopy := r.copyComment(root)
+		commentCopy.Children = r.buildCommentTreeForChildren(root.ID)
+		paginated = append(paginated, commentCopy)
+	}
+	return paginated
+}
 
-	for i, root := range rootComments {
-		rootComments[i].Children = r.buildCommentTreeForChildren(root.ID)
+// buildCommentTreeForChildren must be called with r.mu held.
+func (r *InMemoryRepository) buildCommentTreeForChildren(parentID uuid.UUID) []*domain.Comment {
+	replies := r.replies[parentID]
+	children := make([]*domain.Comment, 0, len(replies))
+	for _, reply := range replies {
+		commentCopy := r.copyComment(reply)
+		commentCopy.Children = r.buildCommentTreeForChildren(reply.ID)
+		children = append(children, commentCopy)
 	}
+	return children
+}
 
-	return rootComments
+// copyPost returns a copy of a stored post with its counter and without
+// comments. It must be called with r.mu held.
+func (r *InMemoryRepository) copyPost(post *domain.Post) *domain.Post {
+	postCopy := *post
+	postCopy.Comments = nil
+	postCopy.CommentCount = r.commentCounts[post.ID]
+	updatedAt := r.updatedAt[post.ID]
+	postCopy.UpdatedAt = &updatedAt
+	return &postCopy
 }
 
-func (r *InMemoryRepository) buildCommentTreeForChildren(parentID uuid.UUID) []*domain.Comment {
-	var children []*domain.Comment
-
-	r.comments.Range(func(key, value interface{}) bool {
-		if comment, ok := value.(*domain.Comment); ok {
-			if comment.ParentID != nil && comment.ParentID.String() == parentID.String() {
-				commentCopy := *comment
-				commentCopy.Children = r.buildCommentTreeForChildren(comment.ID)
-				children = append(children, &commentCopy)
-			}
-		}
-		return true
-	})
-	sort.Slice(children, func(i, j int) bool {
-		if children[i].CreatedAt == nil || children[j].CreatedAt == nil {
-			return children[i].ID.String() < children[j].ID.String()
-		}
-		return children[i].CreatedAt.Before(*children[j].CreatedAt)
-	})
+// copyComment returns a copy of a stored comment with its counter and without
+// children. It must be called with r.mu held.
+func (r *InMemoryRepository) copyComment(comment *domain.Comment) *domain.Comment {
+	commentCopy := *comment
+	commentCopy.Children = nil
+	commentCopy.ReplyCount = r.replyCounts[comment.ID]
+	return &commentCopy
+}
 
-	return children
+// storePost and storeComment keep their own copy, so callers may go on using
+// the objects they passed in without racing with later writes.
+func (r *InMemoryRepository) storePost(post *domain.Post) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if old, ok := r.posts[post.ID]; ok {
+		r.postOrder = removeSorted(r.postOrder, old, postBefore)
+	}
+	stored := *post
+	stored.Comments = nil
+	stored.CommentCount = 0
+	stored.UpdatedAt = nil
+	r.posts[post.ID] = &stored
+	r.touch(post.ID, *post.CreatedAt)
+	// Snapshots carry the UpdatedAt of changes that leave no other trace,
+	// such as closing the comments.
+	if post.UpdatedAt != nil {
+		r.touch(post.ID, *post.UpdatedAt)
+	}
+	r.postOrder = insertSorted(r.postOrder, &stored, postBefore)
+}
+
+func (r *InMemoryRepository) storeComment(c *domain.Comment) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if old, ok := r.comments[c.ID]; ok {
+		r.unindexComment(old)
+		r.countComment(old, -1)
+	}
+	stored := *c
+	stored.Children = nil
+	stored.ReplyCount = 0
+	comment := &stored
+
+	r.comments[comment.ID] = comment
+	r.countComment(comment, 1)
+	r.touch(comment.PostID, *comment.CreatedAt)
+	if comment.DeletedAt != nil {
+		r.touch(comment.PostID, *comment.DeletedAt)
+	}
+	if comment.ParentID == nil {
+		r.roots[comment.PostID] = insertSorted(r.roots[comment.PostID], comment, commentBefore)
+	} else {
+		r.replies[*comment.ParentID] = insertSorted(r.replies[*comment.ParentID], comment, commentBefore)
+	}
+}
+
+// markDeleted soft-deletes a stored comment and reports whether it exists.
+func (r *InMemoryRepository) markDeleted(id uuid.UUID, at time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	comment, ok := r.comments[id]
+	if !ok {
+		return false
+	}
+	if !comment.IsDeleted() {
+		r.countComment(comment, -1)
+		comment.DeletedAt = &at
+		r.touch(comment.PostID, at)
+	}
+	return true
+}
+
+// setCommentsAllowed reports whether the post exists.
+func (r *InMemoryRepository) setCommentsAllowed(postID uuid.UUID, allowed bool, at time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, ok := r.posts[postID]
+	if !ok {
+		return false
+	}
+	post.AllowComments = allowed
+	r.touch(postID, at)
+	return true
+}
+
+// touch moves the UpdatedAt of a post forward to at; it never goes back. It
+// bumps the feed version in any case. It must be called with r.mu held.
+func (r *InMemoryRepository) touch(postID uuid.UUID, at time.Time) {
+	if at.After(r.updatedAt[postID]) {
+		r.updatedAt[postID] = at
+	}
+	r.feedVersion = max(r.feedVersion+1, time.Now().UnixNano())
+}
+
+// countComment adds delta to the counters a comment contributes to. Deleted
+// comments contribute nothing. It must be called with r.mu held.
+func (r *InMemoryRepository) countComment(comment *domain.Comment, delta int) {
+	if comment.IsDeleted() {
+		return
+	}
+	r.commentCounts[comment.PostID] += delta
+	if comment.ParentID != nil {
+		r.replyCounts[*comment.ParentID] += delta
+	}
+}
+
+func (r *InMemoryRepository) unindexComment(comment *domain.Comment) {
+	if comment.ParentID == nil {
+		r.roots[comment.PostID] = removeSorted(r.roots[comment.PostID], comment, commentBefore)
+	} else {
+		r.replies[*comment.ParentID] = removeSorted(r.replies[*comment.ParentID], comment, commentBefore)
+	}
 }
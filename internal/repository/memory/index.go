@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"OZON/internal/domain"
+	"bytes"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+func postBefore(a, b *domain.Post) bool {
+	return createdBefore(a.CreatedAt, b.CreatedAt, a.ID, b.ID)
+}
+
+func commentBefore(a, b *domain.Comment) bool {
+	return createdBefore(a.CreatedAt, b.CreatedAt, a.ID, b.ID)
+}
+
+// createdBefore orders by creation time and falls back to the ID, which matches
+// the "created_at ASC, id ASC" ordering used by the SQL backends.
+func createdBefore(a, b *time.Time, aID, bID uuid.UUID) bool {
+	if a != nil && b != nil && !a.Equal(*b) {
+		return a.Before(*b)
+	}
+	return bytes.Compare(aID[:], bID[:]) < 0
+}
+
+// insertSorted inserts v into s, which is sorted by before. New items are
+// usually the newest, so appending is checked first.
+func insertSorted[T any](s []T, v T, before func(a, b T) bool) []T {
+	if len(s) == 0 || before(s[len(s)-1], v) {
+		return append(s, v)
+	}
+	i := sort.Search(len(s), func(i int) bool { return before(v, s[i]) })
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+// removeSorted removes v from s, which is sorted by before. v must have the
+// same sort key as when it was inserted.
+func removeSorted[T comparable](s []T, v T, before func(a, b T) bool) []T {
+	i := sort.Search(len(s), func(i int) bool { return !before(s[i], v) })
+	for ; i < len(s); i++ {
+		if s[i] == v {
+			return append(s[:i], s[i+1:]...)
+		}
+	}
+	return s
+}
+
+// pageBounds returns the [start, end) range of a 1-based page over n items and
+// false when the page starts past the end.
+func pageBounds(n int, page, limit int32) (int, int, bool) {
+	start := int(page-1) * int(limit)
+	if start >= n {
+		return 0, 0, false
+	}
+	end := start + int(limit)
+	if end > n {
+		end = n
+	}
+	return start, end, true
+}
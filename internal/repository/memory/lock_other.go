@@ -0,0 +1,15 @@
+//go:build !unix
+
+package memory
+
+import "io"
+
+// lockDir does nothing where flock is unavailable; only one process may use
+// the directory at a time.
+func lockDir(dir string) (io.Closer, error) {
+	return nopCloser{}, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,559 @@
+package memory
+
+import (
+	"OZON/internal/domain"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls when appends to the write-ahead log are flushed to disk.
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs after every write; nothing acknowledged is ever lost.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs in the background every PersistenceOptions.SyncInterval.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+const (
+	snapshotFile    = "snapshot.jsonl"
+	snapshotVersion = 1
+	segmentPrefix   = "wal-"
+	segmentSuffix   = ".log"
+	lockFile        = "LOCK"
+
+	opCreatePost    = "create_post"
+	opCreateComment = "create_comment"
+	// opDeleteComment carries only the comment ID and DeletedAt.
+	opDeleteComment = "delete_comment"
+	// opSetCommentsAllowed carries only the post ID, AllowComments and
+	// UpdatedAt.
+	opSetCommentsAllowed = "set_comments_allowed"
+	// opTouchPost carries only the post ID and UpdatedAt, for imports that
+	// add comments to a post stored before.
+	opTouchPost = "touch_post"
+)
+
+// ErrDirInUse is returned when another process, such as a running server, has
+// the persistence directory open.
+var ErrDirInUse = errors.New("persistence directory is in use by another process")
+
+type PersistenceOptions struct {
+	// Dir holds the snapshot and the log segments. It is created if missing.
+	Dir          string
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+	// SnapshotInterval is the period of automatic compaction; zero disables it
+	// and snapshots are only taken by calling Snapshot.
+	SnapshotInterval time.Duration
+}
+
+// logRecord is one line of a log segment or of the snapshot.
+type logRecord struct {
+	Op      string          `json:"op"`
+	Post    *domain.Post    `json:"post,omitempty"`
+	Comment *domain.Comment `json:"comment,omitempty"`
+}
+
+// snapshotHeader is the first line of the snapshot. Segments up to and including
+// WALSeq are already contained in the snapshot and are not replayed.
+type snapshotHeader struct {
+	Version int   `json:"version"`
+	WALSeq  int64 `json:"walSeq"`
+}
+
+type persistence struct {
+	opts PersistenceOptions
+	// lock keeps other processes out of the directory.
+	lock io.Closer
+
+	// mu serializes writes with their log appends so that the log order always
+	// matches the order in which changes became visible.
+	mu    sync.Mutex
+	seq   int64
+	file  *os.File
+	dirty bool
+
+	snapshotMu sync.Mutex
+	stop       chan struct{}
+	wg         sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewPersistentInMemoryRepository returns an in-memory repository whose writes
+// are appended to a log in opts.Dir. On startup the latest snapshot is loaded
+// and the newer log segments are replayed, so the data survives restarts while
+// reads are still served from memory. The directory is locked until Close,
+// which must be called on shutdown; opening it again before that fails with
+// ErrDirInUse.
+func NewPersistentInMemoryRepository(opts PersistenceOptions) (_ *InMemoryRepository, err error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("persistence directory must be set")
+	}
+	switch opts.Sync {
+	case "":
+		opts.Sync = SyncAlways
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if opts.SyncInterval <= 0 {
+			return nil, fmt.Errorf("sync interval must be positive for the %q policy", SyncInterval)
+		}
+	default:
+		return nil, fmt.Errorf("unknown sync policy %q", opts.Sync)
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create persistence directory: %w", err)
+	}
+	lock, err := lockDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.Close()
+		}
+	}()
+
+	r := NewInMemoryRepository()
+	p := &persistence{opts: opts, lock: lock, stop: make(chan struct{})}
+
+	snapshotSeq, err := r.loadSnapshot(filepath.Join(opts.Dir, snapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	segments, err := listSegments(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	lastSeq := snapshotSeq
+	for _, seq := range segments {
+		if seq > lastSeq {
+			lastSeq = seq
+		}
+		if seq <= snapshotSeq {
+			continue
+		}
+		if err := r.replaySegment(segmentPath(opts.Dir, seq)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Appends always go to a fresh segment so that a torn tail left by a crash
+	// is never followed by new records.
+	if err := p.openSegment(lastSeq + 1); err != nil {
+		return nil, err
+	}
+	r.persistence = p
+
+	if opts.Sync == SyncInterval {
+		p.runEvery(opts.SyncInterval, func() {
+			if err := p.sync(); err != nil {
+				slog.Error("inmemory: failed to sync log", "error", err)
+			}
+		})
+	}
+	if opts.SnapshotInterval > 0 {
+		p.runEvery(opts.SnapshotInterval, func() {
+			if err := r.Snapshot(); err != nil {
+				slog.Error("inmemory: failed to write snapshot", "error", err)
+			}
+		})
+	}
+	return r, nil
+}
+
+// Snapshot writes the current state to a compacted snapshot and removes the log
+// segments it covers. Writes are blocked only while the log is rotated and the
+// state is copied, not while the snapshot is written to disk.
+func (r *InMemoryRepository) Snapshot() error {
+	p := r.persistence
+	if p == nil {
+		return nil
+	}
+	p.snapshotMu.Lock()
+	defer p.snapshotMu.Unlock()
+
+	p.mu.Lock()
+	covered := p.seq
+	if err := p.openSegment(covered + 1); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	records := r.records()
+	p.mu.Unlock()
+
+	if err := writeSnapshot(p.opts.Dir, snapshotHeader{Version: snapshotVersion, WALSeq: covered}, records); err != nil {
+		return err
+	}
+
+	segments, err := listSegments(p.opts.Dir)
+	if err != nil {
+		return err
+	}
+	for _, seq := range segments {
+		if seq <= covered {
+			if err := os.Remove(segmentPath(p.opts.Dir, seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove compacted log segment: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close stops background syncing and snapshotting and flushes the log.
+// It is a no-op for repositories without persistence; calls after the first
+// return the result of the first.
+func (r *InMemoryRepository) Close() error {
+	p := r.persistence
+	if p == nil {
+		return nil
+	}
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		p.wg.Wait()
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		var errs []error
+		if err := p.file.Sync(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to sync log: %w", err))
+		}
+		if err := p.file.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close log: %w", err))
+		}
+		// The log is flushed and closed before another process may open it.
+		if err := p.lock.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to unlock directory: %w", err))
+		}
+		p.closeErr = errors.Join(errs...)
+	})
+	return p.closeErr
+}
+
+// lockWrites serializes a write with the other writes and, when persistence
+// is enabled, with the log.
+func (r *InMemoryRepository) lockWrites() func() {
+	r.writeMu.Lock()
+	if r.persistence == nil {
+		return r.writeMu.Unlock
+	}
+	r.persistence.mu.Lock()
+	return func() {
+		r.persistence.mu.Unlock()
+		r.writeMu.Unlock()
+	}
+}
+
+// appendLog records a change before it is applied. It must be called with the
+// lock returned by lockWrites held.
+func (r *InMemoryRepository) appendLog(rec logRecord) error {
+	if r.persistence == nil {
+		return nil
+	}
+	return r.persistence.append(rec)
+}
+
+func (r *InMemoryRepository) apply(rec logRecord) error {
+	switch rec.Op {
+	case opCreatePost:
+		if rec.Post == nil {
+			return fmt.Errorf("record %q has no post", rec.Op)
+		}
+		r.storePost(rec.Post)
+	case opCreateComment:
+		if rec.Comment == nil {
+			return fmt.Errorf("record %q has no comment", rec.Op)
+		}
+		r.storeComment(rec.Comment)
+	case opDeleteComment:
+		if rec.Comment == nil || rec.Comment.DeletedAt == nil {
+			return fmt.Errorf("record %q has no deleted comment", rec.Op)
+		}
+		if !r.markDeleted(rec.Comment.ID, *rec.Comment.DeletedAt) {
+			return fmt.Errorf("record %q: comment %s not found", rec.Op, rec.Comment.ID)
+		}
+	case opSetCommentsAllowed:
+		if rec.Post == nil || rec.Post.UpdatedAt == nil {
+			return fmt.Errorf("record %q has no post", rec.Op)
+		}
+		if !r.setCommentsAllowed(rec.Post.ID, rec.Post.AllowComments, *rec.Post.UpdatedAt) {
+			return fmt.Errorf("record %q: post %s not found", rec.Op, rec.Post.ID)
+		}
+	case opTouchPost:
+		if rec.Post == nil || rec.Post.UpdatedAt == nil {
+			return fmt.Errorf("record %q has no post", rec.Op)
+		}
+		r.mu.Lock()
+		r.touch(rec.Post.ID, *rec.Post.UpdatedAt)
+		r.mu.Unlock()
+	default:
+		return fmt.Errorf("unknown record %q", rec.Op)
+	}
+	return nil
+}
+
+// records returns the whole state as log records, posts in feed order and each
+// comment after its parent.
+func (r *InMemoryRepository) records() []logRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := make([]logRecord, 0, len(r.posts)+len(r.comments))
+	for _, post := range r.postOrder {
+		postCopy := *post
+		postCopy.Comments = nil
+		updatedAt := r.updatedAt[post.ID]
+		postCopy.UpdatedAt = &updatedAt
+		records = append(records, logRecord{Op: opCreatePost, Post: &postCopy})
+	}
+
+	var walk func(comments []*domain.Comment)
+	walk = func(comments []*domain.Comment) {
+		for _, comment := range comments {
+			commentCopy := *comment
+			commentCopy.Children = nil
+			records = append(records, logRecord{Op: opCreateComment, Comment: &commentCopy})
+			walk(r.replies[comment.ID])
+		}
+	}
+	for _, post := range r.postOrder {
+		walk(r.roots[post.ID])
+	}
+	return records
+}
+
+func (r *InMemoryRepository) loadSnapshot(path string) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	scanner := newRecordScanner(f)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		return 0, fmt.Errorf("snapshot %s is empty", path)
+	}
+	var header snapshotHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return 0, fmt.Errorf("invalid snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+
+	// The snapshot is renamed into place only after it is fully written, so
+	// unlike a log segment it may not end with a partial record.
+	for line := 2; scanner.Scan(); line++ {
+		var rec logRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return 0, fmt.Errorf("snapshot line %d: %w", line, err)
+		}
+		if err := r.apply(rec); err != nil {
+			return 0, fmt.Errorf("snapshot line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return header.WALSeq, nil
+}
+
+func (r *InMemoryRepository) replaySegment(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read log segment: %w", err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		var rec logRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			// A crash during an append leaves an incomplete last line: that
+			// write was never acknowledged, so it is dropped.
+			if i == len(lines)-1 {
+				return nil
+			}
+			return fmt.Errorf("%s line %d: %w", filepath.Base(path), i+1, err)
+		}
+		if err := r.apply(rec); err != nil {
+			return fmt.Errorf("%s line %d: %w", filepath.Base(path), i+1, err)
+		}
+	}
+	return nil
+}
+
+func (p *persistence) append(rec logRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode log record: %w", err)
+	}
+	if _, err := p.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append to log: %w", err)
+	}
+	if p.opts.Sync == SyncAlways {
+		if err := p.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync log: %w", err)
+		}
+		return nil
+	}
+	p.dirty = true
+	return nil
+}
+
+func (p *persistence) sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.dirty {
+		return nil
+	}
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+// openSegment switches appends to segment seq. Must be called with mu held
+// (or before the repository is shared).
+func (p *persistence) openSegment(seq int64) error {
+	f, err := os.OpenFile(segmentPath(p.opts.Dir, seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log segment: %w", err)
+	}
+	if err := syncDir(p.opts.Dir); err != nil {
+		f.Close()
+		return err
+	}
+	if p.file != nil {
+		if err := p.file.Sync(); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to sync log: %w", err)
+		}
+		p.file.Close()
+	}
+	p.file = f
+	p.seq = seq
+	p.dirty = false
+	return nil
+}
+
+func (p *persistence) runEvery(interval time.Duration, fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+func writeSnapshot(dir string, header snapshotHeader, records []logRecord) error {
+	tmp, err := os.CreateTemp(dir, snapshotFile+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, snapshotFile)); err != nil {
+		return fmt.Errorf("failed to install snapshot: %w", err)
+	}
+	return syncDir(dir)
+}
+
+func listSegments(dir string) ([]int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log segments: %w", err)
+	}
+	var segments []int64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func segmentPath(dir string, seq int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+func newRecordScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return scanner
+}
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"OZON/internal/repository/backend"
+	"OZON/pkg/storage"
+	"context"
+)
+
+func init() {
+	backend.Register("postgres", open)
+}
+
+func open(settings backend.Settings) (*backend.Storage, error) {
+	db, err := storage.OpenPostgresConfig(storage.PostgresConfig{
+		ConnString:      settings.PostgresURL,
+		MaxOpenConns:    settings.PostgresMaxOpenConns,
+		MaxIdleConns:    settings.PostgresMaxIdleConns,
+		ConnMaxLifetime: settings.PostgresConnMaxLifetime,
+		ConnMaxIdleTime: settings.PostgresConnMaxIdleTime,
+		NoMigrate:       settings.PostgresNoMigrate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m, err := db.Migrator()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// The server is ready while the database answers and every migration it
+	// knows about is applied; a rollback of the schema makes it unready.
+	check := func(ctx context.Context) error {
+		if err := db.Ping(ctx); err != nil {
+			return err
+		}
+		return m.Check(ctx)
+	}
+	pool, err := db.DB.DB()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	repo := NewPostgresRepository(*db)
+	s := backend.NewStorage(repo, repo, check, db.Close)
+	s.Pool = pool
+	s.Importer = repo
+	return s, nil
+}
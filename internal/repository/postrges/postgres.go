@@ -2,14 +2,21 @@ package postgres
 
 import (
 	"OZON/internal/domain"
+	"OZON/internal/repository"
 	"OZON/pkg/storage"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
+// importBatchSize is the number of rows of one INSERT statement of Import,
+// well below the bind parameter limits of Postgres and SQLite.
+const importBatchSize = 500
+
 type PostgresRepository struct {
 	db storage.DB
 }
@@ -20,25 +27,26 @@ func NewPostgresRepository(db storage.DB) *PostgresRepository {
 
 func (p *PostgresRepository) GetPost(ctx context.Context, id uuid.UUID, commentPage, commentLimit int32) (*domain.Post, error) {
 	var post domain.Post
-	offset := (commentPage - 1) * commentLimit
 
 	if commentPage <= 0 {
-		return nil, fmt.Errorf("comment page must be greater than 0")
+		return nil, domain.NewValidationError("commentPage", "comment page must be greater than 0")
 	}
 	if commentLimit <= 0 {
-		return nil, fmt.Errorf("comment limit must be greater than or equal to 0")
+		return nil, domain.NewValidationError("commentLimit", "comment limit must be greater than or equal to 0")
 	}
 
-	if err := p.db.WithContext(ctx).Where("id = ?", id).Preload("Comments", func(db *gorm.DB) *gorm.DB {
-		return db.Where("post_id = ?", id).Order("created_at").Limit(int(commentLimit)).Offset(int(offset))
-	}).First(&post).Error; err != nil {
+	if err := p.db.WithContext(ctx).Where("id = ?", id).First(&post).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("post not found")
+			return nil, domain.ErrPostNotFound
 		}
-		return nil, fmt.Errorf("failed to get post: %v", err)
+		return nil, fmt.Errorf("failed to get post: %w", err)
 	}
 
-	post.Comments = buildCommentTree(post.Comments, id)
+	comments, err := p.getCommentsForPost(ctx, id, commentPage, commentLimit)
+	if err != nil {
+		return nil, err
+	}
+	post.Comments = comments
 	return &post, nil
 }
 
@@ -56,42 +64,33 @@ func (p *PostgresRepository) CreatePost(ctx context.Context, post *domain.Post,
 		allow = *allowComments
 	}
 	post.AllowComments = allow
+	post.CommentCount = 0
+	updatedAt := *post.CreatedAt
+	post.UpdatedAt = &updatedAt
 
 	if err := p.db.WithContext(ctx).Create(post).Error; err != nil {
-		return nil, fmt.Errorf("failed to create post: %v", err)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, domain.NewConflictError(fmt.Sprintf("post %s already exists", post.ID))
+		}
+		return nil, fmt.Errorf("failed to create post: %w", err)
 	}
 
 	return post, nil
 }
 
 func (p *PostgresRepository) GetPosts(ctx context.Context, page, limit int32) ([]*domain.Post, error) {
-	var posts []*domain.Post
+	posts := make([]*domain.Post, 0)
 	offset := (page - 1) * limit
 
 	if page <= 0 {
-		return nil, fmt.Errorf("page must be greater than 0")
+		return nil, domain.NewValidationError("page", "page must be greater than 0")
 	}
 	if limit <= 0 {
-		return nil, fmt.Errorf("limit must be greater than or equal to 0")
-	}
-
-	var postIDs []uuid.UUID
-	if err := p.db.WithContext(ctx).Model(&domain.Post{}).Order("created_at ASC, id ASC").Limit(int(limit)).Offset(int(offset)).Pluck("id", &postIDs).Error; err != nil {
-		return nil, fmt.Errorf("failed to get post IDs: %v", err)
-	}
-
-	if err := p.db.WithContext(ctx).Where("id IN (?)", postIDs).Order("created_at ASC, id ASC").
-		Preload("Comments", func(db *gorm.DB) *gorm.DB {
-			return db.Where("post_id IN (?)", postIDs).Order("created_at ASC, id ASC")
-		}).Find(&posts).Error; err != nil {
-		return nil, fmt.Errorf("failed to get posts: %v", err)
+		return nil, domain.NewValidationError("limit", "limit must be greater than or equal to 0")
 	}
 
-	for i := range posts {
-		posts[i].Comments = buildCommentTree(posts[i].Comments, posts[i].ID)
-	}
-	if len(posts) == 0 {
-		return nil, fmt.Errorf("posts not found")
+	if err := p.db.WithContext(ctx).Order("created_at ASC, id ASC").Limit(int(limit)).Offset(int(offset)).Find(&posts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get posts: %w", err)
 	}
 
 	return posts, nil
@@ -101,68 +100,413 @@ func (p *PostgresRepository) IsCommentsAllowed(ctx context.Context, postID uuid.
 	var post domain.Post
 	if err := p.db.WithContext(ctx).Select("allow_comments").Where("id = ?", postID).First(&post).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return false, fmt.Errorf("post not found")
+			return false, domain.ErrPostNotFound
 		}
-		return false, fmt.Errorf("failed to check comments allowed: %v", err)
+		return false, fmt.Errorf("failed to check comments allowed: %w", err)
 	}
 	return post.AllowComments, nil
 }
 
+func (p *PostgresRepository) SetCommentsAllowed(ctx context.Context, postID uuid.UUID, allowed bool) error {
+	res := p.db.WithContext(ctx).Model(&domain.Post{}).Where("id = ? AND allow_comments <> ?", postID, allowed).Updates(map[string]interface{}{
+		"allow_comments": allowed,
+		"updated_at":     time.Now().UTC(),
+	})
+	if res.Error != nil {
+		return fmt.Errorf("failed to set comments allowed: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		// Either the post is missing or it already has the value.
+		_, err := p.IsCommentsAllowed(ctx, postID)
+		return err
+	}
+	return nil
+}
+
+func (p *PostgresRepository) LastModified(ctx context.Context, postID uuid.UUID) (time.Time, error) {
+	var post domain.Post
+	res := p.db.WithContext(ctx).Model(&domain.Post{}).Select("updated_at").Where("id = ?", postID).Limit(1).Find(&post)
+	if res.Error != nil {
+		return time.Time{}, fmt.Errorf("failed to get last modification: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return time.Time{}, domain.ErrPostNotFound
+	}
+	return *post.UpdatedAt, nil
+}
+
+// FeedVersion reads the counter that a trigger on posts bumps, see migration
+// 0006.
+func (p *PostgresRepository) FeedVersion(ctx context.Context) (int64, error) {
+	var version int64
+	if err := p.db.WithContext(ctx).Raw("SELECT version FROM feed_version").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to get feed version: %w", err)
+	}
+	return version, nil
+}
+
+// CreateComment checks the post and the parent in the transaction that stores
+// the comment, with their rows locked, so that a concurrent SetCommentsAllowed
+// or DeleteComment either waits for the comment or is seen by the checks.
 func (p *PostgresRepository) CreateComment(ctx context.Context, comment *domain.Comment) (*domain.Comment, error) {
 	comment.ID = uuid.New()
-	if comment.ParentID != nil {
-		var exists bool
-		if err := p.db.WithContext(ctx).Model(&domain.Comment{}).Select("count(*) > 0").Where("id = ?", comment.ParentID).Find(&exists).Error; err != nil {
-			return nil, fmt.Errorf("failed to check parent comment existence: %v", err)
+	comment.ReplyCount = 0
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var post domain.Post
+		if err := forUpdate(tx).Select("allow_comments").Where("id = ?", comment.PostID).First(&post).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrPostNotFound
+			}
+			return fmt.Errorf("failed to check comments allowed: %w", err)
 		}
-		if !exists {
-			return nil, fmt.Errorf("parent comment with ID %s does not exist", comment.ParentID)
+		if !post.AllowComments {
+			return domain.ErrCommentsDisabled
+		}
+		if comment.ParentID != nil {
+			if err := repository.ValidateParent(ctx, lockedComments{p, tx}, comment.PostID, *comment.ParentID, 0); err != nil {
+				return err
+			}
 		}
 
-		var parentComment domain.Comment
-		if err := p.db.WithContext(ctx).Where("id = ?", comment.ParentID).First(&parentComment).Error; err != nil {
-			return nil, fmt.Errorf("failed to retrieve parent comment: %v", err)
+		if err := tx.Create(comment).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return domain.NewConflictError(fmt.Sprintf("comment %s already exists", comment.ID))
+			}
+			return fmt.Errorf("failed to create comment: %w", err)
 		}
-		if parentComment.PostID != comment.PostID {
-			return nil, fmt.Errorf("parent comment with ID %s belongs to a different post", comment.ParentID)
+		if err := adjustCounters(tx, comment.PostID, comment.ParentID, 1); err != nil {
+			return fmt.Errorf("failed to create comment: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// forUpdate locks the rows a query reads until the transaction ends. Writers
+// lock the post before its comments, so that they never wait for each other
+// in a cycle. SQLite already serializes transactions.
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	if tx.Dialector.Name() != "postgres" {
+		return tx
 	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
 
-	if err := p.db.WithContext(ctx).Create(comment).Error; err != nil {
-		return nil, fmt.Errorf("failed to create comment: %v", err)
+// lockedComments reads comments with forUpdate within a transaction.
+type lockedComments struct {
+	*PostgresRepository
+	tx *gorm.DB
+}
+
+func (r lockedComments) GetComment(ctx context.Context, id uuid.UUID) (*domain.Comment, error) {
+	var comment domain.Comment
+	if err := forUpdate(r.tx).Where("id = ?", id).First(&comment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrCommentNotFound
+		}
+		return nil, fmt.Errorf("failed to get comment: %w", err)
 	}
+	return &comment, nil
+}
 
-	return comment, nil
+func (p *PostgresRepository) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var comment domain.Comment
+		if err := tx.Select("post_id", "parent_id").Where("id = ?", id).First(&comment).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return domain.ErrCommentNotFound
+			}
+			return fmt.Errorf("failed to get comment: %w", err)
+		}
+		// The post is locked first, like CreateComment does.
+		var post domain.Post
+		if err := forUpdate(tx).Select("id").Where("id = ?", comment.PostID).First(&post).Error; err != nil {
+			return fmt.Errorf("failed to lock post: %w", err)
+		}
+
+		// The conditional update lets only one of concurrent deletes through.
+		res := tx.Model(&domain.Comment{}).Where("id = ? AND deleted_at IS NULL", id).Update("deleted_at", time.Now().UTC())
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete comment: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		if err := adjustCounters(tx, comment.PostID, comment.ParentID, -1); err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+		return nil
+	})
 }
 
-func (p *PostgresRepository) GetCommentsForPost(ctx context.Context, postID uuid.UUID, page, limit int32) ([]*domain.Comment, error) {
-	var comments []*domain.Comment
-	offset := (page - 1) * limit
+// adjustCounters adds delta to the comment count of the post and the reply
+// count of the parent, and moves the UpdatedAt of the post. Both are single
+// UPDATE statements, so concurrent writers never lose an increment.
+func adjustCounters(tx *gorm.DB, postID uuid.UUID, parentID *uuid.UUID, delta int) error {
+	if err := tx.Model(&domain.Post{}).Where("id = ?", postID).Updates(map[string]interface{}{
+		"comment_count": gorm.Expr("comment_count + ?", delta),
+		"updated_at":    time.Now().UTC(),
+	}).Error; err != nil {
+		return err
+	}
+	if parentID == nil {
+		return nil
+	}
+	return tx.Model(&domain.Comment{}).Where("id = ?", *parentID).
+		Update("reply_count", gorm.Expr("reply_count + ?", delta)).Error
+}
 
+func (p *PostgresRepository) RebuildCounters(ctx context.Context) (int64, error) {
+	var repaired int64
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Block comment writes so that no increment lands between counting and
+		// storing the result. SQLite already serializes transactions.
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("LOCK TABLE comments IN SHARE MODE").Error; err != nil {
+				return err
+			}
+		}
+
+		const liveComments = `(SELECT count(*) FROM comments c WHERE c.post_id = posts.id AND c.deleted_at IS NULL)`
+		res := tx.Exec(`UPDATE posts SET comment_count = `+liveComments+`, updated_at = ? WHERE comment_count <> `+liveComments, time.Now().UTC())
+		if res.Error != nil {
+			return res.Error
+		}
+		repaired += res.RowsAffected
+
+		const liveReplies = `(SELECT count(*) FROM comments r WHERE r.parent_id = comments.id AND r.deleted_at IS NULL)`
+		res = tx.Exec(`UPDATE comments SET reply_count = ` + liveReplies + ` WHERE reply_count <> ` + liveReplies)
+		if res.Error != nil {
+			return res.Error
+		}
+		repaired += res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild counters: %w", err)
+	}
+	return repaired, nil
+}
+
+// Import inserts the new rows in batches, with their counters computed up
+// front, and adjusts the counters of the rows stored before in one statement
+// each. Rows are skipped if their ID is stored when the batch starts; rows
+// inserted concurrently by another import are skipped by the conflict clause,
+// but their counters may then be counted twice until RebuildCounters.
+func (p *PostgresRepository) Import(ctx context.Context, posts []*domain.Post, comments []*domain.Comment) (repository.ImportResult, error) {
+	var result repository.ImportResult
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		postIDs := make([]uuid.UUID, len(posts))
+		for i, post := range posts {
+			postIDs[i] = post.ID
+		}
+		storedPosts, err := storedIDs(tx, "posts", postIDs)
+		if err != nil {
+			return err
+		}
+		commentIDs := make([]uuid.UUID, len(comments))
+		for i, comment := range comments {
+			commentIDs[i] = comment.ID
+		}
+		storedComments, err := storedIDs(tx, "comments", commentIDs)
+		if err != nil {
+			return err
+		}
+
+		// The changes the new comments make to their posts and parents.
+		commentCounts := make(map[uuid.UUID]int)
+		replyCounts := make(map[uuid.UUID]int)
+		latest := make(map[uuid.UUID]time.Time)
+		newComments := make([]*domain.Comment, 0, len(comments))
+		for _, comment := range comments {
+			if storedComments[comment.ID] {
+				continue
+			}
+			if !comment.IsDeleted() {
+				commentCounts[comment.PostID]++
+				if comment.ParentID != nil {
+					replyCounts[*comment.ParentID]++
+				}
+			}
+			for _, t := range []*time.Time{comment.CreatedAt, comment.DeletedAt} {
+				if t != nil && t.After(latest[comment.PostID]) {
+					latest[comment.PostID] = *t
+				}
+			}
+			newComments = append(newComments, comment)
+		}
+
+		newPosts := make([]*domain.Post, 0, len(posts))
+		for _, post := range posts {
+			if storedPosts[post.ID] {
+				continue
+			}
+			row := *post
+			row.Comments = nil
+			row.CommentCount = commentCounts[post.ID]
+			updatedAt := *post.CreatedAt
+			if post.UpdatedAt != nil {
+				updatedAt = *post.UpdatedAt
+			}
+			if t := latest[post.ID]; t.After(updatedAt) {
+				updatedAt = t
+			}
+			row.UpdatedAt = &updatedAt
+			delete(commentCounts, post.ID)
+			delete(latest, post.ID)
+			newPosts = append(newPosts, &row)
+		}
+		rows := make([]*domain.Comment, len(newComments))
+		for i, comment := range newComments {
+			row := *comment
+			row.Children = nil
+			row.ReplyCount = replyCounts[comment.ID]
+			delete(replyCounts, comment.ID)
+			rows[i] = &row
+		}
+
+		if len(newPosts) > 0 {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(newPosts, importBatchSize)
+			if res.Error != nil {
+				return fmt.Errorf("failed to import posts: %w", res.Error)
+			}
+			// Which rows a conflict skipped is not reported, and the result
+			// must list the stored posts exactly.
+			if int(res.RowsAffected) != len(newPosts) {
+				return domain.NewConflictError("posts of the batch were stored concurrently, repeat the import")
+			}
+			for _, post := range newPosts {
+				result.PostIDs = append(result.PostIDs, post.ID)
+			}
+		}
+		if len(rows) > 0 {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, importBatchSize)
+			if res.Error != nil {
+				return fmt.Errorf("failed to import comments: %w", res.Error)
+			}
+			result.Comments = int(res.RowsAffected)
+		}
+
+		// What is left belongs to rows stored before this batch.
+		listed := make(map[uuid.UUID]bool, len(posts))
+		for _, post := range posts {
+			listed[post.ID] = true
+		}
+		now := time.Now().UTC()
+		for postID, t := range latest {
+			updatedAt := now
+			if listed[postID] {
+				var post domain.Post
+				if err := tx.Select("updated_at").Where("id = ?", postID).Take(&post).Error; err != nil {
+					return fmt.Errorf("failed to import comments: %w", err)
+				}
+				updatedAt = t
+				if post.UpdatedAt != nil && post.UpdatedAt.After(t) {
+					updatedAt = *post.UpdatedAt
+				}
+			}
+			if err := tx.Model(&domain.Post{}).Where("id = ?", postID).Updates(map[string]interface{}{
+				"comment_count": gorm.Expr("comment_count + ?", commentCounts[postID]),
+				"updated_at":    updatedAt,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to import comments: %w", err)
+			}
+		}
+		for parentID, n := range replyCounts {
+			if err := tx.Model(&domain.Comment{}).Where("id = ?", parentID).
+				Update("reply_count", gorm.Expr("reply_count + ?", n)).Error; err != nil {
+				return fmt.Errorf("failed to import comments: %w", err)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// storedIDs returns which of ids are stored in table.
+func storedIDs(tx *gorm.DB, table string, ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	stored := make(map[uuid.UUID]bool)
+	for start := 0; start < len(ids); start += importBatchSize {
+		var found []uuid.UUID
+		chunk := ids[start:min(start+importBatchSize, len(ids))]
+		if err := tx.Table(table).Where("id IN ?", chunk).Pluck("id", &found).Error; err != nil {
+			return nil, fmt.Errorf("failed to look up %s: %w", table, err)
+		}
+		for _, id := range found {
+			stored[id] = true
+		}
+	}
+	return stored, nil
+}
+
+func (p *PostgresRepository) GetComment(ctx context.Context, id uuid.UUID) (*domain.Comment, error) {
+	var comment domain.Comment
+	if err := p.db.WithContext(ctx).Where("id = ?", id).First(&comment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, domain.ErrCommentNotFound
+		}
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+	return &comment, nil
+}
+
+func (p *PostgresRepository) GetCommentsForPost(ctx context.Context, postID uuid.UUID, page, limit int32) ([]*domain.Comment, error) {
 	var exists bool
 	if err := p.db.WithContext(ctx).Model(&domain.Post{}).Select("count(*) > 0").Where("id = ? ", postID).Find(&exists).Error; err != nil {
-		return nil, fmt.Errorf("failed to check post existence: %v", err)
+		return nil, fmt.Errorf("failed to check post existence: %w", err)
 	}
 	if !exists {
-		return nil, fmt.Errorf("post not found")
+		return nil, domain.ErrPostNotFound
 	}
 
 	if page <= 0 {
-		return nil, fmt.Errorf("page must be greater than 0")
+		return nil, domain.NewValidationError("page", "page must be greater than 0")
 	}
 	if limit < 0 {
-		return nil, fmt.Errorf("limit must be greater than or equal to 0")
+		return nil, domain.NewValidationError("limit", "limit must be greater than or equal to 0")
+	}
+
+	return p.getCommentsForPost(ctx, postID, page, limit)
+}
+
+// getCommentsForPost paginates over the root comments of a post and loads the
+// whole reply tree of every root on the page with a single recursive query.
+func (p *PostgresRepository) getCommentsForPost(ctx context.Context, postID uuid.UUID, page, limit int32) ([]*domain.Comment, error) {
+	var roots []*domain.Comment
+	offset := (page - 1) * limit
+
+	if err := p.db.WithContext(ctx).Where("post_id = ? AND parent_id IS NULL", postID).Order("created_at ASC, id ASC").
+		Limit(int(limit)).Offset(int(offset)).Find(&roots).Error; err != nil {
+		return nil, fmt.Errorf("failed to get comments: %w", err)
+	}
+	if len(roots) == 0 {
+		return make([]*domain.Comment, 0), nil
+	}
+
+	rootIDs := make([]uuid.UUID, 0, len(roots))
+	for _, root := range roots {
+		rootIDs = append(rootIDs, root.ID)
 	}
 
-	if err := p.db.WithContext(ctx).Where("post_id = ?", postID).Order("created_at").Limit(int(limit)).Offset(int(offset)).Find(&comments).Error; err != nil {
-		return nil, fmt.Errorf("failed to get comments: %v", err)
+	var replies []*domain.Comment
+	if err := p.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE thread AS (
+			SELECT * FROM comments WHERE parent_id IN (?)
+			UNION ALL
+			SELECT c.* FROM comments c JOIN thread t ON c.parent_id = t.id
+		)
+		SELECT * FROM thread ORDER BY created_at ASC, id ASC`, rootIDs).Scan(&replies).Error; err != nil {
+		return nil, fmt.Errorf("failed to get replies: %w", err)
 	}
 
-	return buildCommentTree(comments, postID), nil
+	return buildCommentTree(append(roots, replies...), postID), nil
 }
 
 func buildCommentTree(comments []*domain.Comment, postID uuid.UUID) []*domain.Comment {
-	var rootComments []*domain.Comment
+	rootComments := make([]*domain.Comment, 0)
 	mapComments := make(map[string]*domain.Comment)
 
 	for _, value := range comments {
@@ -4,6 +4,7 @@ import (
 	"OZON/internal/domain"
 	"context"
 	"github.com/google/uuid"
+	"time"
 )
 
 type PostRepository interface {
@@ -11,9 +12,48 @@ type PostRepository interface {
 	GetPosts(ctx context.Context, page, limit int32) ([]*domain.Post, error)
 	CreatePost(ctx context.Context, post *domain.Post, allowComments *bool) (*domain.Post, error)
 	IsCommentsAllowed(ctx context.Context, postID uuid.UUID) (bool, error)
+	// SetCommentsAllowed opens or closes a post for new comments; existing
+	// comments stay. A change moves UpdatedAt, setting the current value
+	// does nothing.
+	SetCommentsAllowed(ctx context.Context, postID uuid.UUID, allowed bool) error
+	// LastModified returns the UpdatedAt of a post.
+	LastModified(ctx context.Context, postID uuid.UUID) (time.Time, error)
+	// FeedVersion returns a number that grows with every change of any post,
+	// in the order in which the changes become visible to readers; 0 when
+	// nothing was ever stored. Unlike the timestamps it does not depend on
+	// the clocks of the writers.
+	FeedVersion(ctx context.Context) (int64, error)
 }
 
 type CommentRepository interface {
 	CreateComment(ctx context.Context, comment *domain.Comment) (*domain.Comment, error)
+	GetComment(ctx context.Context, id uuid.UUID) (*domain.Comment, error)
 	GetCommentsForPost(ctx context.Context, postID uuid.UUID, page, limit int32) ([]*domain.Comment, error)
+	// DeleteComment soft-deletes a comment: it stays in its thread with
+	// DeletedAt set and no longer counts towards the counters. Deleting a
+	// deleted comment does nothing.
+	DeleteComment(ctx context.Context, id uuid.UUID) error
+	// RebuildCounters recomputes CommentCount and ReplyCount from the stored
+	// comments and returns how many counters were wrong.
+	RebuildCounters(ctx context.Context) (int64, error)
+}
+
+// Importer stores posts and comments as they are, with their IDs, parent
+// links and timestamps, to move data between stores. Rows whose ID is already
+// stored are skipped, so an import can be repeated.
+type Importer interface {
+	// Import stores a batch. The post and parent of every comment must be in
+	// the batch or already stored, and parents must come before their
+	// replies; the counters are derived from the comments. The posts of the
+	// batch keep their UpdatedAt unless one of their comments is newer, also
+	// when they were already stored and only their comments are new; a post
+	// that is not in the batch and receives comments is updated now.
+	Import(ctx context.Context, posts []*domain.Post, comments []*domain.Comment) (ImportResult, error)
+}
+
+// ImportResult reports the rows an import stored; the others were skipped.
+type ImportResult struct {
+	// PostIDs lists the posts that were stored, in the order of the batch.
+	PostIDs  []uuid.UUID
+	Comments int
 }
@@ -0,0 +1,821 @@
+// Package repotest is a conformance suite for storage backends. Every
+// implementation of repository.PostRepository and repository.CommentRepository
+// runs the same behavioural tests through Run, so a new backend can prove that
+// it is a drop-in replacement for the existing ones.
+package repotest
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory returns repositories backed by a fresh, empty store. It is called once
+// per test case; cleanup should be registered with t.Cleanup.
+type Factory func(t *testing.T) (repository.PostRepository, repository.CommentRepository)
+
+// Run executes the whole suite against the backend produced by newRepos.
+func Run(t *testing.T, newRepos Factory) {
+	cases := []struct {
+		name string
+		fn   func(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository)
+	}{
+		{"CreateAndGetPost", testCreateAndGetPost},
+		{"GetPostNotFound", testGetPostNotFound},
+		{"PostsOrdering", testPostsOrdering},
+		{"PostsPaginationEdges", testPostsPaginationEdges},
+		{"IsCommentsAllowed", testIsCommentsAllowed},
+		{"SetCommentsAllowed", testSetCommentsAllowed},
+		{"GetComment", testGetComment},
+		{"RootCommentPagination", testRootCommentPagination},
+		{"CommentsPaginationEdges", testCommentsPaginationEdges},
+		{"CommentTree", testCommentTree},
+		{"GetPostIncludesCommentTree", testGetPostIncludesCommentTree},
+		{"ParentValidation", testParentValidation},
+		{"CommentsDisabled", testCommentsDisabled},
+		{"ConcurrentComments", testConcurrentComments},
+		{"Counters", testCounters},
+		{"DeleteComment", testDeleteComment},
+		{"ConcurrentCounters", testConcurrentCounters},
+		{"ReplyRacesDelete", testReplyRacesDelete},
+		{"LastModified", testLastModified},
+		{"FeedVersion", testFeedVersion},
+		{"Import", testImport},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			posts, comments := newRepos(t)
+			tc.fn(t, posts, comments)
+		})
+	}
+}
+
+var base = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func at(offset time.Duration) *time.Time {
+	ts := base.Add(offset)
+	return &ts
+}
+
+func mustCreatePost(t *testing.T, repo repository.PostRepository, text string, createdAt *time.Time, allow bool) *domain.Post {
+	t.Helper()
+	post, err := repo.CreatePost(context.Background(), &domain.Post{Text: text, CreatedAt: createdAt}, &allow)
+	if err != nil {
+		t.Fatalf("failed to create post %q: %v", text, err)
+	}
+	return post
+}
+
+func mustCreateComment(t *testing.T, repo repository.CommentRepository, postID uuid.UUID, parentID *uuid.UUID, text string, createdAt *time.Time) *domain.Comment {
+	t.Helper()
+	comment, err := repo.CreateComment(context.Background(), &domain.Comment{
+		PostID:    postID,
+		ParentID:  parentID,
+		Text:      text,
+		CreatedAt: createdAt,
+	})
+	if err != nil {
+		t.Fatalf("failed to create comment %q: %v", text, err)
+	}
+	return comment
+}
+
+func texts(comments []*domain.Comment) []string {
+	out := make([]string, 0, len(comments))
+	for _, c := range comments {
+		out = append(out, c.Text)
+	}
+	return out
+}
+
+func expectTexts(t *testing.T, what string, got []*domain.Comment, want ...string) {
+	t.Helper()
+	if fmt.Sprint(texts(got)) != fmt.Sprint(want) {
+		t.Errorf("%s: got %v, want %v", what, texts(got), want)
+	}
+}
+
+func testCreateAndGetPost(t *testing.T, posts repository.PostRepository, _ repository.CommentRepository) {
+	created := mustCreatePost(t, posts, "Test Post", nil, true)
+	if created.ID == uuid.Nil || created.CreatedAt == nil {
+		t.Fatalf("CreatePost must assign ID and CreatedAt, got %+v", created)
+	}
+
+	got, err := posts.GetPost(context.Background(), created.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get post: %v", err)
+	}
+	if got.ID != created.ID || got.Text != "Test Post" || !got.AllowComments {
+		t.Errorf("unexpected post: got %+v, want %+v", got, created)
+	}
+	if len(got.Comments) != 0 {
+		t.Errorf("expected no comments, got %d", len(got.Comments))
+	}
+}
+
+func testGetPostNotFound(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	if _, err := posts.GetPost(context.Background(), uuid.New(), 1, 10); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetPost: expected ErrNotFound, got %v", err)
+	}
+	if _, err := posts.IsCommentsAllowed(context.Background(), uuid.New()); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("IsCommentsAllowed: expected ErrNotFound, got %v", err)
+	}
+	if _, err := comments.GetCommentsForPost(context.Background(), uuid.New(), 1, 10); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetCommentsForPost: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testPostsOrdering(t *testing.T, posts repository.PostRepository, _ repository.CommentRepository) {
+	// Created out of order on purpose: the result must follow created_at, not insertion order.
+	mustCreatePost(t, posts, "Post 2", at(2*time.Second), true)
+	mustCreatePost(t, posts, "Post 0", at(0), true)
+	mustCreatePost(t, posts, "Post 1", at(time.Second), true)
+
+	got, err := posts.GetPosts(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get posts: %v", err)
+	}
+	var gotTexts []string
+	for _, p := range got {
+		gotTexts = append(gotTexts, p.Text)
+	}
+	if fmt.Sprint(gotTexts) != "[Post 0 Post 1 Post 2]" {
+		t.Errorf("unexpected order: %v", gotTexts)
+	}
+}
+
+func testPostsPaginationEdges(t *testing.T, posts repository.PostRepository, _ repository.CommentRepository) {
+	for i := 0; i < 5; i++ {
+		mustCreatePost(t, posts, fmt.Sprintf("Post %d", i), at(time.Duration(i)*time.Second), true)
+	}
+
+	pages := []struct {
+		page, limit int32
+		want        []string
+	}{
+		{1, 2, []string{"Post 0", "Post 1"}},
+		{2, 2, []string{"Post 2", "Post 3"}},
+		{3, 2, []string{"Post 4"}},
+		{4, 2, []string{}},
+		{1, 5, []string{"Post 0", "Post 1", "Post 2", "Post 3", "Post 4"}},
+		{1, 100, []string{"Post 0", "Post 1", "Post 2", "Post 3", "Post 4"}},
+	}
+	for _, p := range pages {
+		got, err := posts.GetPosts(context.Background(), p.page, p.limit)
+		if err != nil {
+			t.Fatalf("page %d limit %d: %v", p.page, p.limit, err)
+		}
+		gotTexts := make([]string, 0, len(got))
+		for _, post := range got {
+			gotTexts = append(gotTexts, post.Text)
+		}
+		if fmt.Sprint(gotTexts) != fmt.Sprint(p.want) {
+			t.Errorf("page %d limit %d: got %v, want %v", p.page, p.limit, gotTexts, p.want)
+		}
+	}
+
+	if _, err := posts.GetPosts(context.Background(), 0, 2); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("page 0: expected ErrValidation, got %v", err)
+	}
+	if _, err := posts.GetPosts(context.Background(), 1, -1); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("limit -1: expected ErrValidation, got %v", err)
+	}
+}
+
+func testIsCommentsAllowed(t *testing.T, posts repository.PostRepository, _ repository.CommentRepository) {
+	defaultPost, err := posts.CreatePost(context.Background(), &domain.Post{Text: "Default"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	closed := mustCreatePost(t, posts, "Closed", nil, false)
+
+	allowed, err := posts.IsCommentsAllowed(context.Background(), defaultPost.ID)
+	if err != nil || !allowed {
+		t.Errorf("comments must be allowed by default, got %v, %v", allowed, err)
+	}
+	allowed, err = posts.IsCommentsAllowed(context.Background(), closed.ID)
+	if err != nil || allowed {
+		t.Errorf("comments must be disabled, got %v, %v", allowed, err)
+	}
+}
+
+// testSetCommentsAllowed checks that closing a post keeps its comments, rejects
+// new ones and moves UpdatedAt, and that reopening accepts them again.
+func testSetCommentsAllowed(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	ctx := context.Background()
+	post := mustCreatePost(t, posts, "Post", at(0), true)
+	mustCreateComment(t, comments, post.ID, nil, "Before", nil)
+	before := mustGetPost(t, posts, post.ID).UpdatedAt
+
+	if err := posts.SetCommentsAllowed(ctx, post.ID, false); err != nil {
+		t.Fatalf("failed to close comments: %v", err)
+	}
+	closed := mustGetPost(t, posts, post.ID)
+	if closed.AllowComments || closed.CommentCount != 1 || len(closed.Comments) != 1 {
+		t.Errorf("expected a closed post with its comment, got %+v", closed)
+	}
+	if closed.UpdatedAt == nil || closed.UpdatedAt.Before(*before) {
+		t.Errorf("closing must not move UpdatedAt back, got %v after %v", closed.UpdatedAt, before)
+	}
+	if _, err := comments.CreateComment(ctx, &domain.Comment{PostID: post.ID, Text: "After"}); !errors.Is(err, domain.ErrCommentsDisabled) {
+		t.Errorf("expected ErrCommentsDisabled, got %v", err)
+	}
+	if err := posts.SetCommentsAllowed(ctx, post.ID, false); err != nil {
+		t.Errorf("closing a closed post must succeed, got %v", err)
+	}
+
+	if err := posts.SetCommentsAllowed(ctx, post.ID, true); err != nil {
+		t.Fatalf("failed to open comments: %v", err)
+	}
+	mustCreateComment(t, comments, post.ID, nil, "Reopened", nil)
+
+	if err := posts.SetCommentsAllowed(ctx, uuid.New(), false); !errors.Is(err, domain.ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+	}
+}
+
+func testGetComment(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Post", nil, true)
+	root := mustCreateComment(t, comments, post.ID, nil, "Root", nil)
+	reply := mustCreateComment(t, comments, post.ID, &root.ID, "Reply", nil)
+
+	got, err := comments.GetComment(context.Background(), reply.ID)
+	if err != nil {
+		t.Fatalf("failed to get comment: %v", err)
+	}
+	if got.ID != reply.ID || got.PostID != post.ID || got.ParentID == nil || *got.ParentID != root.ID || got.Text != "Reply" {
+		t.Errorf("unexpected comment: %+v", got)
+	}
+
+	if _, err := comments.GetComment(context.Background(), uuid.New()); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testRootCommentPagination(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Post", nil, true)
+	for i := 0; i < 5; i++ {
+		root := mustCreateComment(t, comments, post.ID, nil, fmt.Sprintf("Root %d", i), at(time.Duration(4-i)*time.Minute))
+		mustCreateComment(t, comments, post.ID, &root.ID, fmt.Sprintf("Reply %d", i), at(time.Duration(4-i)*time.Minute+time.Second))
+	}
+
+	// Pages are made of root comments only; replies come with their root and do
+	// not consume the limit.
+	got, err := comments.GetCommentsForPost(context.Background(), post.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to get comments: %v", err)
+	}
+	expectTexts(t, "page 1", got, "Root 4", "Root 3")
+	for _, root := range got {
+		if len(root.Children) != 1 {
+			t.Errorf("%s: expected 1 reply, got %d", root.Text, len(root.Children))
+		}
+	}
+
+	got, err = comments.GetCommentsForPost(context.Background(), post.ID, 3, 2)
+	if err != nil {
+		t.Fatalf("failed to get comments: %v", err)
+	}
+	expectTexts(t, "page 3", got, "Root 0")
+}
+
+func testCommentsPaginationEdges(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Post", nil, true)
+
+	got, err := comments.GetCommentsForPost(context.Background(), post.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("empty post: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("empty post: expected no comments, got %d", len(got))
+	}
+
+	for i := 0; i < 3; i++ {
+		mustCreateComment(t, comments, post.ID, nil, fmt.Sprintf("Root %d", i), at(time.Duration(i)*time.Second))
+	}
+	got, err = comments.GetCommentsForPost(context.Background(), post.ID, 2, 3)
+	if err != nil {
+		t.Fatalf("page past the end: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("page past the end: expected no comments, got %v", texts(got))
+	}
+
+	if _, err := comments.GetCommentsForPost(context.Background(), post.ID, 0, 10); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("page 0: expected ErrValidation, got %v", err)
+	}
+	if _, err := comments.GetCommentsForPost(context.Background(), post.ID, 1, -1); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("limit -1: expected ErrValidation, got %v", err)
+	}
+}
+
+func testCommentTree(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Post", nil, true)
+	other := mustCreatePost(t, posts, "Other", nil, true)
+	mustCreateComment(t, comments, other.ID, nil, "Foreign", at(0))
+
+	root := mustCreateComment(t, comments, post.ID, nil, "Root", at(0))
+	// Siblings created out of order must come back sorted by created_at.
+	second := mustCreateComment(t, comments, post.ID, &root.ID, "Second", at(2*time.Second))
+	first := mustCreateComment(t, comments, post.ID, &root.ID, "First", at(time.Second))
+
+	parent := &first.ID
+	for depth := 0; depth < 5; depth++ {
+		c := mustCreateComment(t, comments, post.ID, parent, fmt.Sprintf("Depth %d", depth), at(time.Duration(10+depth)*time.Second))
+		parent = &c.ID
+	}
+	mustCreateComment(t, comments, post.ID, &second.ID, "Under second", at(30*time.Second))
+
+	got, err := comments.GetCommentsForPost(context.Background(), post.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get comments: %v", err)
+	}
+	expectTexts(t, "roots", got, "Root")
+	if len(got) != 1 {
+		t.FailNow()
+	}
+	expectTexts(t, "root children", got[0].Children, "First", "Second")
+	if len(got[0].Children) != 2 {
+		t.FailNow()
+	}
+	expectTexts(t, "second children", got[0].Children[1].Children, "Under second")
+
+	node := got[0].Children[0]
+	for depth := 0; depth < 5; depth++ {
+		if len(node.Children) != 1 {
+			t.Fatalf("depth %d: expected 1 child under %q, got %d", depth, node.Text, len(node.Children))
+		}
+		node = node.Children[0]
+		if node.Text != fmt.Sprintf("Depth %d", depth) {
+			t.Errorf("depth %d: unexpected comment %q", depth, node.Text)
+		}
+		if node.PostID != post.ID {
+			t.Errorf("depth %d: comment belongs to post %s", depth, node.PostID)
+		}
+	}
+	if len(node.Children) != 0 {
+		t.Errorf("leaf must have no children, got %d", len(node.Children))
+	}
+}
+
+func testGetPostIncludesCommentTree(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Post", nil, true)
+	for i := 0; i < 3; i++ {
+		root := mustCreateComment(t, comments, post.ID, nil, fmt.Sprintf("Root %d", i), at(time.Duration(i)*time.Minute))
+		mustCreateComment(t, comments, post.ID, &root.ID, fmt.Sprintf("Reply %d", i), at(time.Duration(i)*time.Minute+time.Second))
+	}
+
+	got, err := posts.GetPost(context.Background(), post.ID, 2, 2)
+	if err != nil {
+		t.Fatalf("failed to get post: %v", err)
+	}
+	expectTexts(t, "second comment page", got.Comments, "Root 2")
+	if len(got.Comments) == 1 {
+		expectTexts(t, "replies", got.Comments[0].Children, "Reply 2")
+	}
+}
+
+func testParentValidation(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Post", nil, true)
+	other := mustCreatePost(t, posts, "Other", nil, true)
+	foreign := mustCreateComment(t, comments, other.ID, nil, "Foreign", nil)
+
+	missing := uuid.New()
+	_, err := comments.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, ParentID: &missing, Text: "Reply"})
+	if !errors.Is(err, domain.ErrParentNotFound) {
+		t.Errorf("missing parent: expected ErrParentNotFound, got %v", err)
+	}
+
+	_, err = comments.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, ParentID: &foreign.ID, Text: "Reply"})
+	if !errors.Is(err, domain.ErrParentPostMismatch) {
+		t.Errorf("parent from another post: expected ErrParentPostMismatch, got %v", err)
+	}
+
+	_, err = comments.CreateComment(context.Background(), &domain.Comment{PostID: uuid.New(), Text: "Orphan"})
+	if !errors.Is(err, domain.ErrPostNotFound) {
+		t.Errorf("unknown post: expected ErrPostNotFound, got %v", err)
+	}
+}
+
+func testCommentsDisabled(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Closed", nil, false)
+
+	_, err := comments.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, Text: "Comment"})
+	if !errors.Is(err, domain.ErrCommentsDisabled) {
+		t.Errorf("expected ErrCommentsDisabled, got %v", err)
+	}
+}
+
+func testConcurrentComments(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	const writers = 8
+	const perWriter = 10
+
+	post := mustCreatePost(t, posts, "Post", nil, true)
+	root := mustCreateComment(t, comments, post.ID, nil, "Root", at(0))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				_, err := comments.CreateComment(context.Background(), &domain.Comment{
+					PostID:   post.ID,
+					ParentID: &root.ID,
+					Text:     fmt.Sprintf("Reply %d-%d", w, i),
+				})
+				if err != nil {
+					errs <- err
+				}
+				if _, err := comments.GetCommentsForPost(context.Background(), post.ID, 1, 10); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent access failed: %v", err)
+	}
+
+	got, err := comments.GetCommentsForPost(context.Background(), post.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get comments: %v", err)
+	}
+	if len(got) != 1 || len(got[0].Children) != writers*perWriter {
+		t.Errorf("expected 1 root with %d replies, got %d roots", writers*perWriter, len(got))
+		if len(got) == 1 {
+			t.Errorf("got %d replies", len(got[0].Children))
+		}
+	}
+}
+
+func mustGetPost(t *testing.T, repo repository.PostRepository, id uuid.UUID) *domain.Post {
+	t.Helper()
+	post, err := repo.GetPost(context.Background(), id, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get post: %v", err)
+	}
+	return post
+}
+
+func mustGetComment(t *testing.T, repo repository.CommentRepository, id uuid.UUID) *domain.Comment {
+	t.Helper()
+	comment, err := repo.GetComment(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to get comment: %v", err)
+	}
+	return comment
+}
+
+func testCounters(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Post", at(0), true)
+	other := mustCreatePost(t, posts, "Other", at(time.Second), true)
+	root := mustCreateComment(t, comments, post.ID, nil, "Root", at(0))
+	reply := mustCreateComment(t, comments, post.ID, &root.ID, "Reply", at(time.Second))
+	mustCreateComment(t, comments, post.ID, &reply.ID, "Nested", at(2*time.Second))
+	mustCreateComment(t, comments, post.ID, &root.ID, "Second reply", at(3*time.Second))
+
+	got := mustGetPost(t, posts, post.ID)
+	if got.CommentCount != 4 {
+		t.Errorf("post: expected 4 comments, got %d", got.CommentCount)
+	}
+	if len(got.Comments) != 1 || got.Comments[0].ReplyCount != 2 {
+		t.Errorf("root in post tree: expected 2 replies, got %+v", got.Comments)
+	} else if first := got.Comments[0].Children[0]; first.ReplyCount != 1 {
+		t.Errorf("reply in post tree: expected 1 reply, got %d", first.ReplyCount)
+	}
+	if c := mustGetComment(t, comments, root.ID); c.ReplyCount != 2 {
+		t.Errorf("GetComment: expected 2 replies, got %d", c.ReplyCount)
+	}
+
+	feed, err := posts.GetPosts(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get posts: %v", err)
+	}
+	counts := map[uuid.UUID]int{}
+	for _, p := range feed {
+		counts[p.ID] = p.CommentCount
+	}
+	if counts[post.ID] != 4 || counts[other.ID] != 0 {
+		t.Errorf("feed: unexpected counters %v", counts)
+	}
+
+	repaired, err := comments.RebuildCounters(context.Background())
+	if err != nil {
+		t.Fatalf("failed to rebuild counters: %v", err)
+	}
+	if repaired != 0 {
+		t.Errorf("maintained counters must need no repair, %d were wrong", repaired)
+	}
+}
+
+func testDeleteComment(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	post := mustCreatePost(t, posts, "Post", at(0), true)
+	root := mustCreateComment(t, comments, post.ID, nil, "Root", at(0))
+	reply := mustCreateComment(t, comments, post.ID, &root.ID, "Reply", at(time.Second))
+	mustCreateComment(t, comments, post.ID, &reply.ID, "Nested", at(2*time.Second))
+
+	if err := comments.DeleteComment(context.Background(), reply.ID); err != nil {
+		t.Fatalf("failed to delete comment: %v", err)
+	}
+	deleted := mustGetComment(t, comments, reply.ID)
+	if !deleted.IsDeleted() {
+		t.Errorf("expected DeletedAt to be set")
+	}
+	if got := mustGetPost(t, posts, post.ID).CommentCount; got != 2 {
+		t.Errorf("post: expected 2 comments after delete, got %d", got)
+	}
+	if got := mustGetComment(t, comments, root.ID).ReplyCount; got != 0 {
+		t.Errorf("root: expected 0 replies after delete, got %d", got)
+	}
+
+	// The deleted comment stays in the thread with its replies.
+	tree, err := comments.GetCommentsForPost(context.Background(), post.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get comments: %v", err)
+	}
+	if len(tree) != 1 || len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 {
+		t.Errorf("deleted comment must keep its place in the thread")
+	}
+
+	if err := comments.DeleteComment(context.Background(), reply.ID); err != nil {
+		t.Errorf("second delete must be a no-op, got %v", err)
+	}
+	if got := mustGetPost(t, posts, post.ID).CommentCount; got != 2 {
+		t.Errorf("second delete changed the counter to %d", got)
+	}
+
+	if err := comments.DeleteComment(context.Background(), uuid.New()); !errors.Is(err, domain.ErrCommentNotFound) {
+		t.Errorf("expected ErrCommentNotFound, got %v", err)
+	}
+}
+
+// testReplyRacesDelete replies to a comment while it is deleted and checks that
+// no reply is attached once DeleteComment has returned: the check of the
+// parent and the insert of the reply must be atomic.
+func testReplyRacesDelete(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	const rounds = 10
+	const repliers = 4
+
+	ctx := context.Background()
+	post := mustCreatePost(t, posts, "Post", nil, true)
+	for round := 0; round < rounds; round++ {
+		parent := mustCreateComment(t, comments, post.ID, nil, "Parent", nil)
+
+		// The parent is deleted once every replier is replying.
+		var wg, replying sync.WaitGroup
+		errs := make(chan error, repliers)
+		for w := 0; w < repliers; w++ {
+			wg.Add(1)
+			replying.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					if i == 1 {
+						replying.Done()
+					}
+					_, err := comments.CreateComment(ctx, &domain.Comment{PostID: post.ID, ParentID: &parent.ID, Text: "Reply"})
+					if err != nil {
+						if i == 0 {
+							replying.Done()
+						}
+						if !errors.Is(err, domain.ErrParentDeleted) {
+							errs <- err
+						}
+						return
+					}
+				}
+			}()
+		}
+		replying.Wait()
+		if err := comments.DeleteComment(ctx, parent.ID); err != nil {
+			t.Fatalf("failed to delete comment: %v", err)
+		}
+		replies := mustGetComment(t, comments, parent.ID).ReplyCount
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("failed to reply: %v", err)
+		}
+		if got := mustGetComment(t, comments, parent.ID).ReplyCount; got != replies {
+			t.Fatalf("round %d: %d replies attached after the parent was deleted", round, got-replies)
+		}
+	}
+}
+
+// testConcurrentCounters runs creates and deletes in parallel and checks that
+// no update of the counters is lost.
+func testConcurrentCounters(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	const writers = 8
+	const perWriter = 10
+
+	post := mustCreatePost(t, posts, "Post", nil, true)
+	root := mustCreateComment(t, comments, post.ID, nil, "Root", at(0))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				c, err := comments.CreateComment(context.Background(), &domain.Comment{
+					PostID:   post.ID,
+					ParentID: &root.ID,
+					Text:     fmt.Sprintf("Reply %d-%d", w, i),
+				})
+				if err != nil {
+					errs <- err
+					continue
+				}
+				// Every other reply is deleted, twice, to race with itself.
+				if i%2 == 0 {
+					for j := 0; j < 2; j++ {
+						if err := comments.DeleteComment(context.Background(), c.ID); err != nil {
+							errs <- err
+						}
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent access failed: %v", err)
+	}
+
+	live := writers * perWriter / 2
+	if got := mustGetPost(t, posts, post.ID).CommentCount; got != live+1 {
+		t.Errorf("post: expected %d comments, got %d", live+1, got)
+	}
+	if got := mustGetComment(t, comments, root.ID).ReplyCount; got != live {
+		t.Errorf("root: expected %d replies, got %d", live, got)
+	}
+}
+
+// testLastModified checks that UpdatedAt starts at CreatedAt and that every
+// change to the discussion of a post moves it forward, for that post only.
+func testLastModified(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	ctx := context.Background()
+	lastModified := func(postID uuid.UUID) time.Time {
+		t.Helper()
+		modified, err := posts.LastModified(ctx, postID)
+		if err != nil {
+			t.Fatalf("failed to get last modification: %v", err)
+		}
+		return modified
+	}
+
+	if _, err := posts.LastModified(ctx, uuid.New()); !errors.Is(err, domain.ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+	}
+
+	post := mustCreatePost(t, posts, "Post", at(0), true)
+	other := mustCreatePost(t, posts, "Other", at(time.Minute), true)
+	if got := lastModified(post.ID); !got.Equal(*at(0)) {
+		t.Errorf("expected a new post to be modified at its creation, got %s", got)
+	}
+
+	comment := mustCreateComment(t, comments, post.ID, nil, "Comment", nil)
+	created := lastModified(post.ID)
+	if !created.After(*at(time.Minute)) {
+		t.Errorf("a comment must move the post forward, got %s", created)
+	}
+	if got := lastModified(other.ID); !got.Equal(*at(time.Minute)) {
+		t.Errorf("other posts must not change, got %s", got)
+	}
+	if got := mustGetPost(t, posts, post.ID).UpdatedAt; got == nil || !got.Equal(created) {
+		t.Errorf("expected GetPost to return UpdatedAt %s, got %v", created, got)
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := comments.DeleteComment(ctx, comment.ID); err != nil {
+		t.Fatalf("failed to delete comment: %v", err)
+	}
+	if got := lastModified(post.ID); !got.After(created) {
+		t.Errorf("a deleted comment must move the post forward, got %s after %s", got, created)
+	}
+}
+
+// testFeedVersion checks that every change of a post grows the feed version,
+// also when its timestamp is older than the newest one.
+func testFeedVersion(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	ctx := context.Background()
+	var last int64
+	grown := func(change string) {
+		t.Helper()
+		version, err := posts.FeedVersion(ctx)
+		if err != nil {
+			t.Fatalf("failed to get feed version: %v", err)
+		}
+		if version <= last {
+			t.Errorf("%s: expected the feed version to grow from %d, got %d", change, last, version)
+		}
+		last = version
+	}
+
+	if version, err := posts.FeedVersion(ctx); err != nil || version != 0 {
+		t.Errorf("expected version 0 without posts, got %d, %v", version, err)
+	}
+	post := mustCreatePost(t, posts, "Post", at(time.Hour), true)
+	grown("new post")
+	mustCreatePost(t, posts, "Older", at(0), true)
+	grown("post older than the newest one")
+	comment := mustCreateComment(t, comments, post.ID, nil, "Comment", nil)
+	grown("new comment")
+	if err := comments.DeleteComment(ctx, comment.ID); err != nil {
+		t.Fatalf("failed to delete comment: %v", err)
+	}
+	grown("deleted comment")
+	if err := posts.SetCommentsAllowed(ctx, post.ID, false); err != nil {
+		t.Fatalf("failed to close comments: %v", err)
+	}
+	grown("closed comments")
+}
+
+// testImport checks that an import keeps IDs, parent links and timestamps,
+// derives the counters, and skips the rows already stored. Backends without an
+// Importer skip it.
+func testImport(t *testing.T, posts repository.PostRepository, comments repository.CommentRepository) {
+	importer, ok := posts.(repository.Importer)
+	if !ok {
+		t.Skip("the backend has no importer")
+	}
+	ctx := context.Background()
+	post := &domain.Post{ID: uuid.New(), Text: "Post", AllowComments: false, CreatedAt: at(0), UpdatedAt: at(time.Hour)}
+	root := &domain.Comment{ID: uuid.New(), PostID: post.ID, Text: "Root", CreatedAt: at(time.Minute)}
+	reply := &domain.Comment{ID: uuid.New(), PostID: post.ID, ParentID: &root.ID, Text: "Reply", CreatedAt: at(2 * time.Minute)}
+	deleted := &domain.Comment{ID: uuid.New(), PostID: post.ID, ParentID: &root.ID, Text: "Deleted", CreatedAt: at(3 * time.Minute), DeletedAt: at(4 * time.Minute)}
+	batch := []*domain.Comment{root, reply, deleted}
+
+	result, err := importer.Import(ctx, []*domain.Post{post}, batch)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if len(result.PostIDs) != 1 || result.PostIDs[0] != post.ID || result.Comments != 3 {
+		t.Errorf("expected 1 post and 3 comments stored, got %+v", result)
+	}
+	got := mustGetPost(t, posts, post.ID)
+	if got.Text != "Post" || got.AllowComments || !got.CreatedAt.Equal(*post.CreatedAt) || got.CommentCount != 2 {
+		t.Errorf("unexpected post: %+v", got)
+	}
+	if got.UpdatedAt == nil || !got.UpdatedAt.Equal(*post.UpdatedAt) {
+		t.Errorf("expected UpdatedAt %s, got %v", post.UpdatedAt, got.UpdatedAt)
+	}
+	gotRoot := mustGetComment(t, comments, root.ID)
+	if gotRoot.ReplyCount != 1 || !gotRoot.CreatedAt.Equal(*root.CreatedAt) {
+		t.Errorf("unexpected root: %+v", gotRoot)
+	}
+	gotDeleted := mustGetComment(t, comments, deleted.ID)
+	if gotDeleted.ParentID == nil || *gotDeleted.ParentID != root.ID || gotDeleted.DeletedAt == nil || !gotDeleted.DeletedAt.Equal(*deleted.DeletedAt) {
+		t.Errorf("unexpected deleted comment: %+v", gotDeleted)
+	}
+
+	other := &domain.Post{ID: uuid.New(), Text: "Other", AllowComments: true, CreatedAt: at(0), UpdatedAt: at(0)}
+	result, err = importer.Import(ctx, []*domain.Post{post, other}, batch)
+	if err != nil {
+		t.Fatalf("failed to import again: %v", err)
+	}
+	if len(result.PostIDs) != 1 || result.PostIDs[0] != other.ID || result.Comments != 0 {
+		t.Errorf("expected a repeated import to store only the new post, got %+v", result)
+	}
+	if got := mustGetPost(t, posts, post.ID); got.CommentCount != 2 {
+		t.Errorf("a repeated import must not change the counters, got %d comments", got.CommentCount)
+	}
+
+	// Comments of a post listed in the batch that is already stored.
+	continued := &domain.Comment{ID: uuid.New(), PostID: post.ID, Text: "Continued", CreatedAt: at(2 * time.Hour)}
+	if _, err := importer.Import(ctx, []*domain.Post{post}, []*domain.Comment{continued}); err != nil {
+		t.Fatalf("failed to import a continued comment: %v", err)
+	}
+	got = mustGetPost(t, posts, post.ID)
+	if got.CommentCount != 3 {
+		t.Errorf("expected the counters to include the continued comment, got %d comments", got.CommentCount)
+	}
+	if got.UpdatedAt == nil || !got.UpdatedAt.Equal(*continued.CreatedAt) {
+		t.Errorf("expected UpdatedAt of the newest comment %s, got %v", continued.CreatedAt, got.UpdatedAt)
+	}
+
+	late := &domain.Comment{ID: uuid.New(), PostID: post.ID, ParentID: &reply.ID, Text: "Late", CreatedAt: at(5 * time.Minute)}
+	if _, err := importer.Import(ctx, nil, []*domain.Comment{late}); err != nil {
+		t.Fatalf("failed to import a reply: %v", err)
+	}
+	got = mustGetPost(t, posts, post.ID)
+	if got.CommentCount != 4 || mustGetComment(t, comments, reply.ID).ReplyCount != 1 {
+		t.Errorf("expected the counters to include the reply, got %d comments", got.CommentCount)
+	}
+	if got.UpdatedAt == nil || !got.UpdatedAt.After(*continued.CreatedAt) {
+		t.Errorf("a comment imported later must move the post forward, got %v", got.UpdatedAt)
+	}
+}
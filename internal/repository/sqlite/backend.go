@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"OZON/internal/repository/backend"
+	"OZON/pkg/storage"
+)
+
+func init() {
+	backend.Register("sqlite", open)
+}
+
+func open(settings backend.Settings) (*backend.Storage, error) {
+	db, err := storage.OpenSQLite(settings.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := db.DB.DB()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	repo := NewSQLiteRepository(*db)
+	s := backend.NewStorage(repo, repo, db.Ping, db.Close)
+	s.Pool = pool
+	s.Importer = repo
+	return s, nil
+}
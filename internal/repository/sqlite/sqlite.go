@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	postgres "OZON/internal/repository/postrges"
+	"OZON/pkg/storage"
+	"context"
+	"time"
+)
+
+// SQLiteRepository stores posts and comments in a SQLite file. The queries of
+// PostgresRepository are portable, so they are reused as is; SQLite only needs
+// timestamps in a single time zone because it compares them as text.
+type SQLiteRepository struct {
+	*postgres.PostgresRepository
+}
+
+func NewSQLiteRepository(db storage.DB) *SQLiteRepository {
+	return &SQLiteRepository{PostgresRepository: postgres.NewPostgresRepository(db)}
+}
+
+func (r *SQLiteRepository) CreatePost(ctx context.Context, post *domain.Post, allowComments *bool) (*domain.Post, error) {
+	post.CreatedAt = utc(post.CreatedAt)
+	return r.PostgresRepository.CreatePost(ctx, post, allowComments)
+}
+
+func (r *SQLiteRepository) CreateComment(ctx context.Context, comment *domain.Comment) (*domain.Comment, error) {
+	comment.CreatedAt = utc(comment.CreatedAt)
+	return r.PostgresRepository.CreateComment(ctx, comment)
+}
+
+func (r *SQLiteRepository) Import(ctx context.Context, posts []*domain.Post, comments []*domain.Comment) (repository.ImportResult, error) {
+	postsUTC := make([]*domain.Post, len(posts))
+	for i, post := range posts {
+		postCopy := *post
+		postCopy.CreatedAt = utc(post.CreatedAt)
+		if post.UpdatedAt != nil {
+			postCopy.UpdatedAt = utc(post.UpdatedAt)
+		}
+		postsUTC[i] = &postCopy
+	}
+	commentsUTC := make([]*domain.Comment, len(comments))
+	for i, comment := range comments {
+		commentCopy := *comment
+		commentCopy.CreatedAt = utc(comment.CreatedAt)
+		if comment.DeletedAt != nil {
+			commentCopy.DeletedAt = utc(comment.DeletedAt)
+		}
+		commentsUTC[i] = &commentCopy
+	}
+	return r.PostgresRepository.Import(ctx, postsUTC, commentsUTC)
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		now := time.Now().UTC()
+		return &now
+	}
+	converted := t.UTC()
+	return &converted
+}
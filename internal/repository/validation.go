@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"OZON/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// ValidateParent checks that the parent comment exists, belongs to the same post
+// and is not deleted. When maxDepth is positive it also checks that a reply to
+// the parent would not be nested deeper than maxDepth levels (root comments are
+// level 1). Every backend and the usecase layer go through this function so that
+// they reject the same inputs with the same errors.
+func ValidateParent(ctx context.Context, repo CommentRepository, postID, parentID uuid.UUID, maxDepth int) error {
+	parent, err := repo.GetComment(ctx, parentID)
+	if err != nil {
+		if errors.Is(err, domain.ErrCommentNotFound) {
+			return fmt.Errorf("%w: %s", domain.ErrParentNotFound, parentID)
+		}
+		return err
+	}
+	if parent.PostID != postID {
+		return fmt.Errorf("%w: %s", domain.ErrParentPostMismatch, parentID)
+	}
+	if parent.IsDeleted() {
+		return fmt.Errorf("%w: %s", domain.ErrParentDeleted, parentID)
+	}
+	if maxDepth <= 0 {
+		return nil
+	}
+
+	depth := 2
+	for parent.ParentID != nil {
+		if depth > maxDepth {
+			break
+		}
+		parent, err = repo.GetComment(ctx, *parent.ParentID)
+		if err != nil {
+			return fmt.Errorf("failed to resolve comment ancestors: %w", err)
+		}
+		depth++
+	}
+	if depth > maxDepth {
+		return fmt.Errorf("%w: limit is %d", domain.ErrMaxDepthExceeded, maxDepth)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package usecases
 import (
 	"OZON/internal/domain"
 	"OZON/internal/repository"
+	"OZON/pkg/tracing"
 	"context"
 	"fmt"
 	"github.com/google/uuid"
@@ -11,61 +12,97 @@ import (
 type CommentUsecase struct {
 	postRepo    repository.PostRepository
 	commentRepo repository.CommentRepository
+	maxDepth    int
 }
 
-func NewCommentUsecase(postRepo repository.PostRepository, commentRepo repository.CommentRepository) *CommentUsecase {
+// NewCommentUsecase creates a CommentUsecase. maxDepth limits how deeply replies
+// can be nested; zero or a negative value disables the limit.
+func NewCommentUsecase(postRepo repository.PostRepository, commentRepo repository.CommentRepository, maxDepth int) *CommentUsecase {
 	return &CommentUsecase{
 		postRepo:    postRepo,
 		commentRepo: commentRepo,
+		maxDepth:    maxDepth,
 	}
 }
 
-func (u *CommentUsecase) CreateComment(ctx context.Context, comment *domain.Comment) (*domain.Comment, error) {
+func (u *CommentUsecase) CreateComment(ctx context.Context, comment *domain.Comment) (_ *domain.Comment, err error) {
+	ctx, span := tracing.Start(ctx, "CommentUsecase.CreateComment")
+	defer func() { endSpan(span, err) }()
+
 	if comment.PostID == uuid.Nil {
-		return nil, fmt.Errorf("post ID cannot be empty")
+		return nil, domain.NewValidationError("postId", "post ID cannot be empty")
 	}
 	if comment.Text == "" {
-		return nil, fmt.Errorf("comment text cannot be empty")
+		return nil, domain.NewValidationError("text", "comment text cannot be empty")
 	}
 	if len(comment.Text) > 2000 {
-		return nil, fmt.Errorf("comment text exceeds 2000 characters")
+		return nil, domain.NewValidationError("text", "comment text exceeds 2000 characters")
 	}
-	if comment.ParentID != nil {
-		if _, err := uuid.Parse(comment.ParentID.String()); err != nil {
-			return nil, fmt.Errorf("invalid parent ID format: %v", err)
-		}
-		_, err := u.commentRepo.GetCommentsForPost(ctx, comment.PostID, 1, 1)
-		if err != nil {
-			return nil, fmt.Errorf("parent comment not found or invalid: %v", err)
-		}
+	allowed, err := u.postRepo.IsCommentsAllowed(ctx, comment.PostID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, domain.ErrCommentsDisabled
 	}
 
-	allowed, err := u.postRepo.IsCommentsAllowed(ctx, comment.PostID)
-	if err != nil || !allowed {
-		return nil, fmt.Errorf("comments not allowed or post not found: %v", err)
+	if comment.ParentID != nil {
+		if err := repository.ValidateParent(ctx, u.commentRepo, comment.PostID, *comment.ParentID, u.maxDepth); err != nil {
+			return nil, err
+		}
 	}
 
 	return u.commentRepo.CreateComment(ctx, comment)
 }
 
-func (u *CommentUsecase) GetCommentsForPost(ctx context.Context, postID string, page, limit int32) ([]*domain.Comment, error) {
+func (u *CommentUsecase) GetCommentsForPost(ctx context.Context, postID string, page, limit int32) (_ []*domain.Comment, err error) {
+	ctx, span := tracing.Start(ctx, "CommentUsecase.GetCommentsForPost")
+	defer func() { endSpan(span, err) }()
+
 	if postID == "" {
-		return nil, fmt.Errorf("post ID cannot be empty")
+		return nil, domain.NewValidationError("postId", "post ID cannot be empty")
 	}
 	uuidPostID, err := uuid.Parse(postID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid post ID format: %v", err)
+		return nil, domain.NewValidationError("postId", fmt.Sprintf("invalid post ID format: %v", err))
 	}
 	if page <= 0 {
-		return nil, fmt.Errorf("page must be greater than 0")
+		return nil, domain.NewValidationError("page", "page must be greater than 0")
 	}
 	if limit < 0 {
-		return nil, fmt.Errorf("limit must be greater than or equal to 0")
+		return nil, domain.NewValidationError("limit", "limit must be greater than or equal to 0")
 	}
 
 	comments, err := u.commentRepo.GetCommentsForPost(ctx, uuidPostID, page, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comments: %v", err)
+		return nil, fmt.Errorf("failed to get comments: %w", err)
 	}
 	return comments, nil
 }
+
+// DeleteComment soft-deletes a comment. Its replies stay in the thread.
+func (u *CommentUsecase) DeleteComment(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "CommentUsecase.DeleteComment")
+	defer func() { endSpan(span, err) }()
+
+	if id == "" {
+		return domain.NewValidationError("id", "comment ID cannot be empty")
+	}
+	uuidID, err := uuid.Parse(id)
+	if err != nil {
+		return domain.NewValidationError("id", fmt.Sprintf("invalid comment ID format: %v", err))
+	}
+	if err := u.commentRepo.DeleteComment(ctx, uuidID); err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	return nil
+}
+
+// RebuildCounters recomputes the comment and reply counters and returns how
+// many were wrong.
+func (u *CommentUsecase) RebuildCounters(ctx context.Context) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "CommentUsecase.RebuildCounters")
+	defer func() { endSpan(span, err) }()
+
+	return u.commentRepo.RebuildCounters(ctx)
+}
@@ -3,9 +3,11 @@ package usecases
 import (
 	"OZON/internal/domain"
 	"OZON/internal/repository"
+	"OZON/pkg/tracing"
 	"context"
 	"fmt"
 	"github.com/google/uuid"
+	"time"
 )
 
 type PostUsecase struct {
@@ -20,52 +22,58 @@ func NewPostUsecase(postRepo repository.PostRepository, commentRepo repository.C
 	}
 }
 
-func (u *PostUsecase) GetPost(ctx context.Context, id string, commentPage, commentLimit int32) (*domain.Post, error) {
+func (u *PostUsecase) GetPost(ctx context.Context, id string, commentPage, commentLimit int32) (_ *domain.Post, err error) {
+	ctx, span := tracing.Start(ctx, "PostUsecase.GetPost")
+	defer func() { endSpan(span, err) }()
+
 	if id == "" {
-		return nil, fmt.Errorf("post ID cannot be empty")
+		return nil, domain.NewValidationError("id", "post ID cannot be empty")
 	}
 	uuidID, err := uuid.Parse(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid post ID format: %v", err)
+		return nil, domain.NewValidationError("id", fmt.Sprintf("invalid post ID format: %v", err))
 	}
 	if commentPage <= 0 {
-		return nil, fmt.Errorf("comment page must be greater than 0")
+		return nil, domain.NewValidationError("commentPage", "comment page must be greater than 0")
 	}
 	if commentLimit <= 0 {
-		return nil, fmt.Errorf("comment limit must be greater than or equal to 0")
+		return nil, domain.NewValidationError("commentLimit", "comment limit must be greater than or equal to 0")
 	}
 
 	post, err := u.postRepo.GetPost(ctx, uuidID, commentPage, commentLimit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get post: %v", err)
+		return nil, fmt.Errorf("failed to get post: %w", err)
 	}
 
 	post.Comments, err = u.commentRepo.GetCommentsForPost(ctx, post.ID, commentPage, commentLimit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comments for post: %v", err)
+		return nil, fmt.Errorf("failed to get comments for post: %w", err)
 	}
 
 	return post, nil
 }
 
-func (u *PostUsecase) GetPosts(ctx context.Context, page, limit int32) ([]*domain.Post, error) {
+func (u *PostUsecase) GetPosts(ctx context.Context, page, limit int32) (_ []*domain.Post, err error) {
+	ctx, span := tracing.Start(ctx, "PostUsecase.GetPosts")
+	defer func() { endSpan(span, err) }()
+
 	if page <= 0 {
-		return nil, fmt.Errorf("page must be greater than 0")
+		return nil, domain.NewValidationError("page", "page must be greater than 0")
 	}
 	if limit <= 0 {
-		return nil, fmt.Errorf("limit must be greater than or equal to 0")
+		return nil, domain.NewValidationError("limit", "limit must be greater than or equal to 0")
 	}
 
 	posts, err := u.postRepo.GetPosts(ctx, page, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get posts: %v", err)
+		return nil, fmt.Errorf("failed to get posts: %w", err)
 	}
 
 	for i := range posts {
 		if posts[i] != nil {
 			posts[i].Comments, err = u.commentRepo.GetCommentsForPost(ctx, posts[i].ID, 1, 10)
 			if err != nil {
-				return nil, fmt.Errorf("failed to get comments for post %s: %v", posts[i].ID.String(), err)
+				return nil, fmt.Errorf("failed to get comments for post %s: %w", posts[i].ID.String(), err)
 			}
 		}
 	}
@@ -73,12 +81,15 @@ func (u *PostUsecase) GetPosts(ctx context.Context, page, limit int32) ([]*domai
 	return posts, nil
 }
 
-func (u *PostUsecase) CreatePost(ctx context.Context, text string, allowComments *bool) (*domain.Post, error) {
+func (u *PostUsecase) CreatePost(ctx context.Context, text string, allowComments *bool) (_ *domain.Post, err error) {
+	ctx, span := tracing.Start(ctx, "PostUsecase.CreatePost")
+	defer func() { endSpan(span, err) }()
+
 	if text == "" {
-		return nil, fmt.Errorf("post text cannot be empty")
+		return nil, domain.NewValidationError("text", "post text cannot be empty")
 	}
 	if len(text) > 10000 {
-		return nil, fmt.Errorf("post text too long")
+		return nil, domain.NewValidationError("text", "post text too long")
 	}
 
 	allow := true
@@ -92,23 +103,72 @@ func (u *PostUsecase) CreatePost(ctx context.Context, text string, allowComments
 	}
 	createdPost, err := u.postRepo.CreatePost(ctx, post, &allow)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create post: %v", err)
+		return nil, fmt.Errorf("failed to create post: %w", err)
 	}
 	return createdPost, nil
 }
 
-func (u *PostUsecase) IsCommentsAllowed(ctx context.Context, postID string) (bool, error) {
+func (u *PostUsecase) IsCommentsAllowed(ctx context.Context, postID string) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "PostUsecase.IsCommentsAllowed")
+	defer func() { endSpan(span, err) }()
+
 	if postID == "" {
-		return false, fmt.Errorf("post ID cannot be empty")
+		return false, domain.NewValidationError("postId", "post ID cannot be empty")
 	}
 	uuidPostID, err := uuid.Parse(postID)
 	if err != nil {
-		return false, fmt.Errorf("invalid post ID format: %v", err)
+		return false, domain.NewValidationError("postId", fmt.Sprintf("invalid post ID format: %v", err))
 	}
 
 	allowed, err := u.postRepo.IsCommentsAllowed(ctx, uuidPostID)
 	if err != nil {
-		return false, fmt.Errorf("failed to check comments allowed: %v", err)
+		return false, fmt.Errorf("failed to check comments allowed: %w", err)
 	}
 	return allowed, nil
 }
+
+// SetCommentsAllowed opens or closes a post for new comments.
+func (u *PostUsecase) SetCommentsAllowed(ctx context.Context, postID string, allowed bool) (err error) {
+	ctx, span := tracing.Start(ctx, "PostUsecase.SetCommentsAllowed")
+	defer func() { endSpan(span, err) }()
+
+	uuidPostID, err := uuid.Parse(postID)
+	if err != nil {
+		return domain.NewValidationError("postId", fmt.Sprintf("invalid post ID format: %v", err))
+	}
+	if err := u.postRepo.SetCommentsAllowed(ctx, uuidPostID, allowed); err != nil {
+		return fmt.Errorf("failed to set comments allowed: %w", err)
+	}
+	return nil
+}
+
+// LastModified returns when the post with the given ID or its discussion last
+// changed. It versions responses for HTTP caching.
+func (u *PostUsecase) LastModified(ctx context.Context, postID string) (_ time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "PostUsecase.LastModified")
+	defer func() { endSpan(span, err) }()
+
+	id, err := uuid.Parse(postID)
+	if err != nil {
+		return time.Time{}, domain.NewValidationError("id", fmt.Sprintf("invalid post ID format: %v", err))
+	}
+
+	modified, err := u.postRepo.LastModified(ctx, id)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last modification: %w", err)
+	}
+	return modified, nil
+}
+
+// FeedVersion returns a number that grows with every change of any post. It
+// versions the feed for HTTP caching.
+func (u *PostUsecase) FeedVersion(ctx context.Context) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "PostUsecase.FeedVersion")
+	defer func() { endSpan(span, err) }()
+
+	version, err := u.postRepo.FeedVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get feed version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,16 @@
+package usecases
+
+import (
+	"OZON/internal/domain"
+	"OZON/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// endSpan ends the span of a usecase method. Errors a client can act on, such
+// as invalid input or a missing post, are recorded without failing the span.
+func endSpan(span trace.Span, err error) {
+	tracing.End(span, err, func(err error) bool {
+		_, ok := domain.ErrorCode(err)
+		return ok
+	})
+}
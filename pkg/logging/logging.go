@@ -0,0 +1,119 @@
+// Package logging sets up log/slog for the server. The request ID travels in
+// the context: every record logged with a *Context method while serving a
+// request carries it, whichever layer logs it, together with the trace ID when
+// the request is traced.
+package logging
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Header carries the request ID in requests and responses.
+const Header = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// New returns a logger that writes records of at least level (debug, info,
+// warn or error) to w as text or json, adding the request ID from the context.
+func New(w io.Writer, level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+	var h slog.Handler
+	if format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// ParseLevel converts a configured level; unknown levels mean info.
+func ParseLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// WithRequestID returns a copy of ctx that carries id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns the ID of a request: the one sent by the client if it
+// looks sane, a new UUID otherwise.
+func NewRequestID(sent string) string {
+	if validRequestID(sent) {
+		return sent
+	}
+	return uuid.NewString()
+}
+
+// RequestIDMiddleware gives every request an ID with NewRequestID from
+// X-Request-ID. The ID is stored in the request context and echoed in the
+// response header.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := NewRequestID(r.Header.Get(Header))
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts the characters of common ID formats so that client
+// input cannot forge log lines or bloat them.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// contextHandler adds the request ID and the trace ID of the context to every
+// record, so that the log lines of a traced request can be found from its trace.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Redacted replaces values that must not reach the logs.
+const Redacted = "[REDACTED]"
+
+// maxLoggedString bounds the length of logged string values.
+const maxLoggedString = 64
+
+// sensitiveSuffixes name the arguments and input fields whose values are never
+// logged: secrets and the text of posts and comments, which is user content.
+var sensitiveSuffixes = []string{"password", "token", "secret", "authorization", "text"}
+
+// RedactVariables returns a copy of GraphQL variables that is safe to log.
+// The client chooses the names of the variables, so the variables to redact
+// are given by the caller from where the operation uses them, see Sensitive.
+// Inside input objects the keys are the field names of the schema and are
+// matched with Sensitive. Long strings are truncated.
+func RedactVariables(vars map[string]interface{}, sensitive map[string]bool) map[string]interface{} {
+	if vars == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		if sensitive[k] {
+			out[k] = Redacted
+		} else {
+			out[k] = redactValue(v)
+		}
+	}
+	return out
+}
+
+func redactFields(fields map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if Sensitive(k) {
+			out[k] = Redacted
+		} else {
+			out[k] = redactValue(v)
+		}
+	}
+	return out
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return redactFields(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = redactValue(e)
+		}
+		return out
+	case string:
+		if utf8.RuneCountInString(v) > maxLoggedString {
+			runes := []rune(v)
+			return fmt.Sprintf("%s... (%d characters)", string(runes[:maxLoggedString]), len(runes))
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Sensitive reports whether the values of an argument or input field of the
+// schema must not be logged. It matches the name by suffix, case-insensitively.
+func Sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveSuffixes {
+		if strings.HasSuffix(name, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,362 @@
+// Package migrate applies numbered SQL migrations to a Postgres database.
+//
+// Applied versions are recorded in the schema_migrations table. Every
+// migration runs in its own transaction together with its bookkeeping row, so
+// a failed migration leaves no trace. All operations hold a Postgres advisory
+// lock, which makes replicas that start at the same time apply each migration
+// exactly once: the others wait and then find nothing left to do.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockID identifies the advisory lock held while migrating. It is shared by
+// every schema of the database, which only serializes migrations further.
+const lockID = 7_402_114_551
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// ErrDirty is returned by Check when the database is not at the latest version.
+var ErrDirty = errors.New("database schema is not up to date")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes one migration as seen by the database.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Unknown marks versions recorded in the database that this binary does not
+	// have, for example after a rollback to an older release.
+	Unknown bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// Load reads the migrations from the top level of fsys. Every version needs
+// both an up and a down file; versions must be unique but may have gaps.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		if e.IsDir() || e.Name()[0] == '.' {
+			continue
+		}
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			if strings.HasSuffix(e.Name(), ".sql") {
+				return nil, fmt.Errorf("invalid migration file name %q: want NNNN_name.up.sql or NNNN_name.down.sql", e.Name())
+			}
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		if version <= 0 {
+			return nil, fmt.Errorf("invalid migration %q: versions start at 1", e.Name())
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down file", mig.Version, mig.Name)
+		}
+		out = append(out, *mig)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Latest returns the highest known version, or 0 when there are no migrations.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration. Applied versions this binary does not
+// know are left alone, so an older release can still start during a rollout.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.migrate(ctx, m.Latest(), false)
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		current := maxVersion(applied)
+		if current == 0 {
+			return nil
+		}
+		mig, ok := m.find(current)
+		if !ok {
+			return fmt.Errorf("cannot roll back version %d: this binary does not know it", current)
+		}
+		return m.run(ctx, conn, mig, false)
+	})
+}
+
+// To migrates up or down until target is the latest applied version. Zero
+// rolls back everything.
+func (m *Migrator) To(ctx context.Context, target int) error {
+	if target < 0 {
+		return fmt.Errorf("invalid target version %d", target)
+	}
+	if _, ok := m.find(target); !ok && target != 0 {
+		return fmt.Errorf("unknown migration version %d", target)
+	}
+	return m.migrate(ctx, target, true)
+}
+
+func (m *Migrator) migrate(ctx context.Context, target int, rollback bool) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if rollback {
+			for v := range applied {
+				if _, ok := m.find(v); !ok && v > target {
+					return fmt.Errorf("cannot migrate to %d: applied version %d is unknown to this binary", target, v)
+				}
+			}
+			// Roll back from the newest applied version down to the target...
+			for i := len(m.migrations) - 1; i >= 0; i-- {
+				mig := m.migrations[i]
+				if mig.Version > target && applied[mig.Version] {
+					if err := m.run(ctx, conn, mig, false); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		// ...then apply what is missing up to it, including gaps left by
+		// migrations merged out of order.
+		for _, mig := range m.migrations {
+			if mig.Version <= target && !applied[mig.Version] {
+				if err := m.run(ctx, conn, mig, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Status lists every known migration and every unknown applied version,
+// ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	// Status does not take the lock and must not write, so a missing table
+	// simply means that nothing is applied yet.
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	recorded := make(map[int]Status)
+	if exists {
+		if err := readStatuses(ctx, conn, recorded); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]Status, 0, len(m.migrations)+len(recorded))
+	for _, mig := range m.migrations {
+		s, ok := recorded[mig.Version]
+		if !ok {
+			s = Status{Version: mig.Version, Name: mig.Name}
+		}
+		delete(recorded, mig.Version)
+		out = append(out, s)
+	}
+	for _, s := range recorded {
+		s.Unknown = true
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Check returns an error matching ErrDirty unless every known migration is applied.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			return fmt.Errorf("%w: migration %d (%s) is pending", ErrDirty, s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	i := sort.Search(len(m.migrations), func(i int) bool { return m.migrations[i].Version >= version })
+	if i < len(m.migrations) && m.migrations[i].Version == version {
+		return m.migrations[i], true
+	}
+	return Migration{}, false
+}
+
+// withLock runs fn on a single connection that holds the migration lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// A fresh context: the lock must be released even if ctx is done.
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+	}()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	direction, body := "up", mig.Up
+	if !up {
+		direction, body = "down", mig.Down
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", mig.Version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("migration %d (%s) %s failed: %w", mig.Version, mig.Name, direction, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", mig.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", mig.Version, err)
+	}
+	return nil
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    bigint PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamp with time zone NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func readStatuses(ctx context.Context, conn *sql.Conn, into map[int]Status) error {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Status
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		s.Applied = true
+		into[s.Version] = s
+	}
+	return rows.Err()
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+func maxVersion(versions map[int]bool) int {
+	max := 0
+	for v := range versions {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
@@ -0,0 +1,202 @@
+// Package openapi builds OpenAPI 3 documents from Go types, so that the spec
+// of an HTTP API is derived from the structs its handlers encode and decode
+// instead of being maintained by hand.
+package openapi
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+// Generator collects the schemas of the types it is given in the components
+// of a document. Struct types become named schemas referenced by $ref; the
+// name is that of the Go type, passed through Name if set.
+type Generator struct {
+	Name func(t reflect.Type) string
+	doc  *Document
+}
+
+// NewGenerator returns a generator for a document with the given info.
+func NewGenerator(info Info) *Generator {
+	return &Generator{doc: &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      make(map[string]map[string]Operation),
+		Components: Components{Schemas: make(map[string]*Schema)},
+	}}
+}
+
+// Add adds op as the operation of method on path, a template such as
+// /posts/{id}.
+func (g *Generator) Add(method, path string, op Operation) {
+	if g.doc.Paths[path] == nil {
+		g.doc.Paths[path] = make(map[string]Operation)
+	}
+	g.doc.Paths[path][strings.ToLower(method)] = op
+}
+
+// Document returns the document built so far.
+func (g *Generator) Document() *Document {
+	return g.doc
+}
+
+// JSON returns the content of a JSON body of v's type.
+func (g *Generator) JSON(v any) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: g.Schema(reflect.TypeOf(v))}}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Schema returns the schema of t as encoding/json encodes it. Struct fields
+// are named by their json tag; fields without omitempty are required. A doc
+// tag becomes their description and an enum tag, a comma-separated list, the
+// values they may take.
+func (g *Generator) Schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		s := g.Schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case t.Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		return g.object(t)
+	default:
+		return &Schema{}
+	}
+}
+
+func (g *Generator) object(t reflect.Type) *Schema {
+	name := t.Name()
+	if g.Name != nil {
+		name = g.Name(t)
+	}
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := g.doc.Components.Schemas[name]; ok {
+		return ref
+	}
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	// Registered before the fields, so that recursive types end in a $ref.
+	g.doc.Components.Schemas[name] = s
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		fieldName, opts, _ := strings.Cut(tag, ",")
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+		prop := g.Schema(field.Type)
+		// Siblings of $ref are ignored in OpenAPI 3.0, so a referenced
+		// schema keeps its own description.
+		if prop.Ref == "" {
+			prop.Description = field.Tag.Get("doc")
+			if enum := field.Tag.Get("enum"); enum != "" {
+				prop.Enum = strings.Split(enum, ",")
+			}
+		}
+		s.Properties[fieldName] = prop
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, fieldName)
+		}
+	}
+	return ref
+}
@@ -0,0 +1,64 @@
+package persisted
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"log/slog"
+	"time"
+)
+
+// queryTTL bounds how long a registered query is kept by a store that
+// expires entries. Clients register a query again when it is gone.
+const queryTTL = 24 * time.Hour
+
+// Store keeps queries by key; the caches of internal/repository/cache
+// implement it.
+type Store interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Cache is the cache of gqlgen's AutomaticPersistedQuery extension. Queries of
+// the manifest, if any, are always known; the others are registered in the
+// store by the clients that send them.
+type Cache struct {
+	manifest *Manifest
+	store    Store
+}
+
+var _ graphql.Cache[string] = (*Cache)(nil)
+
+// NewCache returns a cache over store; manifest may be nil.
+func NewCache(store Store, manifest *Manifest) *Cache {
+	return &Cache{manifest: manifest, store: store}
+}
+
+func key(hash string) string {
+	return "apq:" + hash
+}
+
+func (c *Cache) Get(ctx context.Context, hash string) (string, bool) {
+	if c.manifest != nil {
+		if query, ok := c.manifest.Lookup(hash); ok {
+			return query, true
+		}
+	}
+	query, ok, err := c.store.Get(ctx, key(hash))
+	if err != nil {
+		// The client then sends the query itself.
+		slog.WarnContext(ctx, "persisted query cache read failed", "error", err)
+		return "", false
+	}
+	return string(query), ok
+}
+
+func (c *Cache) Add(ctx context.Context, hash, query string) {
+	if c.manifest != nil {
+		if _, ok := c.manifest.Lookup(hash); ok {
+			return
+		}
+	}
+	if err := c.store.Set(ctx, key(hash), []byte(query), queryTTL); err != nil {
+		slog.WarnContext(ctx, "persisted query cache write failed", "error", err)
+	}
+}
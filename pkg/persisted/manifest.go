@@ -0,0 +1,173 @@
+// Package persisted handles persisted GraphQL queries: the manifest of the
+// operations a frontend build sends, and the cache in which automatic
+// persisted queries are registered.
+package persisted
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+	"os"
+	"sort"
+)
+
+// apolloFormat identifies the manifests written by Apollo's
+// generate-persisted-query-manifest.
+const apolloFormat = "apollo-persisted-query-manifest"
+
+// Operation is a query of the manifest; ID is the sha256 of Body.
+type Operation struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Body string `json:"body"`
+}
+
+// Manifest is the set of operations a frontend build may send, keyed by the
+// sha256 of their text as in automatic persisted queries.
+type Manifest struct {
+	operations map[string]Operation
+}
+
+// Hash returns the hex sha256 of a query, the hash APQ clients send.
+func Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadManifest reads the manifest at path.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query manifest: %w", err)
+	}
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseManifest decodes a manifest in the Apollo format,
+//
+//	{"format": "apollo-persisted-query-manifest", "version": 1,
+//	 "operations": [{"id": "<sha256>", "name": "Feed", "type": "query", "body": "query Feed { ... }"}]}
+//
+// or a plain object mapping each sha256 to its query, as Relay and
+// persistgraphql write them. Every id must be the hash of its body.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	if _, ok := top["format"]; ok {
+		var apollo struct {
+			Format     string      `json:"format"`
+			Version    int         `json:"version"`
+			Operations []Operation `json:"operations"`
+		}
+		if err := json.Unmarshal(data, &apollo); err != nil {
+			return nil, err
+		}
+		if apollo.Format != apolloFormat || apollo.Version != 1 {
+			return nil, fmt.Errorf("unsupported format %q version %d", apollo.Format, apollo.Version)
+		}
+		ops = apollo.Operations
+	} else {
+		for id, raw := range top {
+			var body string
+			if err := json.Unmarshal(raw, &body); err != nil {
+				return nil, fmt.Errorf("operation %s: the query must be a string", id)
+			}
+			ops = append(ops, Operation{ID: id, Body: body})
+		}
+	}
+
+	m := &Manifest{operations: make(map[string]Operation, len(ops))}
+	for _, op := range ops {
+		if op.Body == "" {
+			return nil, fmt.Errorf("operation %s: empty body", op.ID)
+		}
+		if Hash(op.Body) != op.ID {
+			return nil, fmt.Errorf("operation %s: id is not the sha256 of the body", op.ID)
+		}
+		m.operations[op.ID] = op
+	}
+	return m, nil
+}
+
+// Lookup returns the query with the given hash.
+func (m *Manifest) Lookup(hash string) (string, bool) {
+	op, ok := m.operations[hash]
+	return op.Body, ok
+}
+
+// Len returns the number of operations.
+func (m *Manifest) Len() int {
+	return len(m.operations)
+}
+
+// Operations returns the operations ordered by name, then id.
+func (m *Manifest) Operations() []Operation {
+	ops := make([]Operation, 0, len(m.operations))
+	for _, op := range m.operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Name != ops[j].Name {
+			return ops[i].Name < ops[j].Name
+		}
+		return ops[i].ID < ops[j].ID
+	})
+	return ops
+}
+
+// OperationNames returns the names of the operations defined in the bodies,
+// sorted and without duplicates. Bodies that do not parse are skipped;
+// Validate reports them.
+func (m *Manifest) OperationNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, op := range m.operations {
+		doc, err := parser.ParseQuery(&ast.Source{Input: op.Body})
+		if err != nil {
+			continue
+		}
+		for _, def := range doc.Operations {
+			if def.Name != "" && !seen[def.Name] {
+				seen[def.Name] = true
+				names = append(names, def.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks every operation against schema, so that a manifest built
+// for another version of the API is caught before it is deployed. A name
+// given by the manifest must be that of an operation in the body.
+func (m *Manifest) Validate(schema *ast.Schema) error {
+	var errs []error
+	for _, op := range m.Operations() {
+		label := op.ID
+		if op.Name != "" {
+			label = op.Name + " (" + op.ID + ")"
+		}
+		doc, list := gqlparser.LoadQuery(schema, op.Body)
+		for _, err := range list {
+			errs = append(errs, fmt.Errorf("operation %s: %w", label, err))
+		}
+		if doc != nil && op.Name != "" && doc.Operations.ForName(op.Name) == nil {
+			errs = append(errs, fmt.Errorf("operation %s: the body has no operation %s", label, op.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
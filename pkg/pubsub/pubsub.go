@@ -0,0 +1,149 @@
+// Package pubsub fans messages out to the subscribers of a topic. It backs the
+// GraphQL subscriptions: publishing never blocks, a subscriber that falls
+// behind is dropped, and Close ends every subscription so that the server can
+// shut down.
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// bufferSize is how many messages a subscriber may lag behind before it is dropped.
+const bufferSize = 16
+
+// ErrClosed is returned by Subscribe after Close.
+var ErrClosed = errors.New("pubsub: broker is closed")
+
+type Broker[T any] struct {
+	mu     sync.Mutex
+	topics map[string]map[chan T]struct{}
+	closed bool
+	// dropped counts the subscribers removed for falling behind.
+	dropped uint64
+	// active counts the subscriptions whose context is not done yet.
+	active sync.WaitGroup
+}
+
+func New[T any]() *Broker[T] {
+	return &Broker[T]{topics: make(map[string]map[chan T]struct{})}
+}
+
+// Subscribe returns a channel that receives the messages published to topic.
+// The channel is closed when ctx is done, when the subscriber falls more than
+// bufferSize messages behind, or when the broker is closed.
+func (b *Broker[T]) Subscribe(ctx context.Context, topic string) (<-chan T, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	ch := make(chan T, bufferSize)
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[chan T]struct{})
+		b.topics[topic] = subs
+	}
+	subs[ch] = struct{}{}
+	b.active.Add(1)
+	context.AfterFunc(ctx, func() {
+		b.unsubscribe(topic, ch)
+		b.active.Done()
+	})
+	return ch, nil
+}
+
+// Publish delivers msg to the current subscribers of topic.
+func (b *Broker[T]) Publish(topic string, msg T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.topics[topic] {
+		select {
+		case ch <- msg:
+		default:
+			b.remove(topic, ch)
+			b.dropped++
+		}
+	}
+}
+
+// Close ends every subscription and returns how many there were. Later
+// subscriptions fail with ErrClosed; later messages are discarded.
+func (b *Broker[T]) Close() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	n := 0
+	for topic, subs := range b.topics {
+		for ch := range subs {
+			b.remove(topic, ch)
+			n++
+		}
+	}
+	return n
+}
+
+// Stats is a snapshot of the broker's state.
+type Stats struct {
+	Subscribers int
+	Topics      int
+	// Queued is the number of published messages not yet received, over all
+	// subscribers; MaxQueued is the backlog of the slowest one.
+	Queued    int
+	MaxQueued int
+	// Dropped counts the subscribers removed for falling behind since the
+	// broker was created.
+	Dropped uint64
+}
+
+func (b *Broker[T]) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Stats{Topics: len(b.topics), Dropped: b.dropped}
+	for _, subs := range b.topics {
+		for ch := range subs {
+			s.Subscribers++
+			s.Queued += len(ch)
+			if len(ch) > s.MaxQueued {
+				s.MaxQueued = len(ch)
+			}
+		}
+	}
+	return s
+}
+
+// Wait blocks until the context of every subscription is done, which for
+// GraphQL subscriptions means that the client has been told the subscription
+// is complete, or until ctx is done.
+func (b *Broker[T]) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Broker[T]) unsubscribe(topic string, ch chan T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.topics[topic][ch]; ok {
+		b.remove(topic, ch)
+	}
+}
+
+// remove must be called with mu held.
+func (b *Broker[T]) remove(topic string, ch chan T) {
+	close(ch)
+	delete(b.topics[topic], ch)
+	if len(b.topics[topic]) == 0 {
+		delete(b.topics, topic)
+	}
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+type userIDKey struct{}
+
+// ClientMiddleware stores the identity of the client in the request context
+// for Subject. The address is that of the TCP peer unless trustProxy is set;
+// then it is the last entry of X-Forwarded-For, the one added by the proxy in
+// front of the server, because earlier entries are supplied by the client.
+// With trustProxy, a non-empty userHeader also names the header in which an
+// authenticating proxy passes the user id; without a proxy the client could
+// set it to anything, so it is ignored then.
+func ClientMiddleware(trustProxy bool, userHeader string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			ip := peerIP(r.RemoteAddr)
+			if trustProxy {
+				if forwarded := lastForwarded(r.Header.Values("X-Forwarded-For")); forwarded != nil {
+					ip = forwarded
+				}
+				if userHeader != "" {
+					if id := strings.TrimSpace(r.Header.Get(userHeader)); id != "" {
+						ctx = context.WithValue(ctx, userIDKey{}, id)
+					}
+				}
+			}
+			if ip != nil {
+				ctx = context.WithValue(ctx, clientIPKey{}, ip)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func peerIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func lastForwarded(values []string) net.IP {
+	if len(values) == 0 {
+		return nil
+	}
+	entries := strings.Split(values[len(values)-1], ",")
+	return net.ParseIP(strings.TrimSpace(entries[len(entries)-1]))
+}
+
+// Subject returns the key under which the budgets of the caller in ctx are
+// kept: "user:<id>" for a user named by the proxy, "ip:<address>" otherwise.
+// IPv6 clients are keyed by their /64 network, since a single host usually
+// controls a whole one. Callers the middleware did not see share "unknown".
+func Subject(ctx context.Context) string {
+	if id, _ := ctx.Value(userIDKey{}).(string); id != "" {
+		return "user:" + id
+	}
+	ip, _ := ctx.Value(clientIPKey{}).(net.IP)
+	if ip == nil {
+		return "unknown"
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return "ip:" + v4.String()
+	}
+	return "ip:" + ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// takeQuery is Limit.take in SQL: the row is only written, and returned, when
+// a token is available. $2 is the refill interval and $3 the period, both in
+// seconds. The database clock is used so that replicas agree on the time.
+const takeQuery = `
+INSERT INTO rate_limits AS b (key, full_at)
+VALUES ($1, now() + make_interval(secs => $2))
+ON CONFLICT (key) DO UPDATE
+SET full_at = GREATEST(b.full_at, now()) + make_interval(secs => $2)
+WHERE GREATEST(b.full_at, now()) + make_interval(secs => $2) - now() <= make_interval(secs => $3)
+RETURNING full_at`
+
+// waitQuery returns, in seconds, how long until the bucket has a token again.
+const waitQuery = `
+SELECT EXTRACT(EPOCH FROM GREATEST(full_at, now()) + make_interval(secs => $2) - now())::double precision - $3
+FROM rate_limits WHERE key = $1`
+
+const sweepQuery = `DELETE FROM rate_limits WHERE full_at < now()`
+
+// Postgres is a Store that keeps the buckets in the rate_limits table, so that
+// every replica sees the same budgets.
+type Postgres struct {
+	db        *sql.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgres returns a store backed by db, whose schema must have the
+// rate_limits table.
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	if limit.Unlimited() {
+		return true, 0, nil
+	}
+	p.sweep(ctx)
+
+	interval, period := limit.interval().Seconds(), limit.Period.Seconds()
+	var full time.Time
+	err := p.db.QueryRowContext(ctx, takeQuery, key, interval, period).Scan(&full)
+	if err == nil {
+		return true, 0, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, 0, fmt.Errorf("failed to take a token: %w", err)
+	}
+
+	// A bucket swept in between is full again: the caller may retry at once.
+	var wait float64
+	err = p.db.QueryRowContext(ctx, waitQuery, key, interval, period).Scan(&wait)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, 0, fmt.Errorf("failed to read the bucket: %w", err)
+	}
+	return false, time.Duration(wait * float64(time.Second)), nil
+}
+
+// sweep drops the full buckets at most once per sweepInterval. Failing to do
+// so only leaves rows behind, so the error is logged and the call goes on.
+func (p *Postgres) sweep(ctx context.Context) {
+	p.mu.Lock()
+	due := time.Since(p.lastSweep) >= sweepInterval
+	if due {
+		p.lastSweep = time.Now()
+	}
+	p.mu.Unlock()
+	if !due {
+		return
+	}
+	if _, err := p.db.ExecContext(ctx, sweepQuery); err != nil {
+		slog.WarnContext(ctx, "failed to drop full rate limit buckets", "error", err)
+	}
+}
@@ -0,0 +1,161 @@
+// Package ratelimit keeps token buckets that limit how often a caller may
+// perform an operation. A bucket holds Count tokens and gets one back every
+// Period/Count; each call spends one. Buckets live in a Store: Memory for a
+// single server, Postgres when several replicas must share the budgets.
+//
+// A bucket is stored as the time at which it will be full again, which makes
+// taking a token a single comparison and lets Postgres do it in one statement.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Count calls per Period, in bursts of up to Count calls. A zero
+// Count means no limit.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseLimit parses limits written as count/period, such as "5/1m" or
+// "30/m". "0" and the empty string mean no limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%q is not a count/period limit", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid count in limit %q", s)
+	}
+	// A bare unit means one of it: "m" is "1m".
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in limit %q", s)
+	}
+	return Limit{Count: n, Period: d}, nil
+}
+
+// Unlimited reports whether the limit lets every call through.
+func (l Limit) Unlimited() bool {
+	return l.Count <= 0
+}
+
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "0"
+	}
+	period := l.Period.String()
+	// 1m0s reads better as 1m, 1h0m0s as 1h.
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+	return fmt.Sprintf("%d/%s", l.Count, period)
+}
+
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Limit) UnmarshalText(text []byte) error {
+	parsed, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// interval is how long the bucket takes to get one token back.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Count)
+}
+
+// take spends a token at now from a bucket that is full again at full (a zero
+// time for a new bucket). It returns the new full time, or false and how long
+// until a token is back.
+func (l Limit) take(full, now time.Time) (time.Time, bool, time.Duration) {
+	if full.Before(now) {
+		full = now
+	}
+	next := full.Add(l.interval())
+	if wait := next.Sub(now) - l.Period; wait > 0 {
+		return full, false, wait
+	}
+	return next, true, 0
+}
+
+// Store keeps the buckets.
+type Store interface {
+	// Take spends a token from the bucket key, which is governed by limit. If
+	// the bucket is empty it returns false and how long until a token is back.
+	Take(ctx context.Context, key string, limit Limit) (ok bool, retryAfter time.Duration, err error)
+}
+
+// sweepInterval is how often stores drop the buckets that are full again,
+// which behave exactly like missing ones.
+const sweepInterval = time.Minute
+
+// Memory is a Store for a single server.
+type Memory struct {
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return NewMemoryWithClock(time.Now)
+}
+
+// NewMemoryWithClock returns an in-memory store that reads the time from now.
+func NewMemoryWithClock(now func() time.Time) *Memory {
+	return &Memory{now: now, buckets: make(map[string]time.Time)}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	if limit.Unlimited() {
+		return true, 0, nil
+	}
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		for k, full := range m.buckets {
+			if !full.After(now) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	full, ok, wait := limit.take(m.buckets[key], now)
+	if ok {
+		m.buckets[key] = full
+	}
+	return ok, wait, nil
+}
+
+// Len returns the number of buckets kept; full ones go at the next sweep.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
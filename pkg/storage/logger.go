@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"log/slog"
+	"time"
+)
+
+// slowQueryThreshold is the duration above which a statement is logged as slow.
+const slowQueryThreshold = time.Second
+
+// slogLogger sends GORM's logs to the default slog logger, which decides what
+// is shown: statements are logged at debug level, slow ones at warn and failed
+// ones at error. The request ID comes from the statement's context. Statements
+// are logged with placeholders: their arguments are user content.
+type slogLogger struct {
+	// level is GORM's own switch: Silent turns logging off and Info, set by
+	// db.Debug(), raises statements to info level.
+	level logger.LogLevel
+}
+
+func newSlogLogger() logger.Interface {
+	return slogLogger{level: logger.Warn}
+}
+
+func (l slogLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return slogLogger{level: level}
+}
+
+// ParamsFilter keeps the arguments out of the statements passed to Trace.
+func (l slogLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+func (l slogLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l slogLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l slogLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l slogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+
+	level := slog.LevelDebug
+	msg := "sql"
+	switch {
+	// A missing row is an answer, not a failure; the repositories report it.
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "sql failed"
+	case elapsed > slowQueryThreshold:
+		level, msg = slog.LevelWarn, "slow sql"
+	case l.level >= logger.Info:
+		level = slog.LevelInfo
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Duration("duration", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
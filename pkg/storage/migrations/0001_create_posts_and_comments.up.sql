@@ -0,0 +1,20 @@
+-- The schema previously created by GORM AutoMigrate. IF NOT EXISTS lets
+-- databases created that way adopt the migration history unchanged.
+CREATE TABLE IF NOT EXISTS posts (
+    id             uuid PRIMARY KEY,
+    text           text NOT NULL,
+    allow_comments boolean NOT NULL,
+    created_at     timestamp with time zone NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id         uuid PRIMARY KEY,
+    text       text NOT NULL,
+    post_id    uuid NOT NULL,
+    parent_id  uuid,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    deleted_at timestamp with time zone,
+    CONSTRAINT chk_comments_text CHECK (length(text) <= 2000)
+);
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_comments_parent_created_at;
+DROP INDEX IF EXISTS idx_comments_post_created_at;
+DROP INDEX IF EXISTS idx_posts_created_at;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_parent_fkey;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_id_post_id_key;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_post_id_fkey;
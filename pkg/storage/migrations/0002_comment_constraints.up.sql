@@ -0,0 +1,23 @@
+-- Foreign keys and the indexes used by pagination. Rows written before this
+-- migration that break the constraints make it fail; fix them and rerun.
+
+-- AutoMigrate created these for the GORM associations; they are replaced below.
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_posts_comments;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_children;
+
+-- Deleting a post removes its whole discussion.
+ALTER TABLE comments ADD CONSTRAINT comments_post_id_fkey
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE;
+
+-- The parent reference includes post_id, so a reply cannot point at a comment
+-- of another post. Comments are deleted softly (deleted_at) and stay in the
+-- table as tombstones, so hard-deleting a comment that still has replies is
+-- refused. NO ACTION rather than RESTRICT lets the post cascade above remove
+-- parents and replies in one statement.
+ALTER TABLE comments ADD CONSTRAINT comments_id_post_id_key UNIQUE (id, post_id);
+ALTER TABLE comments ADD CONSTRAINT comments_parent_fkey
+    FOREIGN KEY (parent_id, post_id) REFERENCES comments (id, post_id) ON DELETE NO ACTION;
+
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_created_at ON comments (post_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_created_at ON comments (parent_id, created_at, id);
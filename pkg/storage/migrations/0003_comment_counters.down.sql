@@ -0,0 +1,2 @@
+ALTER TABLE comments DROP COLUMN reply_count;
+ALTER TABLE posts DROP COLUMN comment_count;
@@ -0,0 +1,12 @@
+-- Denormalized counters of comments that are not deleted: all comments of a
+-- post and the direct replies of a comment. The repositories keep them up to
+-- date; `server counters rebuild` recomputes them.
+ALTER TABLE posts ADD COLUMN comment_count integer NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN reply_count integer NOT NULL DEFAULT 0;
+
+UPDATE posts SET comment_count = (
+    SELECT count(*) FROM comments c WHERE c.post_id = posts.id AND c.deleted_at IS NULL
+);
+UPDATE comments SET reply_count = (
+    SELECT count(*) FROM comments r WHERE r.parent_id = comments.id AND r.deleted_at IS NULL
+);
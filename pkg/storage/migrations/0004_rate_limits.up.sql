@@ -0,0 +1,8 @@
+-- Token buckets of the rate limiter, shared by every replica. A bucket is the
+-- time at which it will be full again; rows in the past are dropped lazily.
+CREATE TABLE rate_limits (
+    key     TEXT PRIMARY KEY,
+    full_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_rate_limits_full_at ON rate_limits (full_at);
@@ -0,0 +1,14 @@
+-- When a post or its discussion last changed: creating or deleting a comment
+-- and repairing a counter move it forward. It versions posts for the ETags of
+-- HTTP responses; the index serves the latest change of the feed.
+ALTER TABLE posts ADD COLUMN updated_at timestamp with time zone;
+
+UPDATE posts SET updated_at = GREATEST(
+    created_at,
+    (SELECT max(c.created_at) FROM comments c WHERE c.post_id = posts.id),
+    (SELECT max(c.deleted_at) FROM comments c WHERE c.post_id = posts.id)
+);
+
+ALTER TABLE posts ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE INDEX idx_posts_updated_at ON posts (updated_at);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS posts_feed_version ON posts;
+DROP FUNCTION IF EXISTS bump_feed_version();
+DROP TABLE IF EXISTS feed_version;
@@ -0,0 +1,22 @@
+-- A version of the feed for the ETags of HTTP responses. The timestamps of
+-- the posts come from the clocks of the replicas and are taken before the
+-- transaction commits, so their maximum can miss a change. Every change of a
+-- post bumps the single row instead; its lock is held until the commit, so
+-- the versions follow the order in which the changes become visible.
+CREATE TABLE feed_version (
+    id      BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    version BIGINT NOT NULL
+);
+
+INSERT INTO feed_version (version) VALUES (0);
+
+CREATE FUNCTION bump_feed_version() RETURNS trigger AS $$
+BEGIN
+    UPDATE feed_version SET version = version + 1;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_feed_version
+    AFTER INSERT OR UPDATE OR DELETE ON posts
+    FOR EACH STATEMENT EXECUTE FUNCTION bump_feed_version();
@@ -0,0 +1,9 @@
+// Package migrations holds the Postgres schema as numbered SQL files. Each
+// version has an up and a down file named NNNN_description.{up,down}.sql; they
+// are compiled into the binary and applied by pkg/migrate.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
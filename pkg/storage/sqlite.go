@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// The domain models carry Postgres-specific column types and defaults, so the
+// SQLite schema is created from plain DDL instead of AutoMigrate.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS posts (
+	id             TEXT PRIMARY KEY,
+	text           TEXT NOT NULL,
+	allow_comments BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at     DATETIME NOT NULL,
+	comment_count  INTEGER NOT NULL DEFAULT 0,
+	updated_at     DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at, id);
+
+CREATE TABLE IF NOT EXISTS comments (
+	id         TEXT PRIMARY KEY,
+	text       TEXT NOT NULL CHECK (length(text) <= 2000),
+	post_id    TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	parent_id  TEXT,
+	created_at DATETIME NOT NULL,
+	deleted_at DATETIME,
+	reply_count INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (id, post_id),
+	-- Matches migration 0002 of the Postgres schema: replies stay within their post.
+	FOREIGN KEY (parent_id, post_id) REFERENCES comments (id, post_id)
+);
+CREATE INDEX IF NOT EXISTS idx_comments_post_created_at ON comments (post_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_created_at ON comments (parent_id, created_at, id);
+
+-- Matches migration 0006 of the Postgres schema: every change of a post bumps
+-- the version of the feed.
+CREATE TABLE IF NOT EXISTS feed_version (
+	id      INTEGER PRIMARY KEY CHECK (id = 1),
+	version INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO feed_version (id, version) VALUES (1, 0);
+CREATE TRIGGER IF NOT EXISTS posts_feed_version_insert AFTER INSERT ON posts
+BEGIN
+	UPDATE feed_version SET version = version + 1;
+END;
+CREATE TRIGGER IF NOT EXISTS posts_feed_version_update AFTER UPDATE ON posts
+BEGIN
+	UPDATE feed_version SET version = version + 1;
+END;
+CREATE TRIGGER IF NOT EXISTS posts_feed_version_delete AFTER DELETE ON posts
+BEGIN
+	UPDATE feed_version SET version = version + 1;
+END;
+`
+
+// OpenSQLite opens (creating if necessary) the SQLite database file at path.
+func OpenSQLite(path string) (*DB, error) {
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         newSlogLogger(),
+		TranslateError: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	if err := db.Use(tracePlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY under
+	// concurrent requests.
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.Exec(sqliteSchema).Error; err != nil {
+		return nil, fmt.Errorf("failed to create sqlite schema: %w", err)
+	}
+	if err := upgradeSQLite(db); err != nil {
+		return nil, fmt.Errorf("failed to upgrade sqlite schema: %w", err)
+	}
+	if err := db.Exec(sqliteLateIndexes).Error; err != nil {
+		return nil, fmt.Errorf("failed to create sqlite schema: %w", err)
+	}
+
+	return &DB{db}, nil
+}
+
+// sqliteColumns lists the columns added after the first release of the SQLite
+// schema, with the statement that fills them in for existing rows.
+var sqliteColumns = []struct {
+	table, column, definition, backfill string
+}{
+	{"posts", "comment_count", "INTEGER NOT NULL DEFAULT 0",
+		`UPDATE posts SET comment_count = (SELECT count(*) FROM comments c WHERE c.post_id = posts.id AND c.deleted_at IS NULL)`},
+	{"comments", "reply_count", "INTEGER NOT NULL DEFAULT 0",
+		`UPDATE comments SET reply_count = (SELECT count(*) FROM comments r WHERE r.parent_id = comments.id AND r.deleted_at IS NULL)`},
+	// ADD COLUMN needs a default for NOT NULL; every row is backfilled.
+	{"posts", "updated_at", "DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00'",
+		`UPDATE posts SET updated_at = max(created_at,
+			coalesce((SELECT max(c.created_at) FROM comments c WHERE c.post_id = posts.id), created_at),
+			coalesce((SELECT max(c.deleted_at) FROM comments c WHERE c.post_id = posts.id), created_at))`},
+}
+
+// sqliteLateIndexes cover columns that upgradeSQLite may have just added.
+const sqliteLateIndexes = `
+CREATE INDEX IF NOT EXISTS idx_posts_updated_at ON posts (updated_at);
+`
+
+// upgradeSQLite adds the columns that files created by older versions lack.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched.
+func upgradeSQLite(db *gorm.DB) error {
+	for _, c := range sqliteColumns {
+		var n int
+		if err := db.Raw("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)).Error; err != nil {
+				return err
+			}
+			return tx.Exec(c.backfill).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"OZON/pkg/tracing"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// tracePlugin wraps the statements run through GORM in client spans that
+// carry the SQL text. As in the logs, the statement keeps its placeholders:
+// the arguments are user content. Only statements that belong to a trace are
+// traced, which leaves out schema setup and other background work.
+type tracePlugin struct{}
+
+func (tracePlugin) Name() string {
+	return "tracing"
+}
+
+func (tracePlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("*").Register("tracing:before_create", startSpan("create")),
+		cb.Create().After("*").Register("tracing:after_create", endSpan),
+		cb.Query().Before("*").Register("tracing:before_query", startSpan("query")),
+		cb.Query().After("*").Register("tracing:after_query", endSpan),
+		cb.Update().Before("*").Register("tracing:before_update", startSpan("update")),
+		cb.Update().After("*").Register("tracing:after_update", endSpan),
+		cb.Delete().Before("*").Register("tracing:before_delete", startSpan("delete")),
+		cb.Delete().After("*").Register("tracing:after_delete", endSpan),
+		cb.Row().Before("*").Register("tracing:before_row", startSpan("row")),
+		cb.Row().After("*").Register("tracing:after_row", endSpan),
+		cb.Raw().Before("*").Register("tracing:before_raw", startSpan("raw")),
+		cb.Raw().After("*").Register("tracing:after_raw", endSpan),
+	)
+}
+
+func startSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement.Context == nil || !trace.SpanContextFromContext(db.Statement.Context).IsValid() {
+			return
+		}
+		name := "gorm." + operation
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+		ctx, span := tracing.Start(db.Statement.Context, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", db.Dialector.Name())),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Statement.Table != "" {
+		span.SetAttributes(attribute.String("db.sql.table", db.Statement.Table))
+	}
+	err := db.Error
+	// As in the logs, a missing row is an answer rather than a failure.
+	tracing.End(span, err, func(err error) bool { return errors.Is(err, gorm.ErrRecordNotFound) })
+}
@@ -0,0 +1,118 @@
+// Package tracing sets up OpenTelemetry for the server. Setup installs the
+// global tracer provider and the W3C trace context propagator; the layers of
+// the server start their spans from the global provider, so they cost next to
+// nothing while tracing is disabled.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+// ServiceName is reported as service.name unless OTEL_SERVICE_NAME overrides it.
+const ServiceName = "ozon"
+
+// instrumentation names the tracer of the spans started by this server.
+const instrumentation = "OZON"
+
+// Options selects where spans go.
+type Options struct {
+	// Exporter is none, otlp or file.
+	Exporter string
+	// OTLPEndpoint is the collector URL; empty defers to the OTEL_EXPORTER_OTLP_*
+	// environment variables and their defaults.
+	OTLPEndpoint string
+	// File is appended to by the file exporter, one JSON span per line.
+	File string
+	// SampleRatio is the fraction of new traces that are recorded.
+	SampleRatio float64
+}
+
+// Setup installs the tracer provider described by opts. The returned function
+// flushes the pending spans and releases the exporter; it must be called
+// before the process exits. With the none exporter Setup changes nothing.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch opts.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var otlpOpts []otlptracehttp.Option
+		if opts.OTLPEndpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, otlpOpts...)
+	case "file":
+		file, err = os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		// A partial resource is still usable; detectors only add attributes.
+		otel.Handle(err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span named name as a child of the span in ctx, using the
+// global tracer provider.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, opts...)
+}
+
+// End records err, if any, on span and ends it. Only internal failures mark
+// the span as failed: expected is consulted for errors that are the caller's
+// fault, such as invalid input, which are recorded but leave the status unset.
+func End(span trace.Span, err error, expected func(error) bool) {
+	if err != nil {
+		span.RecordError(err)
+		if expected == nil || !expected(err) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
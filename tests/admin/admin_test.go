@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"OZON/internal/admin"
+	"OZON/internal/domain"
+	"OZON/internal/repository/memory"
+	"bytes"
+	"context"
+	"github.com/google/uuid"
+	"strings"
+	"testing"
+)
+
+// TestAdmin проверяет обход данных для команд обслуживания
+func TestAdmin(t *testing.T) {
+	t.Run("Stats", testStats)
+	t.Run("StatsEmpty", testStatsEmpty)
+	t.Run("Pagination", testPagination)
+	t.Run("Tree", testTree)
+	t.Run("Excerpt", testExcerpt)
+}
+
+func createPost(t *testing.T, repo *memory.InMemoryRepository, text string) *domain.Post {
+	t.Helper()
+	post, err := repo.CreatePost(context.Background(), &domain.Post{Text: text}, nil)
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	return post
+}
+
+func createComment(t *testing.T, repo *memory.InMemoryRepository, postID uuid.UUID, parentID *uuid.UUID, text string) *domain.Comment {
+	t.Helper()
+	comment, err := repo.CreateComment(context.Background(), &domain.Comment{PostID: postID, ParentID: parentID, Text: text})
+	if err != nil {
+		t.Fatalf("failed to create comment: %v", err)
+	}
+	return comment
+}
+
+// testStats проверяет подсчёт постов, комментариев, самой глубокой ветки и самого обсуждаемого поста
+func testStats(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	quiet := createPost(t, repo, "Quiet")
+	deep := createPost(t, repo, "Deep")
+	busy := createPost(t, repo, "Busy")
+
+	parent := createComment(t, repo, deep.ID, nil, "1")
+	for i := 0; i < 3; i++ {
+		parent = createComment(t, repo, deep.ID, &parent.ID, "reply")
+	}
+	for i := 0; i < 5; i++ {
+		createComment(t, repo, busy.ID, nil, "comment")
+	}
+	deleted := createComment(t, repo, quiet.ID, nil, "Deleted")
+	if err := repo.DeleteComment(context.Background(), deleted.ID); err != nil {
+		t.Fatalf("failed to delete comment: %v", err)
+	}
+
+	stats, err := admin.CollectStats(context.Background(), repo, repo)
+	if err != nil {
+		t.Fatalf("failed to collect stats: %v", err)
+	}
+	want := admin.Stats{
+		Posts:           3,
+		Comments:        9,
+		Deleted:         1,
+		DeepestThread:   4,
+		DeepestPost:     deep.ID,
+		BusiestPost:     busy.ID,
+		BusiestComments: 5,
+	}
+	if *stats != want {
+		t.Errorf("expected %+v, got %+v", want, *stats)
+	}
+}
+
+// testStatsEmpty проверяет статистику пустого хранилища
+func testStatsEmpty(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	stats, err := admin.CollectStats(context.Background(), repo, repo)
+	if err != nil {
+		t.Fatalf("failed to collect stats: %v", err)
+	}
+	if *stats != (admin.Stats{}) {
+		t.Errorf("expected empty stats, got %+v", *stats)
+	}
+}
+
+// testPagination проверяет, что обход не теряет данные за пределами первой страницы
+func testPagination(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	var last *domain.Post
+	for i := 0; i < 150; i++ {
+		last = createPost(t, repo, "Post")
+	}
+	for i := 0; i < 130; i++ {
+		createComment(t, repo, last.ID, nil, "comment")
+	}
+
+	posts := 0
+	if err := admin.EachPost(context.Background(), repo, func(*domain.Post) error {
+		posts++
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to walk posts: %v", err)
+	}
+	comments, err := admin.Comments(context.Background(), repo, last.ID)
+	if err != nil {
+		t.Fatalf("failed to get comments: %v", err)
+	}
+	if posts != 150 || len(comments) != 130 {
+		t.Errorf("expected 150 posts and 130 comments, got %d and %d", posts, len(comments))
+	}
+}
+
+// testTree проверяет отрисовку дерева комментариев
+func testTree(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	post := createPost(t, repo, "Post")
+	first := createComment(t, repo, post.ID, nil, "First")
+	reply := createComment(t, repo, post.ID, &first.ID, "Reply\non two lines")
+	nested := createComment(t, repo, post.ID, &reply.ID, "Nested")
+	second := createComment(t, repo, post.ID, nil, "Second")
+	if err := repo.DeleteComment(context.Background(), reply.ID); err != nil {
+		t.Fatalf("failed to delete comment: %v", err)
+	}
+
+	comments, err := admin.Comments(context.Background(), repo, post.ID)
+	if err != nil {
+		t.Fatalf("failed to get comments: %v", err)
+	}
+	var out bytes.Buffer
+	if err := admin.WriteTree(&out, comments); err != nil {
+		t.Fatalf("failed to write tree: %v", err)
+	}
+	want := strings.Join([]string{
+		"├── " + first.ID.String() + " First",
+		"│   └── " + reply.ID.String() + " [deleted] Reply on two lines",
+		"│       └── " + nested.ID.String() + " Nested",
+		"└── " + second.ID.String() + " Second",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out.String())
+	}
+}
+
+// testExcerpt проверяет сокращение текста до одной строки
+func testExcerpt(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"  two\n\tlines ", 10, "two lines"},
+		{"Привет, мир", 7, "Привет…"},
+		{"exactly", 7, "exactly"},
+	} {
+		if got := admin.Excerpt(tc.text, tc.n); got != tc.want {
+			t.Errorf("Excerpt(%q, %d): expected %q, got %q", tc.text, tc.n, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package admin
+
+import (
+	"OZON/internal/admin"
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	"OZON/internal/repository/memory"
+	"bytes"
+	"context"
+	"github.com/google/uuid"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTransfer проверяет экспорт и импорт в формате JSON Lines
+func TestTransfer(t *testing.T) {
+	t.Run("RoundTrip", testRoundTrip)
+	t.Run("Reimport", testReimport)
+	t.Run("Validation", testValidation)
+	t.Run("DryRun", testDryRun)
+	t.Run("Batches", testBatches)
+}
+
+// seedDiscussion создаёт закрытый пост и пост с веткой, в которой есть удалённый комментарий
+func seedDiscussion(t *testing.T) *memory.InMemoryRepository {
+	t.Helper()
+	repo := memory.NewInMemoryRepository()
+	closed := false
+	if _, err := repo.CreatePost(context.Background(), &domain.Post{Text: "Closed"}, &closed); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	post := createPost(t, repo, "Post with \"quotes\" and <html>")
+	root := createComment(t, repo, post.ID, nil, "Root")
+	reply := createComment(t, repo, post.ID, &root.ID, "Reply")
+	createComment(t, repo, post.ID, &reply.ID, "Nested")
+	createComment(t, repo, post.ID, nil, "Second")
+	if err := repo.DeleteComment(context.Background(), reply.ID); err != nil {
+		t.Fatalf("failed to delete comment: %v", err)
+	}
+	return repo
+}
+
+func export(t *testing.T, repo *memory.InMemoryRepository, nested bool) string {
+	t.Helper()
+	var out bytes.Buffer
+	if _, err := admin.Export(context.Background(), &out, repo, repo, nested); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	return out.String()
+}
+
+func importInto(repo *memory.InMemoryRepository, input string, opts admin.ImportOptions) (admin.Counts, error) {
+	return admin.Import(context.Background(), strings.NewReader(input), repo, repo, repo, opts)
+}
+
+// dump описывает всё содержимое хранилища без времени экспорта
+func dump(t *testing.T, repo *memory.InMemoryRepository) string {
+	t.Helper()
+	out := export(t, repo, false)
+	return out[strings.IndexByte(out, '\n')+1:]
+}
+
+// testRoundTrip проверяет, что плоский и вложенный экспорт переносят данные без изменений
+func testRoundTrip(t *testing.T) {
+	source := seedDiscussion(t)
+	want := dump(t, source)
+	for _, nested := range []bool{false, true} {
+		target := memory.NewInMemoryRepository()
+		counts, err := importInto(target, export(t, source, nested), admin.ImportOptions{})
+		if err != nil {
+			t.Fatalf("nested=%v: failed to import: %v", nested, err)
+		}
+		if counts != (admin.Counts{Posts: 2, Comments: 4}) {
+			t.Errorf("nested=%v: unexpected counts %+v", nested, counts)
+		}
+		if got := dump(t, target); got != want {
+			t.Errorf("nested=%v: expected\n%s\ngot\n%s", nested, want, got)
+		}
+		stats, err := admin.CollectStats(context.Background(), target, target)
+		if err != nil {
+			t.Fatalf("failed to collect stats: %v", err)
+		}
+		posts, err := target.GetPosts(context.Background(), 1, 10)
+		if err != nil {
+			t.Fatalf("failed to get posts: %v", err)
+		}
+		if stats.Comments != 3 || stats.Deleted != 1 || posts[1].CommentCount != 3 {
+			t.Errorf("nested=%v: expected 3 live comments, got %+v and count %d", nested, *stats, posts[1].CommentCount)
+		}
+	}
+}
+
+// testReimport проверяет, что повторный импорт пропускает сохранённые строки
+func testReimport(t *testing.T) {
+	source := seedDiscussion(t)
+	input := export(t, source, false)
+	want := dump(t, source)
+	counts, err := importInto(source, input, admin.ImportOptions{})
+	if err != nil {
+		t.Fatalf("failed to import again: %v", err)
+	}
+	if counts != (admin.Counts{Posts: 2, Comments: 4, SkippedPosts: 2, SkippedComments: 4}) {
+		t.Errorf("expected everything to be skipped, got %+v", counts)
+	}
+	if got := dump(t, source); got != want {
+		t.Errorf("a repeated import must not change the data, got\n%s", got)
+	}
+}
+
+// testValidation проверяет отказ при нарушении ссылочной целостности и формата
+func testValidation(t *testing.T) {
+	header := `{"type":"header","version":1,"exportedAt":"2024-01-01T00:00:00Z"}` + "\n"
+	post, other, root := uuid.New(), uuid.New(), uuid.New()
+	postLine := func(id uuid.UUID) string {
+		return `{"type":"post","id":"` + id.String() + `","text":"Post","allowComments":true,"createdAt":"2024-01-01T00:00:00Z"}` + "\n"
+	}
+	commentLine := func(id, postID uuid.UUID, parentID *uuid.UUID) string {
+		parent := ""
+		if parentID != nil {
+			parent = `"parentId":"` + parentID.String() + `",`
+		}
+		return `{"type":"comment","id":"` + id.String() + `","postId":"` + postID.String() + `",` + parent +
+			`"text":"Comment","createdAt":"2024-01-01T00:00:00Z"}` + "\n"
+	}
+
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"MissingPost", header + commentLine(root, post, nil), "post " + post.String() + " not found"},
+		{"ParentAfterReply", header + postLine(post) + commentLine(uuid.New(), post, &root) + commentLine(root, post, nil), "parents must come before"},
+		{"ParentOnOtherPost", header + postLine(post) + postLine(other) + commentLine(root, post, nil) + commentLine(uuid.New(), other, &root), "belongs to another post"},
+		{"DuplicatePost", header + postLine(post) + postLine(post), "duplicate id"},
+		{"DuplicateComment", header + postLine(post) + commentLine(root, post, nil) + commentLine(root, post, nil), "duplicate id"},
+		{"Version", `{"type":"header","version":2,"exportedAt":"2024-01-01T00:00:00Z"}` + "\n", "unsupported format version 2"},
+		{"UnknownField", header + strings.Replace(postLine(post), `"text"`, `"title":"x","text"`, 1), "unknown field"},
+		{"UnknownType", header + `{"type":"user"}` + "\n", "unknown record type"},
+		{"NestingMismatch", header + `{"type":"post","id":"` + post.String() + `","text":"Post","createdAt":"2024-01-01T00:00:00Z","comments":[{"id":"` +
+			root.String() + `","postId":"` + other.String() + `","text":"Comment","createdAt":"2024-01-01T00:00:00Z"}]}` + "\n", "must match the nesting"},
+	} {
+		repo := memory.NewInMemoryRepository()
+		_, err := importInto(repo, tc.input, admin.ImportOptions{})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	// A comment may refer to a post and a parent stored before the import.
+	repo := memory.NewInMemoryRepository()
+	stored := createPost(t, repo, "Stored")
+	parent := createComment(t, repo, stored.ID, nil, "Parent")
+	counts, err := importInto(repo, header+commentLine(uuid.New(), stored.ID, &parent.ID), admin.ImportOptions{})
+	if err != nil || counts.Comments != 1 || counts.SkippedComments != 0 {
+		t.Errorf("expected a reply to a stored comment to be imported, got %+v, %v", counts, err)
+	}
+	if got := mustGetComment(t, repo, parent.ID).ReplyCount; got != 1 {
+		t.Errorf("expected the stored parent to count the reply, got %d", got)
+	}
+}
+
+// testDryRun проверяет, что пробный импорт ничего не сохраняет
+func testDryRun(t *testing.T) {
+	input := export(t, seedDiscussion(t), true)
+	target := memory.NewInMemoryRepository()
+	counts, err := importInto(target, input, admin.ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+	if counts != (admin.Counts{Posts: 2, Comments: 4}) {
+		t.Errorf("unexpected counts %+v", counts)
+	}
+	if version, _ := target.FeedVersion(context.Background()); version != 0 {
+		t.Errorf("a dry run must store nothing, feed version %d", version)
+	}
+}
+
+// countingImporter запоминает число строк, сохранённых каждым пакетом
+type countingImporter struct {
+	*memory.InMemoryRepository
+	batches []int
+}
+
+func (r *countingImporter) Import(ctx context.Context, posts []*domain.Post, comments []*domain.Comment) (repository.ImportResult, error) {
+	result, err := r.InMemoryRepository.Import(ctx, posts, comments)
+	r.batches = append(r.batches, len(result.PostIDs)+result.Comments)
+	return result, err
+}
+
+// testBatches проверяет, что пакеты не больше --batch-size даже внутри поста, а updatedAt постов сохраняется
+func testBatches(t *testing.T) {
+	source := memory.NewInMemoryRepository()
+	for i := 0; i < 3; i++ {
+		post := createPost(t, source, "Post")
+		createComment(t, source, post.ID, nil, "Comment")
+		createComment(t, source, post.ID, nil, "Comment")
+	}
+	busy := createPost(t, source, "Busy")
+	parent := createComment(t, source, busy.ID, nil, "Root")
+	for i := 0; i < 8; i++ {
+		parent = createComment(t, source, busy.ID, &parent.ID, "Reply")
+	}
+	time.Sleep(time.Millisecond)
+
+	for _, nested := range []bool{false, true} {
+		target := &countingImporter{InMemoryRepository: memory.NewInMemoryRepository()}
+		counts, err := admin.Import(context.Background(), strings.NewReader(export(t, source, nested)), target, target, target, admin.ImportOptions{BatchSize: 2})
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		total := 0
+		for _, n := range target.batches {
+			if n > 2 {
+				t.Errorf("nested %v: expected at most 2 rows per batch, got %v", nested, target.batches)
+				break
+			}
+			total += n
+		}
+		if total != counts.Posts+counts.Comments {
+			t.Errorf("nested %v: expected %d rows in the batches, got %v", nested, counts.Posts+counts.Comments, target.batches)
+		}
+		if got, want := dump(t, target.InMemoryRepository), dump(t, source); got != want {
+			t.Errorf("nested %v: expected\n%s\ngot\n%s", nested, want, got)
+		}
+	}
+}
+
+func mustGetComment(t *testing.T, repo *memory.InMemoryRepository, id uuid.UUID) *domain.Comment {
+	t.Helper()
+	comment, err := repo.GetComment(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to get comment: %v", err)
+	}
+	return comment
+}
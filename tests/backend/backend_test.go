@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"OZON/internal/repository/backend"
+	"context"
+	"path/filepath"
+	"testing"
+
+	_ "OZON/internal/repository/memory"
+	_ "OZON/internal/repository/sqlite"
+)
+
+// TestRegistry проверяет выбор хранилища через реестр бэкендов
+func TestRegistry(t *testing.T) {
+	t.Run("Names", testNames)
+	t.Run("UnknownBackend", testUnknownBackend)
+	t.Run("OpenInMemory", testOpenInMemory)
+	t.Run("OpenSQLite", testOpenSQLite)
+	t.Run("DuplicateRegistration", testDuplicateRegistration)
+}
+
+func testNames(t *testing.T) {
+	names := backend.Names()
+	want := map[string]bool{"inmemory": true, "postgres": true, "sqlite": true}
+	for _, name := range names {
+		delete(want, name)
+	}
+	if len(want) != 0 {
+		t.Errorf("backends not registered: %v (got %v)", want, names)
+	}
+}
+
+func testUnknownBackend(t *testing.T) {
+	if _, err := backend.Open("mongodb", backend.Settings{}); err == nil {
+		t.Errorf("expected error for unknown backend")
+	}
+}
+
+// testOpenInMemory проверяет, что in-memory открывается без подключения к Postgres
+func testOpenInMemory(t *testing.T) {
+	s, err := backend.Open("inmemory", backend.Settings{})
+	if err != nil {
+		t.Fatalf("failed to open inmemory backend: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := s.PostRepository.GetPosts(context.Background(), 1, 10); err != nil {
+		t.Errorf("failed to use inmemory backend: %v", err)
+	}
+}
+
+func testOpenSQLite(t *testing.T) {
+	s, err := backend.Open("sqlite", backend.Settings{SQLitePath: filepath.Join(t.TempDir(), "ozon.db")})
+	if err != nil {
+		t.Fatalf("failed to open sqlite backend: %v", err)
+	}
+	if _, err := s.PostRepository.GetPosts(context.Background(), 1, 10); err != nil {
+		t.Errorf("failed to use sqlite backend: %v", err)
+	}
+	if err := s.Check(context.Background()); err != nil {
+		t.Errorf("expected open sqlite backend to be ready: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("failed to close sqlite backend: %v", err)
+	}
+	if err := s.Check(context.Background()); err == nil {
+		t.Errorf("expected closed sqlite backend not to be ready")
+	}
+}
+
+func testDuplicateRegistration(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on duplicate registration")
+		}
+	}()
+	backend.Register("inmemory", nil)
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository/backend"
+	"OZON/internal/repository/cache"
+	"OZON/internal/repository/memory"
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+// TestCache проверяет кэш постов и первых страниц комментариев в LRU и в Redis
+func TestCache(t *testing.T) {
+	t.Run("LRU", func(t *testing.T) {
+		runSuite(t, func(t *testing.T, ttl time.Duration) (cache.Cache, func()) {
+			c, err := cache.NewLRU(100)
+			if err != nil {
+				t.Fatalf("failed to create the cache: %v", err)
+			}
+			return c, func() { time.Sleep(ttl + 20*time.Millisecond) }
+		})
+	})
+	t.Run("Redis", func(t *testing.T) {
+		runSuite(t, func(t *testing.T, ttl time.Duration) (cache.Cache, func()) {
+			mr := miniredis.RunT(t)
+			c, err := cache.NewRedis("redis://" + mr.Addr() + "/0")
+			if err != nil {
+				t.Fatalf("failed to create the cache: %v", err)
+			}
+			t.Cleanup(func() { c.Close() })
+			return c, func() { mr.FastForward(ttl) }
+		})
+	})
+	t.Run("RedisDown", testRedisDown)
+}
+
+// newCache создаёт кэш и функцию, после которой истекает ttl
+type newCache func(t *testing.T, ttl time.Duration) (c cache.Cache, expire func())
+
+func runSuite(t *testing.T, newCache newCache) {
+	t.Run("Hit", func(t *testing.T) { testHit(t, newCache) })
+	t.Run("Copies", func(t *testing.T) { testCopies(t, newCache) })
+	t.Run("CreateComment", func(t *testing.T) { testCreateComment(t, newCache) })
+	t.Run("DeleteComment", func(t *testing.T) { testDeleteComment(t, newCache) })
+	t.Run("OtherPages", func(t *testing.T) { testOtherPages(t, newCache) })
+	t.Run("TTL", func(t *testing.T) { testTTL(t, newCache) })
+}
+
+// countingRepository считает обращения к репозиторию за кэшем
+type countingRepository struct {
+	*memory.InMemoryRepository
+	getPost     int
+	getComments int
+}
+
+func (r *countingRepository) GetPost(ctx context.Context, id uuid.UUID, commentPage, commentLimit int32) (*domain.Post, error) {
+	r.getPost++
+	return r.InMemoryRepository.GetPost(ctx, id, commentPage, commentLimit)
+}
+
+func (r *countingRepository) GetCommentsForPost(ctx context.Context, postID uuid.UUID, page, limit int32) ([]*domain.Comment, error) {
+	r.getComments++
+	return r.InMemoryRepository.GetCommentsForPost(ctx, postID, page, limit)
+}
+
+type fixture struct {
+	t       *testing.T
+	repo    *countingRepository
+	storage *backend.Storage
+	post    *domain.Post
+}
+
+func newFixture(t *testing.T, c cache.Cache, ttl time.Duration) *fixture {
+	t.Helper()
+	repo := &countingRepository{InMemoryRepository: memory.NewInMemoryRepository()}
+	storage := &backend.Storage{PostRepository: repo, CommentRepository: repo}
+	cache.Decorate(storage, c, ttl)
+
+	post, err := repo.CreatePost(context.Background(), &domain.Post{Text: "Post"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create a post: %v", err)
+	}
+	return &fixture{t: t, repo: repo, storage: storage, post: post}
+}
+
+func (f *fixture) getPost(page int32) *domain.Post {
+	f.t.Helper()
+	post, err := f.storage.PostRepository.GetPost(context.Background(), f.post.ID, page, 10)
+	if err != nil {
+		f.t.Fatalf("failed to get the post: %v", err)
+	}
+	return post
+}
+
+func (f *fixture) getComments(page int32) []*domain.Comment {
+	f.t.Helper()
+	comments, err := f.storage.CommentRepository.GetCommentsForPost(context.Background(), f.post.ID, page, 10)
+	if err != nil {
+		f.t.Fatalf("failed to get comments: %v", err)
+	}
+	return comments
+}
+
+func (f *fixture) createComment(parentID *uuid.UUID) *domain.Comment {
+	f.t.Helper()
+	comment, err := f.storage.CommentRepository.CreateComment(context.Background(), &domain.Comment{
+		Text:     "Comment",
+		PostID:   f.post.ID,
+		ParentID: parentID,
+	})
+	if err != nil {
+		f.t.Fatalf("failed to create a comment: %v", err)
+	}
+	return comment
+}
+
+// testHit проверяет, что повторное чтение не доходит до репозитория
+func testHit(t *testing.T, newCache newCache) {
+	c, _ := newCache(t, time.Minute)
+	f := newFixture(t, c, time.Minute)
+	f.createComment(nil)
+
+	for i := 0; i < 3; i++ {
+		if post := f.getPost(1); post.Text != "Post" || post.CommentCount != 1 {
+			t.Fatalf("unexpected post %+v", post)
+		}
+		if comments := f.getComments(1); len(comments) != 1 {
+			t.Fatalf("expected 1 comment, got %d", len(comments))
+		}
+	}
+	if f.repo.getPost != 1 || f.repo.getComments != 1 {
+		t.Errorf("expected one repository read each, got GetPost=%d GetCommentsForPost=%d", f.repo.getPost, f.repo.getComments)
+	}
+
+	if _, err := f.storage.PostRepository.GetPost(context.Background(), uuid.New(), 1, 10); err == nil {
+		t.Error("a missing post must stay an error")
+	}
+}
+
+// testCopies проверяет, что изменение прочитанного поста не портит кэш
+func testCopies(t *testing.T, newCache newCache) {
+	c, _ := newCache(t, time.Minute)
+	f := newFixture(t, c, time.Minute)
+	f.getPost(1)
+
+	f.getPost(1).Text = "Changed"
+	if post := f.getPost(1); post.Text != "Post" {
+		t.Errorf("cached post was changed through a returned copy: %q", post.Text)
+	}
+}
+
+// testCreateComment проверяет сброс кэша поста при новом комментарии и ответе
+func testCreateComment(t *testing.T, newCache newCache) {
+	c, _ := newCache(t, time.Minute)
+	f := newFixture(t, c, time.Minute)
+	f.getPost(1)
+	f.getComments(1)
+
+	root := f.createComment(nil)
+	if post := f.getPost(1); post.CommentCount != 1 {
+		t.Errorf("expected CommentCount 1 after a comment, got %d", post.CommentCount)
+	}
+	if comments := f.getComments(1); len(comments) != 1 {
+		t.Errorf("expected 1 comment after a comment, got %d", len(comments))
+	}
+
+	f.createComment(&root.ID)
+	if post := f.getPost(1); post.CommentCount != 2 {
+		t.Errorf("expected CommentCount 2 after a reply, got %d", post.CommentCount)
+	}
+	if comments := f.getComments(1); comments[0].ReplyCount != 1 {
+		t.Errorf("expected ReplyCount 1 after a reply, got %d", comments[0].ReplyCount)
+	}
+}
+
+// testDeleteComment проверяет сброс кэша поста при удалении комментария
+func testDeleteComment(t *testing.T, newCache newCache) {
+	c, _ := newCache(t, time.Minute)
+	f := newFixture(t, c, time.Minute)
+	comment := f.createComment(nil)
+	f.getPost(1)
+	f.getComments(1)
+
+	if err := f.storage.CommentRepository.DeleteComment(context.Background(), comment.ID); err != nil {
+		t.Fatalf("failed to delete the comment: %v", err)
+	}
+	if post := f.getPost(1); post.CommentCount != 0 {
+		t.Errorf("expected CommentCount 0 after a delete, got %d", post.CommentCount)
+	}
+	if comments := f.getComments(1); len(comments) != 1 || !comments[0].IsDeleted() {
+		t.Errorf("expected the comment to be shown as deleted, got %+v", comments)
+	}
+}
+
+// testOtherPages проверяет, что кэшируется только первая страница комментариев
+func testOtherPages(t *testing.T, newCache newCache) {
+	c, _ := newCache(t, time.Minute)
+	f := newFixture(t, c, time.Minute)
+	f.getPost(2)
+	f.getPost(2)
+	f.getComments(2)
+	f.getComments(2)
+	if f.repo.getPost != 2 || f.repo.getComments != 2 {
+		t.Errorf("later pages must not be cached, got GetPost=%d GetCommentsForPost=%d", f.repo.getPost, f.repo.getComments)
+	}
+}
+
+// testTTL проверяет, что запись перечитывается после истечения TTL
+func testTTL(t *testing.T, newCache newCache) {
+	const ttl = 50 * time.Millisecond
+	c, expire := newCache(t, ttl)
+	f := newFixture(t, c, ttl)
+	f.getPost(1)
+
+	// Изменение в обход декоратора, например с другой реплики
+	if _, err := f.repo.CreateComment(context.Background(), &domain.Comment{Text: "Comment", PostID: f.post.ID}); err != nil {
+		t.Fatalf("failed to create a comment: %v", err)
+	}
+	if post := f.getPost(1); post.CommentCount != 0 {
+		t.Fatalf("expected the cached post before the TTL, got CommentCount %d", post.CommentCount)
+	}
+	expire()
+	if post := f.getPost(1); post.CommentCount != 1 {
+		t.Errorf("expected a fresh post after the TTL, got CommentCount %d", post.CommentCount)
+	}
+}
+
+// testRedisDown проверяет, что недоступный Redis не ломает чтение и запись
+func testRedisDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := cache.NewRedis("redis://" + mr.Addr() + "/0")
+	if err != nil {
+		t.Fatalf("failed to create the cache: %v", err)
+	}
+	defer c.Close()
+	f := newFixture(t, c, time.Minute)
+	mr.Close()
+
+	f.createComment(nil)
+	if post := f.getPost(1); post.CommentCount != 1 {
+		t.Errorf("expected the post from the repository, got CommentCount %d", post.CommentCount)
+	}
+	if f.getPost(1); f.repo.getPost != 2 {
+		t.Errorf("every read must reach the repository, got %d", f.repo.getPost)
+	}
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"OZON/internal/config"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConfig проверяет загрузку конфигурации из файла, окружения и флагов
+func TestConfig(t *testing.T) {
+	t.Run("Defaults", testDefaults)
+	t.Run("Precedence", testPrecedence)
+	t.Run("ExampleFile", testExampleFile)
+	t.Run("UnknownFileKey", testUnknownFileKey)
+	t.Run("Validation", testValidation)
+	t.Run("InvalidEnvValue", testInvalidEnvValue)
+	t.Run("Redacted", testRedacted)
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func testDefaults(t *testing.T) {
+	loaded, err := config.Load(nil, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("failed to load defaults: %v", err)
+	}
+	if loaded.Config.Server.ListenAddr != ":8080" || loaded.Config.Storage.Type != "postgres" {
+		t.Errorf("unexpected defaults: %+v", loaded.Config)
+	}
+	if loaded.Config.Production() {
+		t.Errorf("expected development mode by default")
+	}
+}
+
+// testPrecedence проверяет порядок: файл < переменные окружения < флаги
+func testPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  listen_addr: ":9000"
+storage:
+  type: sqlite
+  sqlite:
+    path: from-file.db
+limits:
+  max_comment_depth: 3
+log:
+  level: warn
+ratelimit:
+  create_post: 1/h
+`)
+	loaded, err := config.Load(
+		[]string{"--storage", "inmemory", "--inmemory-fsync-interval=250ms", "--playground=false"},
+		env(map[string]string{
+			"OZON_CONFIG":                path,
+			"OZON_STORAGE":               "postgres",
+			"OZON_LISTEN_ADDR":           "127.0.0.1:9100",
+			"MAX_COMMENT_DEPTH":          "5",
+			"OZON_TRACING_SAMPLE_RATIO":  "0.25",
+			"OZON_RATELIMIT_CREATE_POST": "2/30s",
+			"OZON_METRICS_OPERATIONS":    "Feed, Post,,",
+		}),
+		io.Discard,
+	)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	cfg := loaded.Config
+
+	if cfg.Storage.Type != "inmemory" {
+		t.Errorf("flag must override env and file: storage.type = %q", cfg.Storage.Type)
+	}
+	if cfg.Server.ListenAddr != "127.0.0.1:9100" {
+		t.Errorf("env must override file: server.listen_addr = %q", cfg.Server.ListenAddr)
+	}
+	if cfg.Limits.MaxCommentDepth != 5 {
+		t.Errorf("env must override file: limits.max_comment_depth = %d", cfg.Limits.MaxCommentDepth)
+	}
+	if cfg.Storage.SQLite.Path != "from-file.db" || cfg.Log.Level != "warn" {
+		t.Errorf("file values must override defaults: %+v", cfg)
+	}
+	if cfg.Storage.InMemory.FsyncInterval != 250*time.Millisecond {
+		t.Errorf("storage.inmemory.fsync_interval = %s", cfg.Storage.InMemory.FsyncInterval)
+	}
+	if cfg.RateLimit.CreatePost.String() != "2/30s" {
+		t.Errorf("ratelimit.create_post = %s", cfg.RateLimit.CreatePost)
+	}
+	if got := cfg.Features.MetricsOperations; !reflect.DeepEqual(got, []string{"Feed", "Post"}) {
+		t.Errorf("features.metrics_operations = %q", got)
+	}
+	if cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("tracing.sample_ratio = %g", cfg.Tracing.SampleRatio)
+	}
+	if cfg.Features.Playground || !cfg.Features.Introspection {
+		t.Errorf("unexpected features: %+v", cfg.Features)
+	}
+}
+
+func testExampleFile(t *testing.T) {
+	loaded, err := config.Load([]string{"--config", "../../config.example.yaml"}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("failed to load config.example.yaml: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Config, config.Default()) {
+		t.Errorf("config.example.yaml must match the defaults:\n%s", loaded.Config.Redacted())
+	}
+}
+
+func testUnknownFileKey(t *testing.T) {
+	path := writeFile(t, "server:\n  listen_address: \":9000\"\n")
+	if _, err := config.Load([]string{"--config", path}, env(nil), io.Discard); err == nil {
+		t.Errorf("expected error for unknown key")
+	}
+}
+
+func testValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		key  string
+	}{
+		{"ListenAddr", []string{"--listen-addr", "8080"}, "server.listen_addr"},
+		{"Port", []string{"--listen-addr", ":99999"}, "server.listen_addr"},
+		{"Environment", []string{"--env", "staging"}, "server.environment"},
+		{"ShutdownTimeout", []string{"--shutdown-timeout", "0s"}, "server.shutdown_timeout"},
+		{"DrainDelay", []string{"--drain-delay", "-1s"}, "server.drain_delay"},
+		{"Storage", []string{"--storage", "mongodb"}, "storage.type"},
+		{"MaxOpenConns", []string{"--postgres-max-open-conns", "-1"}, "storage.postgres.max_open_conns"},
+		{"MaxIdleConns", []string{"--postgres-max-open-conns", "2", "--postgres-max-idle-conns", "3"}, "storage.postgres.max_idle_conns"},
+		{"ConnMaxLifetime", []string{"--postgres-conn-max-lifetime", "-1m"}, "storage.postgres.conn_max_lifetime"},
+		{"Fsync", []string{"--inmemory-fsync", "sometimes"}, "storage.inmemory.fsync"},
+		{"FsyncInterval", []string{"--inmemory-fsync", "interval", "--inmemory-fsync-interval", "0s"}, "storage.inmemory.fsync_interval"},
+		{"MaxCommentDepth", []string{"--max-comment-depth", "-2"}, "limits.max_comment_depth"},
+		{"LogLevel", []string{"--log-level", "trace"}, "log.level"},
+		{"LogFormat", []string{"--log-format", "xml"}, "log.format"},
+		{"TracingExporter", []string{"--tracing-exporter", "jaeger"}, "tracing.exporter"},
+		{"TracingEndpoint", []string{"--tracing-exporter", "otlp", "--tracing-otlp-endpoint", "localhost:4318"}, "tracing.otlp_endpoint"},
+		{"TracingFile", []string{"--tracing-exporter", "file", "--tracing-file", ""}, "tracing.file"},
+		{"SampleRatio", []string{"--tracing-sample-ratio", "1.5"}, "tracing.sample_ratio"},
+		{"RateLimitStorage", []string{"--ratelimit-storage", "redis"}, "ratelimit.storage"},
+		{"RateLimitUserHeader", []string{"--ratelimit-user-header", "X-User-Id"}, "ratelimit.user_header"},
+		{"RateLimitPostgres", []string{"--storage", "inmemory", "--ratelimit-storage", "postgres"}, "ratelimit.storage"},
+		{"Cache", []string{"--cache", "memcached"}, "cache.type"},
+		{"CacheTTL", []string{"--cache", "lru", "--cache-ttl", "0s"}, "cache.ttl"},
+		{"CacheLRUSize", []string{"--cache", "lru", "--cache-lru-size", "0"}, "cache.lru_size"},
+		{"CacheRedisURL", []string{"--cache", "redis", "--cache-redis-url", "localhost:6379"}, "cache.redis_url"},
+		{"APQCache", []string{"--apq-cache", "memcached"}, "queries.apq_cache"},
+		{"APQCacheSize", []string{"--apq-cache-size", "0"}, "queries.apq_cache_size"},
+		{"APQRedisURL", []string{"--apq-cache", "redis", "--cache-redis-url", "localhost:6379"}, "cache.redis_url"},
+		{"Allowlist", []string{"--query-allowlist"}, "queries.allowlist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.Load(tt.args, env(nil), io.Discard)
+			if err == nil {
+				t.Fatalf("expected validation error")
+			}
+			if !strings.Contains(err.Error(), tt.key+":") {
+				t.Errorf("error must name %s, got: %v", tt.key, err)
+			}
+		})
+	}
+}
+
+func testInvalidEnvValue(t *testing.T) {
+	_, err := config.Load(nil, env(map[string]string{"MAX_COMMENT_DEPTH": "deep"}), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "MAX_COMMENT_DEPTH") {
+		t.Errorf("expected error naming MAX_COMMENT_DEPTH, got %v", err)
+	}
+	_, err = config.Load(nil, env(map[string]string{"OZON_RATELIMIT_CREATE_COMMENT": "30 per minute"}), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "OZON_RATELIMIT_CREATE_COMMENT") {
+		t.Errorf("expected error naming OZON_RATELIMIT_CREATE_COMMENT, got %v", err)
+	}
+}
+
+func testRedacted(t *testing.T) {
+	loaded, err := config.Load([]string{"--postgres-url", "postgres://admin:s3cret@db:5432/ozon"}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	out := loaded.Config.Redacted()
+	if strings.Contains(out, "s3cret") {
+		t.Errorf("password leaked:\n%s", out)
+	}
+	if !strings.Contains(out, "postgres://admin:xxxxx@db:5432/ozon") {
+		t.Errorf("expected redacted URL:\n%s", out)
+	}
+	if loaded.Config.Storage.Postgres.URL != "postgres://admin:s3cret@db:5432/ozon" {
+		t.Errorf("Redacted must not modify the configuration")
+	}
+
+	loaded, err = config.Load([]string{"--postgres-url", "host=db password=s3cret"}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if strings.Contains(loaded.Config.Redacted(), "s3cret") {
+		t.Errorf("password leaked from DSN:\n%s", loaded.Config.Redacted())
+	}
+
+	loaded, err = config.Load([]string{"--cache", "redis", "--cache-redis-url", "redis://:s3cret@cache:6379/0"}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if strings.Contains(loaded.Config.Redacted(), "s3cret") {
+		t.Errorf("password leaked from the Redis URL:\n%s", loaded.Config.Redacted())
+	}
+}
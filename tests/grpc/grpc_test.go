@@ -0,0 +1,321 @@
+package grpc
+
+import (
+	ozonv1 "OZON/api/ozon/v1"
+	"OZON/graph"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/repository/memory"
+	"OZON/internal/usecases"
+	"OZON/pkg/pubsub"
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGRPC проверяет gRPC API поверх usecases
+func TestGRPC(t *testing.T) {
+	t.Run("Posts", testGRPCPosts)
+	t.Run("Comments", testGRPCComments)
+	t.Run("Errors", testGRPCErrors)
+	t.Run("Watch", testGRPCWatch)
+	t.Run("RequestID", testGRPCRequestID)
+}
+
+type grpcServer struct {
+	posts    ozonv1.PostServiceClient
+	comments ozonv1.CommentServiceClient
+	graphql  http.Handler
+	broker   *pubsub.Broker[*domain.Comment]
+}
+
+// newGRPCServer запускает gRPC-сервер в памяти и GraphQL над теми же usecases
+func newGRPCServer(t *testing.T, admin bool) *grpcServer {
+	t.Helper()
+	repo := memory.NewInMemoryRepository()
+	broker := pubsub.New[*domain.Comment]()
+	resolver := handlers.NewResolver(usecases.NewPostUsecase(repo, repo), usecases.NewCommentUsecase(repo, repo, 0), broker)
+
+	listener := bufconn.Listen(1 << 20)
+	server := handlers.NewGRPCServer(resolver, true, admin)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	return &grpcServer{
+		posts:    ozonv1.NewPostServiceClient(conn),
+		comments: ozonv1.NewCommentServiceClient(conn),
+		graphql:  srv,
+		broker:   broker,
+	}
+}
+
+func (s *grpcServer) createPost(t *testing.T, text string) *ozonv1.Post {
+	t.Helper()
+	post, err := s.posts.CreatePost(context.Background(), &ozonv1.CreatePostRequest{Text: text})
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	return post
+}
+
+func (s *grpcServer) createComment(t *testing.T, req *ozonv1.CreateCommentRequest) *ozonv1.Comment {
+	t.Helper()
+	comment, err := s.comments.CreateComment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("failed to create comment: %v", err)
+	}
+	return comment
+}
+
+// testGRPCPosts проверяет создание, получение и список постов
+func testGRPCPosts(t *testing.T) {
+	s := newGRPCServer(t, true)
+	ctx := context.Background()
+	first := s.createPost(t, "First")
+	closed, err := s.posts.CreatePost(ctx, &ozonv1.CreatePostRequest{Text: "Closed", AllowComments: ptr(false)})
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	if !first.GetAllowComments() || closed.GetAllowComments() || first.GetCreatedAt() == nil {
+		t.Errorf("unexpected posts %v %v", first, closed)
+	}
+
+	got, err := s.posts.GetPost(ctx, &ozonv1.GetPostRequest{Id: first.GetId()})
+	if err != nil || got.GetText() != "First" {
+		t.Fatalf("expected the post, got %v %v", got, err)
+	}
+
+	list, err := s.posts.ListPosts(ctx, &ozonv1.ListPostsRequest{Limit: 1})
+	if err != nil || len(list.GetPosts()) != 1 || list.GetPosts()[0].GetId() != first.GetId() {
+		t.Fatalf("expected the first post, got %v %v", list, err)
+	}
+	list, err = s.posts.ListPosts(ctx, &ozonv1.ListPostsRequest{})
+	if err != nil || len(list.GetPosts()) != 2 {
+		t.Fatalf("unset page and limit must list both posts, got %v %v", list, err)
+	}
+
+	allowed, err := s.posts.IsCommentsAllowed(ctx, &ozonv1.IsCommentsAllowedRequest{PostId: closed.GetId()})
+	if err != nil || allowed.GetAllowed() {
+		t.Errorf("comments must be closed, got %v %v", allowed, err)
+	}
+}
+
+// testGRPCComments проверяет дерево комментариев, удаление и пересчёт счётчиков
+func testGRPCComments(t *testing.T) {
+	s := newGRPCServer(t, true)
+	ctx := context.Background()
+	post := s.createPost(t, "Post")
+	parent := s.createComment(t, &ozonv1.CreateCommentRequest{PostId: post.GetId(), Text: "Parent"})
+	reply := s.createComment(t, &ozonv1.CreateCommentRequest{PostId: post.GetId(), Text: "Reply", ParentId: ptr(parent.GetId())})
+	if parent.ParentId != nil || reply.GetParentId() != parent.GetId() || reply.GetPostId() != post.GetId() {
+		t.Errorf("unexpected comments %v %v", parent, reply)
+	}
+
+	list, err := s.comments.ListComments(ctx, &ozonv1.ListCommentsRequest{PostId: post.GetId()})
+	if err != nil || len(list.GetComments()) != 1 {
+		t.Fatalf("expected one top-level comment, got %v %v", list, err)
+	}
+	if children := list.GetComments()[0].GetChildren(); len(children) != 1 || children[0].GetId() != reply.GetId() {
+		t.Errorf("expected the reply as a child, got %v", children)
+	}
+
+	if _, err := s.comments.DeleteComment(ctx, &ozonv1.DeleteCommentRequest{Id: reply.GetId()}); err != nil {
+		t.Fatalf("failed to delete comment: %v", err)
+	}
+	got, err := s.posts.GetPost(ctx, &ozonv1.GetPostRequest{Id: post.GetId()})
+	if err != nil {
+		t.Fatalf("failed to get post: %v", err)
+	}
+	if got.GetCommentCount() != 1 || got.GetComments()[0].GetChildren()[0].GetDeletedAt() == nil {
+		t.Errorf("expected the reply to be deleted, got %v", got)
+	}
+
+	rebuilt, err := s.comments.RebuildCounters(ctx, &ozonv1.RebuildCountersRequest{})
+	if err != nil || rebuilt.GetRepaired() != 0 {
+		t.Errorf("expected no counters to repair, got %v %v", rebuilt, err)
+	}
+}
+
+// testGRPCErrors проверяет коды gRPC и детали ошибок
+func testGRPCErrors(t *testing.T) {
+	s := newGRPCServer(t, true)
+	ctx := context.Background()
+	closed, err := s.posts.CreatePost(ctx, &ozonv1.CreatePostRequest{Text: "Closed", AllowComments: ptr(false)})
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := s.posts.GetPost(ctx, &ozonv1.GetPostRequest{Id: "00000000-0000-0000-0000-000000000000"})
+		info := expectStatus(t, err, codes.NotFound)
+		if info.GetReason() != domain.CodeNotFound || info.GetDomain() != "ozon" {
+			t.Errorf("unexpected error info %v", info)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		_, err := s.comments.CreateComment(ctx, &ozonv1.CreateCommentRequest{PostId: "bad", Text: "Hi"})
+		info := expectStatus(t, err, codes.InvalidArgument)
+		if info.GetReason() != domain.CodeValidation || info.GetMetadata()["field"] != "post_id" {
+			t.Errorf("unexpected error info %v", info)
+		}
+		var violations []*errdetails.BadRequest_FieldViolation
+		for _, detail := range status.Convert(err).Details() {
+			if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+				violations = badRequest.GetFieldViolations()
+			}
+		}
+		if len(violations) != 1 || violations[0].GetField() != "post_id" {
+			t.Errorf("expected a violation of post_id, got %v", violations)
+		}
+	})
+
+	t.Run("CommentsDisabled", func(t *testing.T) {
+		_, err := s.comments.CreateComment(ctx, &ozonv1.CreateCommentRequest{PostId: closed.GetId(), Text: "Hi"})
+		info := expectStatus(t, err, codes.FailedPrecondition)
+		if info.GetReason() != domain.CodeCommentsDisabled {
+			t.Errorf("unexpected error info %v", info)
+		}
+	})
+
+	// Без grpc.admin методы администрирования недоступны
+	t.Run("AdminDisabled", func(t *testing.T) {
+		s := newGRPCServer(t, false)
+		post := s.createPost(t, "Post")
+		comment := s.createComment(t, &ozonv1.CreateCommentRequest{PostId: post.GetId(), Text: "Hi"})
+		_, err := s.comments.DeleteComment(ctx, &ozonv1.DeleteCommentRequest{Id: comment.GetId()})
+		if info := expectStatus(t, err, codes.PermissionDenied); info.GetReason() != domain.CodeForbidden {
+			t.Errorf("unexpected error info %v", info)
+		}
+		_, err = s.comments.RebuildCounters(ctx, &ozonv1.RebuildCountersRequest{})
+		expectStatus(t, err, codes.PermissionDenied)
+
+		got, err := s.posts.GetPost(ctx, &ozonv1.GetPostRequest{Id: post.GetId()})
+		if err != nil || got.GetComments()[0].GetDeletedAt() != nil {
+			t.Errorf("expected the comment to be kept, got %v %v", got, err)
+		}
+	})
+}
+
+// expectStatus проверяет код ошибки и возвращает её ErrorInfo
+func expectStatus(t *testing.T, err error, code codes.Code) *errdetails.ErrorInfo {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != code {
+		t.Fatalf("expected %s, got %v", code, err)
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	t.Fatalf("expected an ErrorInfo in %v", st.Details())
+	return nil
+}
+
+// testGRPCWatch проверяет, что поток получает комментарии из gRPC и GraphQL и завершается при остановке брокера
+func testGRPCWatch(t *testing.T) {
+	s := newGRPCServer(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	post := s.createPost(t, "Post")
+	other := s.createPost(t, "Other")
+
+	stream, err := s.comments.WatchComments(ctx, &ozonv1.WatchCommentsRequest{PostId: post.GetId()})
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+	// The header arrives once the server has subscribed.
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("failed to start watching: %v", err)
+	}
+
+	s.createComment(t, &ozonv1.CreateCommentRequest{PostId: other.GetId(), Text: "Elsewhere"})
+	viaGRPC := s.createComment(t, &ozonv1.CreateCommentRequest{PostId: post.GetId(), Text: "gRPC"})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(
+		`{"query": "mutation { createComment(postId: \"`+post.GetId()+`\", text: \"GraphQL\") { id } }"}`))
+	req.Header.Set("Content-Type", "application/json")
+	s.graphql.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"errors"`) {
+		t.Fatalf("failed to create comment via GraphQL: %s", rec.Body)
+	}
+
+	for _, want := range []string{viaGRPC.GetText(), "GraphQL"} {
+		comment, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("failed to receive comment: %v", err)
+		}
+		if comment.GetText() != want || comment.GetPostId() != post.GetId() {
+			t.Errorf("expected comment %q, got %v", want, comment)
+		}
+		// Время не должно терять доли секунды по пути через брокер
+		if want == viaGRPC.GetText() && !comment.GetCreatedAt().AsTime().Equal(viaGRPC.GetCreatedAt().AsTime()) {
+			t.Errorf("expected created_at %s, got %s", viaGRPC.GetCreatedAt().AsTime(), comment.GetCreatedAt().AsTime())
+		}
+	}
+
+	s.broker.Close()
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected UNAVAILABLE after shutdown, got %v", err)
+	}
+
+	missing, err := s.comments.WatchComments(ctx, &ozonv1.WatchCommentsRequest{PostId: "00000000-0000-0000-0000-000000000000"})
+	if err == nil {
+		_, err = missing.Recv()
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NOT_FOUND for a missing post, got %v", err)
+	}
+}
+
+// testGRPCRequestID проверяет, что сервер возвращает присланный или новый идентификатор запроса
+func testGRPCRequestID(t *testing.T) {
+	s := newGRPCServer(t, true)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "client-id")
+	var header metadata.MD
+	if _, err := s.posts.ListPosts(ctx, &ozonv1.ListPostsRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatalf("failed to list posts: %v", err)
+	}
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "client-id" {
+		t.Errorf("expected the sent request ID, got %v", got)
+	}
+
+	header = nil
+	if _, err := s.posts.ListPosts(context.Background(), &ozonv1.ListPostsRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatalf("failed to list posts: %v", err)
+	}
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] == "" {
+		t.Errorf("expected a new request ID, got %v", got)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestErrorPresenter проверяет коды ошибок в extensions и скрытие внутренних ошибок
+func TestErrorPresenter(t *testing.T) {
+	t.Run("NotFound", testNotFound)
+	t.Run("ValidationField", testValidationField)
+	t.Run("InternalHiddenInProduction", testInternalHiddenInProduction)
+	t.Run("InternalVisibleInDevelopment", testInternalVisibleInDevelopment)
+}
+
+func testNotFound(t *testing.T) {
+	presenter := handlers.NewErrorPresenter(true)
+
+	gqlErr := presenter(context.Background(), fmt.Errorf("failed to get post: %w", domain.ErrPostNotFound))
+	if gqlErr.Extensions["code"] != domain.CodeNotFound {
+		t.Errorf("expected code %s, got %v", domain.CodeNotFound, gqlErr.Extensions["code"])
+	}
+	if gqlErr.Message != "failed to get post: post not found" {
+		t.Errorf("unexpected message: %s", gqlErr.Message)
+	}
+}
+
+func testValidationField(t *testing.T) {
+	presenter := handlers.NewErrorPresenter(true)
+
+	gqlErr := presenter(context.Background(), fmt.Errorf("%w: some-id", domain.ErrParentDeleted))
+	if gqlErr.Extensions["code"] != domain.CodeValidation {
+		t.Errorf("expected code %s, got %v", domain.CodeValidation, gqlErr.Extensions["code"])
+	}
+	if gqlErr.Extensions["field"] != "parentId" {
+		t.Errorf("expected field parentId, got %v", gqlErr.Extensions["field"])
+	}
+}
+
+func testInternalHiddenInProduction(t *testing.T) {
+	presenter := handlers.NewErrorPresenter(true)
+
+	gqlErr := presenter(context.Background(), errors.New("dial tcp 127.0.0.1:5432: connection refused"))
+	if gqlErr.Extensions["code"] != domain.CodeInternal {
+		t.Errorf("expected code %s, got %v", domain.CodeInternal, gqlErr.Extensions["code"])
+	}
+	if gqlErr.Message != "internal server error" {
+		t.Errorf("internal details leaked: %s", gqlErr.Message)
+	}
+}
+
+func testInternalVisibleInDevelopment(t *testing.T) {
+	presenter := handlers.NewErrorPresenter(false)
+
+	gqlErr := presenter(context.Background(), errors.New("dial tcp 127.0.0.1:5432: connection refused"))
+	if gqlErr.Message != "dial tcp 127.0.0.1:5432: connection refused" {
+		t.Errorf("expected original message, got %s", gqlErr.Message)
+	}
+}
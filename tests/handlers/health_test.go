@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"OZON/internal/handlers"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestHealth проверяет пробы /healthz и /readyz
+func TestHealth(t *testing.T) {
+	t.Run("Live", testLive)
+	t.Run("Ready", testReady)
+	t.Run("StorageUnavailable", testStorageUnavailable)
+	t.Run("ErrorHiddenInProduction", testErrorHiddenInProduction)
+	t.Run("Draining", testDraining)
+	t.Run("DrainDelay", testDrainDelay)
+}
+
+type healthBody struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+func probe(t *testing.T, handler http.HandlerFunc) (int, healthBody) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var body healthBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response body %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func failing(err error) func(ctx context.Context) error {
+	return func(ctx context.Context) error { return err }
+}
+
+// testLive проверяет, что liveness не зависит от хранилища
+func testLive(t *testing.T) {
+	h := handlers.NewHealth(failing(errors.New("database is unreachable")), false)
+	if code, body := probe(t, h.Live); code != http.StatusOK || body.Status != "ok" {
+		t.Errorf("expected 200 ok, got %d %+v", code, body)
+	}
+}
+
+func testReady(t *testing.T) {
+	h := handlers.NewHealth(failing(nil), false)
+	if code, body := probe(t, h.Ready); code != http.StatusOK || body.Status != "ok" {
+		t.Errorf("expected 200 ok, got %d %+v", code, body)
+	}
+}
+
+func testStorageUnavailable(t *testing.T) {
+	h := handlers.NewHealth(failing(errors.New("database is unreachable")), false)
+	code, body := probe(t, h.Ready)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", code)
+	}
+	if body.Error != "database is unreachable" {
+		t.Errorf("expected the check error in development, got %q", body.Error)
+	}
+}
+
+func testErrorHiddenInProduction(t *testing.T) {
+	h := handlers.NewHealth(failing(errors.New("database is unreachable")), true)
+	code, body := probe(t, h.Ready)
+	if code != http.StatusServiceUnavailable || body.Error != "" {
+		t.Errorf("expected 503 without details, got %d %+v", code, body)
+	}
+}
+
+// testDraining проверяет, что после начала остановки readiness падает, а liveness нет
+func testDraining(t *testing.T) {
+	h := handlers.NewHealth(failing(nil), false)
+	h.Drain(0)
+	if code, _ := probe(t, h.Ready); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %d", code)
+	}
+	if code, _ := probe(t, h.Live); code != http.StatusOK {
+		t.Errorf("expected 200 from liveness while draining, got %d", code)
+	}
+}
+
+// testDrainDelay проверяет, что Drain возвращается только после задержки, а readiness падает сразу
+func testDrainDelay(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	h := handlers.NewHealth(failing(nil), false)
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		h.Drain(delay)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(delay / 2)
+	for {
+		code, _ := probe(t, h.Ready)
+		if code == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 503 while draining, got %d", code)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Drain returned after %s, expected at least %s", elapsed, delay)
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"OZON/graph"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/repository/backend"
+	"OZON/internal/repository/cache"
+	"OZON/internal/repository/memory"
+	"OZON/internal/usecases"
+	"OZON/pkg/pubsub"
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHTTPCache проверяет ETag, ответы 304 и Cache-Control для GET-запросов
+func TestHTTPCache(t *testing.T) {
+	t.Run("Headers", testHTTPCacheHeaders)
+	t.Run("NotModified", testHTTPCacheNotModified)
+	t.Run("Invalidation", testHTTPCacheInvalidation)
+	t.Run("Uncacheable", testHTTPCacheUncacheable)
+	t.Run("StaleCache", testHTTPCacheStaleCache)
+}
+
+type httpCacheServer struct {
+	handler  http.Handler
+	repo     *memory.InMemoryRepository
+	comments *usecases.CommentUsecase
+	postIDs  []string
+}
+
+// newHTTPCacheServer собирает сервер с двумя постами
+func newHTTPCacheServer(t *testing.T) *httpCacheServer {
+	t.Helper()
+	repo := memory.NewInMemoryRepository()
+	posts := usecases.NewPostUsecase(repo, repo)
+	comments := usecases.NewCommentUsecase(repo, repo, 0)
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: handlers.NewResolver(posts, comments, pubsub.New[*domain.Comment]())}))
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	srv.Use(handlers.NewHTTPCache(posts))
+
+	s := &httpCacheServer{handler: handlers.HTTPCacheMiddleware(srv), repo: repo, comments: comments}
+	for _, text := range []string{"First", "Second"} {
+		post, err := posts.CreatePost(context.Background(), text, nil)
+		if err != nil {
+			t.Fatalf("failed to create a post: %v", err)
+		}
+		s.postIDs = append(s.postIDs, post.ID.String())
+	}
+	return s
+}
+
+func (s *httpCacheServer) postID(i int) uuid.UUID {
+	return uuid.MustParse(s.postIDs[i])
+}
+
+func (s *httpCacheServer) get(query, variables, ifNoneMatch string) *httptest.ResponseRecorder {
+	params := url.Values{"query": {query}}
+	if variables != "" {
+		params.Set("variables", variables)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *httpCacheServer) getPost(i int, ifNoneMatch string) *httptest.ResponseRecorder {
+	return s.get(`query Post($id: ID!) { getPost(id: $id) { id text commentCount comments { id } } }`,
+		`{"id": "`+s.postIDs[i]+`"}`, ifNoneMatch)
+}
+
+const feedQuery = `{ getPosts { id text commentCount } }`
+
+func testHTTPCacheHeaders(t *testing.T) {
+	s := newHTTPCacheServer(t)
+
+	feed := s.get(feedQuery, "", "")
+	if feed.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", feed.Code, feed.Body)
+	}
+	if got := feed.Header().Get("Cache-Control"); got != "public, max-age=10" {
+		t.Errorf("getPosts: expected the maxAge of the field, got %q", got)
+	}
+	if etag := feed.Header().Get("ETag"); !strings.HasPrefix(etag, `W/"`) {
+		t.Errorf("expected a weak ETag, got %q", etag)
+	}
+
+	post := s.getPost(0, "")
+	if got := post.Header().Get("Cache-Control"); got != "public, max-age=30" {
+		t.Errorf("getPost: expected the maxAge of the field, got %q", got)
+	}
+	if post.Header().Get("ETag") == feed.Header().Get("ETag") {
+		t.Error("different queries must have different ETags")
+	}
+	if s.getPost(1, "").Header().Get("ETag") == post.Header().Get("ETag") {
+		t.Error("different variables must have different ETags")
+	}
+
+	// Фрагменты учитываются так же, как поля запроса
+	fragment := s.get(`{ getPosts { ...P } } fragment P on Post { id comments { id } }`, "", "")
+	if got := fragment.Header().Get("Cache-Control"); got != "public, max-age=10" {
+		t.Errorf("fragment: expected max-age=10, got %q", got)
+	}
+}
+
+func testHTTPCacheNotModified(t *testing.T) {
+	s := newHTTPCacheServer(t)
+	etag := s.get(feedQuery, "", "").Header().Get("ETag")
+
+	for _, ifNoneMatch := range []string{etag, strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+		rec := s.get(feedQuery, "", ifNoneMatch)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: expected 304, got %d", ifNoneMatch, rec.Code)
+			continue
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("304 must have no body, got %q", rec.Body)
+		}
+		if rec.Header().Get("ETag") != etag || rec.Header().Get("Cache-Control") == "" {
+			t.Errorf("304 must repeat the validators, got %v", rec.Header())
+		}
+	}
+	if rec := s.get(feedQuery, "", `W/"stale"`); rec.Code != http.StatusOK {
+		t.Errorf("a stale ETag must get the full response, got %d", rec.Code)
+	}
+}
+
+// testHTTPCacheInvalidation проверяет смену ETag при новом комментарии только у затронутого поста
+func testHTTPCacheInvalidation(t *testing.T) {
+	s := newHTTPCacheServer(t)
+	feed := s.get(feedQuery, "", "").Header().Get("ETag")
+	first := s.getPost(0, "").Header().Get("ETag")
+	second := s.getPost(1, "").Header().Get("ETag")
+
+	if _, err := s.comments.CreateComment(context.Background(), &domain.Comment{Text: "Comment", PostID: s.postID(0)}); err != nil {
+		t.Fatalf("failed to create a comment: %v", err)
+	}
+
+	if rec := s.get(feedQuery, "", feed); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"commentCount":1`) {
+		t.Errorf("the feed must change with a comment, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := s.getPost(0, first); rec.Code != http.StatusOK {
+		t.Errorf("the commented post must change, got %d", rec.Code)
+	}
+	if rec := s.getPost(1, second); rec.Code != http.StatusNotModified {
+		t.Errorf("other posts must stay unchanged, got %d", rec.Code)
+	}
+
+	// Пост с временем раньше последнего изменения ленты тоже меняет её
+	feed = s.get(feedQuery, "", "").Header().Get("ETag")
+	past := time.Now().Add(-time.Hour)
+	if _, err := s.repo.CreatePost(context.Background(), &domain.Post{Text: "Late", CreatedAt: &past}, nil); err != nil {
+		t.Fatalf("failed to create a post: %v", err)
+	}
+	if rec := s.get(feedQuery, "", feed); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Late") {
+		t.Errorf("the feed must change with a post created in the past, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+// testHTTPCacheUncacheable проверяет запросы без заголовков кэширования
+func testHTTPCacheUncacheable(t *testing.T) {
+	s := newHTTPCacheServer(t)
+
+	missing := s.get(`{ getPost(id: "00000000-0000-0000-0000-000000000000") { id } }`, "", "")
+	if missing.Header().Get("ETag") != "" || missing.Header().Get("Cache-Control") != "" {
+		t.Errorf("errors must not be cached, got %v", missing.Header())
+	}
+
+	introspection := s.get(`{ __schema { queryType { name } } }`, "", "")
+	if introspection.Header().Get("ETag") != "" || introspection.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("fields without a hint must not be cached, got %v", introspection.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query": "`+feedQuery+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	if rec.Header().Get("ETag") != "" || rec.Header().Get("Cache-Control") != "" {
+		t.Errorf("POST requests must not get cache headers, got %v", rec.Header())
+	}
+}
+
+// testHTTPCacheStaleCache проверяет, что ответ из отставшего кэша репозитория не получает ETag новых данных
+func testHTTPCacheStaleCache(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	lru, err := cache.NewLRU(100)
+	if err != nil {
+		t.Fatalf("failed to create the cache: %v", err)
+	}
+	storage := backend.NewStorage(repo, repo, nil, nil)
+	cache.Decorate(storage, lru, time.Minute)
+	posts := usecases.NewPostUsecase(storage.PostRepository, storage.CommentRepository)
+	comments := usecases.NewCommentUsecase(storage.PostRepository, storage.CommentRepository, 0)
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: handlers.NewResolver(posts, comments, pubsub.New[*domain.Comment]())}))
+	srv.AddTransport(transport.GET{})
+	srv.Use(handlers.NewHTTPCache(posts))
+
+	post, err := posts.CreatePost(context.Background(), "Post", nil)
+	if err != nil {
+		t.Fatalf("failed to create a post: %v", err)
+	}
+	s := &httpCacheServer{handler: handlers.HTTPCacheMiddleware(srv), postIDs: []string{post.ID.String()}}
+
+	first := s.getPost(0, "").Header().Get("ETag")
+	cached := s.getPost(0, "")
+	if etag := cached.Header().Get("ETag"); first == "" || etag != first {
+		t.Fatalf("a response from an up-to-date cache must keep its ETag, got %q and %q", first, etag)
+	}
+
+	// Комментарий другой реплики, чей кэш процесс не видит
+	if _, err := repo.CreateComment(context.Background(), &domain.Comment{Text: "Comment", PostID: post.ID}); err != nil {
+		t.Fatalf("failed to create a comment: %v", err)
+	}
+	stale := s.getPost(0, first)
+	if stale.Code != http.StatusOK || !strings.Contains(stale.Body.String(), `"commentCount":0`) {
+		t.Fatalf("expected the stale cached post, got %d %s", stale.Code, stale.Body)
+	}
+	if etag := stale.Header().Get("ETag"); etag != "" {
+		t.Errorf("a stale response must not get an ETag, got %q", etag)
+	}
+	if stale.Header().Get("Cache-Control") == "" {
+		t.Error("a stale response must still get Cache-Control")
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"OZON/graph"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/repository/memory"
+	"OZON/internal/usecases"
+	"OZON/pkg/logging"
+	"OZON/pkg/pubsub"
+	"bytes"
+	"encoding/json"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOperationLogger проверяет журнал GraphQL-операций
+func TestOperationLogger(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, "info", "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	repo := memory.NewInMemoryRepository()
+	resolver := handlers.NewResolver(
+		usecases.NewPostUsecase(repo, repo),
+		usecases.NewCommentUsecase(repo, repo, 0),
+		pubsub.New[*domain.Comment](),
+	)
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(handlers.OperationLogger{})
+	server := logging.RequestIDMiddleware(srv)
+
+	post := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(logging.Header, "req-7")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("Mutation", func(t *testing.T) {
+		buf.Reset()
+		post(`{"query":"mutation NewPost($text: String!) { createPost(text: $text) { id } }","variables":{"text":"private"}}`)
+		record := lastRecord(t, &buf)
+		if record["msg"] != "graphql operation" || record["operation"] != "NewPost" || record["type"] != "mutation" {
+			t.Errorf("unexpected record: %v", record)
+		}
+		if record["request_id"] != "req-7" || record["errors"] != float64(0) {
+			t.Errorf("expected request ID and no errors, got %v", record)
+		}
+		if vars := record["variables"].(map[string]interface{}); vars["text"] != logging.Redacted {
+			t.Errorf("expected redacted text, got %v", vars["text"])
+		}
+	})
+
+	// Скрывается значение, переданное в аргумент text, как бы клиент ни назвал переменную
+	t.Run("RenamedVariable", func(t *testing.T) {
+		buf.Reset()
+		post(`{"query":"mutation($p: ID!, $body: String!) { createComment(postId: $p, text: $body) { id } }","variables":{"p":"not-a-uuid","body":"my secret personal message"}}`)
+		if strings.Contains(buf.String(), "secret personal") {
+			t.Fatalf("comment text leaked to the log: %s", buf.String())
+		}
+		vars := lastRecord(t, &buf)["variables"].(map[string]interface{})
+		if vars["body"] != logging.Redacted || vars["p"] != "not-a-uuid" {
+			t.Errorf("expected only body to be redacted, got %v", vars)
+		}
+	})
+
+	// Переменные во фрагментах тоже учитываются
+	t.Run("Fragment", func(t *testing.T) {
+		buf.Reset()
+		post(`{"query":"mutation($m: String!) { ...F } fragment F on Mutation { createPost(text: $m) { id } }","variables":{"m":"private"}}`)
+		if vars := lastRecord(t, &buf)["variables"].(map[string]interface{}); vars["m"] != logging.Redacted {
+			t.Errorf("expected redacted text, got %v", vars["m"])
+		}
+	})
+
+	// Запрос, не прошедший валидацию, тоже попадает в журнал
+	t.Run("InvalidQuery", func(t *testing.T) {
+		buf.Reset()
+		post(`{"query":"query Feed { getPosts { nope } }"}`)
+		record := lastRecord(t, &buf)
+		if record["msg"] != "graphql operation" || record["errors"] != float64(1) {
+			t.Errorf("unexpected record: %v", record)
+		}
+	})
+}
+
+func lastRecord(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &record); err != nil {
+		t.Fatalf("invalid log record %q: %v", lines[len(lines)-1], err)
+	}
+	return record
+}
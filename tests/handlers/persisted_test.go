@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"OZON/graph"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/repository/memory"
+	"OZON/internal/usecases"
+	"OZON/pkg/persisted"
+	"OZON/pkg/pubsub"
+	"encoding/json"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAllowlist проверяет строгий режим: выполняются только запросы манифеста
+func TestAllowlist(t *testing.T) {
+	const feed = "query Feed { getPosts { id } }"
+	manifest, err := persisted.ParseManifest([]byte(`{"` + persisted.Hash(feed) + `": "` + feed + `"}`))
+	if err != nil {
+		t.Fatalf("failed to parse the manifest: %v", err)
+	}
+
+	repo := memory.NewInMemoryRepository()
+	resolver := handlers.NewResolver(usecases.NewPostUsecase(repo, repo), usecases.NewCommentUsecase(repo, repo, 0), pubsub.New[*domain.Comment]())
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(handlers.NewErrorPresenter(true))
+	srv.Use(handlers.NewAllowlist(manifest))
+
+	do := func(params map[string]interface{}) gqlResponse {
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		var resp gqlResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+	persistedQuery := func(hash string) map[string]interface{} {
+		return map[string]interface{}{"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hash}}
+	}
+	expectCode := func(t *testing.T, resp gqlResponse, code string) {
+		t.Helper()
+		if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != code {
+			t.Errorf("expected error %s, got %+v", code, resp.Errors)
+		}
+		if resp.Data["getPosts"] != nil || resp.Data["createPost"] != nil {
+			t.Error("the operation must not be executed")
+		}
+	}
+
+	t.Run("Hash", func(t *testing.T) {
+		resp := do(map[string]interface{}{"extensions": persistedQuery(persisted.Hash(feed))})
+		if len(resp.Errors) != 0 || resp.Data["getPosts"] == nil {
+			t.Errorf("expected the manifest query by its hash, got %+v", resp)
+		}
+	})
+	t.Run("FullQuery", func(t *testing.T) {
+		resp := do(map[string]interface{}{"query": feed})
+		if len(resp.Errors) != 0 || resp.Data["getPosts"] == nil {
+			t.Errorf("expected the manifest query by its text, got %+v", resp)
+		}
+	})
+	t.Run("UnknownHash", func(t *testing.T) {
+		expectCode(t, do(map[string]interface{}{"extensions": persistedQuery(persisted.Hash("{ getPosts { id } }"))}), "PERSISTED_QUERY_NOT_FOUND")
+	})
+	t.Run("UnknownQuery", func(t *testing.T) {
+		expectCode(t, do(map[string]interface{}{"query": `mutation { createPost(text: "spam") { id } }`}), "QUERY_NOT_ALLOWED")
+	})
+	t.Run("NoRegistration", func(t *testing.T) {
+		// Запрос с хешем и текстом не регистрируется, как в APQ
+		const other = "{ getPosts { id } }"
+		expectCode(t, do(map[string]interface{}{"query": other, "extensions": persistedQuery(persisted.Hash(other))}), "QUERY_NOT_ALLOWED")
+		expectCode(t, do(map[string]interface{}{"extensions": persistedQuery(persisted.Hash(other))}), "PERSISTED_QUERY_NOT_FOUND")
+	})
+}
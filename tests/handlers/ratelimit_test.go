@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"OZON/graph"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/repository/memory"
+	"OZON/internal/usecases"
+	"OZON/pkg/pubsub"
+	"OZON/pkg/ratelimit"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRateLimit проверяет лимиты мутаций и ошибку RATE_LIMITED с retryAfter
+func TestRateLimit(t *testing.T) {
+	t.Run("PerMutation", testRateLimitPerMutation)
+	t.Run("PerClient", testRateLimitPerClient)
+	t.Run("StoreFailure", testRateLimitStoreFailure)
+}
+
+type gqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// newLimitedServer собирает сервер с лимитом createPost 1/1m и createComment 2/1m
+func newLimitedServer(store ratelimit.Store) (func(remoteAddr, body string) gqlResponse, string) {
+	repo := memory.NewInMemoryRepository()
+	postUsecase := usecases.NewPostUsecase(repo, repo)
+	resolver := handlers.NewResolver(postUsecase, usecases.NewCommentUsecase(repo, repo, 0), pubsub.New[*domain.Comment]())
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(handlers.NewErrorPresenter(true))
+	srv.Use(handlers.NewRateLimit(store, map[string]ratelimit.Limit{
+		"createPost":    {Count: 1, Period: time.Minute},
+		"createComment": {Count: 2, Period: time.Minute},
+	}))
+	server := ratelimit.ClientMiddleware(false, "")(srv)
+
+	post, err := postUsecase.CreatePost(context.Background(), "Post", nil)
+	if err != nil {
+		panic(err)
+	}
+	return func(remoteAddr, body string) gqlResponse {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		var resp gqlResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}, post.ID.String()
+}
+
+const (
+	createPost = `{"query":"mutation { createPost(text: \"hi\") { id } }"}`
+	getPosts   = `{"query":"query { getPosts { id } }"}`
+)
+
+func createComment(postID string) string {
+	return `{"query":"mutation { createComment(postId: \"` + postID + `\", text: \"hi\") { id } }"}`
+}
+
+func expectRateLimited(t *testing.T, resp gqlResponse) {
+	t.Helper()
+	if len(resp.Errors) != 1 {
+		t.Fatalf("expected one error, got %+v", resp.Errors)
+	}
+	ext := resp.Errors[0].Extensions
+	if ext["code"] != domain.CodeRateLimited {
+		t.Errorf("expected code %s, got %v", domain.CodeRateLimited, ext["code"])
+	}
+	if retry, _ := ext["retryAfter"].(float64); retry < 1 || retry > 60 {
+		t.Errorf("expected retryAfter in seconds, got %v", ext["retryAfter"])
+	}
+}
+
+// testRateLimitPerMutation проверяет отдельный бюджет для каждой мутации
+func testRateLimitPerMutation(t *testing.T) {
+	do, postID := newLimitedServer(ratelimit.NewMemory())
+	const client = "203.0.113.7:5000"
+
+	if resp := do(client, createPost); len(resp.Errors) != 0 {
+		t.Fatalf("first createPost must pass: %+v", resp.Errors)
+	}
+	expectRateLimited(t, do(client, createPost))
+
+	for i := 0; i < 2; i++ {
+		if resp := do(client, createComment(postID)); len(resp.Errors) != 0 {
+			t.Fatalf("createComment %d must pass: %+v", i+1, resp.Errors)
+		}
+	}
+	expectRateLimited(t, do(client, createComment(postID)))
+
+	// Запросы не ограничиваются
+	for i := 0; i < 5; i++ {
+		if resp := do(client, getPosts); len(resp.Errors) != 0 {
+			t.Fatalf("queries must not be limited: %+v", resp.Errors)
+		}
+	}
+}
+
+// testRateLimitPerClient проверяет, что клиенты с разными адресами не делят бюджет
+func testRateLimitPerClient(t *testing.T) {
+	do, _ := newLimitedServer(ratelimit.NewMemory())
+	do("203.0.113.7:5000", createPost)
+	if resp := do("203.0.113.7:5001", createPost); len(resp.Errors) == 0 {
+		t.Error("another connection from the same address must share the budget")
+	}
+	if resp := do("198.51.100.1:5000", createPost); len(resp.Errors) != 0 {
+		t.Errorf("another client must have its own budget: %+v", resp.Errors)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+// testRateLimitStoreFailure проверяет, что недоступное хранилище лимитов не блокирует мутации
+func testRateLimitStoreFailure(t *testing.T) {
+	do, _ := newLimitedServer(failingStore{})
+	for i := 0; i < 3; i++ {
+		if resp := do("203.0.113.7:5000", createPost); len(resp.Errors) != 0 {
+			t.Fatalf("mutations must pass when the store fails: %+v", resp.Errors)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"OZON/graph"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/repository/memory"
+	"OZON/internal/usecases"
+	"OZON/pkg/pubsub"
+	"OZON/pkg/ratelimit"
+	"context"
+	"encoding/json"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestREST проверяет REST API и его спецификацию OpenAPI
+func TestREST(t *testing.T) {
+	t.Run("Posts", testRESTPosts)
+	t.Run("Comments", testRESTComments)
+	t.Run("Errors", testRESTErrors)
+	t.Run("RateLimit", testRESTRateLimit)
+	t.Run("Subscription", testRESTSubscription)
+	t.Run("OpenAPI", testRESTOpenAPI)
+}
+
+type restServer struct {
+	t        *testing.T
+	api      http.Handler
+	graphql  http.Handler
+	comments *pubsub.Broker[*domain.Comment]
+}
+
+// newRESTServer собирает REST API и GraphQL над одними usecases; limits может быть пустым
+func newRESTServer(t *testing.T, limits map[string]ratelimit.Limit) *restServer {
+	t.Helper()
+	repo := memory.NewInMemoryRepository()
+	posts := usecases.NewPostUsecase(repo, repo)
+	comments := pubsub.New[*domain.Comment]()
+	resolver := handlers.NewResolver(posts, usecases.NewCommentUsecase(repo, repo, 0), comments)
+
+	var limit handlers.RateLimit
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	if limits != nil {
+		limit = handlers.NewRateLimit(ratelimit.NewMemory(), limits)
+		srv.Use(limit)
+	}
+	return &restServer{
+		t:        t,
+		api:      ratelimit.ClientMiddleware(false, "")(handlers.NewREST(resolver, limit, true)),
+		graphql:  ratelimit.ClientMiddleware(false, "")(srv),
+		comments: comments,
+	}
+}
+
+type restErrorBody struct {
+	Error struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		Field      string `json:"field"`
+		RetryAfter int    `json:"retryAfter"`
+	} `json:"error"`
+}
+
+// do отправляет запрос и разбирает ответ в out, если он не nil
+func (s *restServer) do(method, path, body string, out interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.api.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		s.t.Errorf("%s %s: expected a JSON response, got %q", method, path, ct)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: invalid JSON %q: %v", method, path, rec.Body, err)
+		}
+	}
+	return rec
+}
+
+type restPost struct {
+	ID            string `json:"id"`
+	Text          string `json:"text"`
+	AllowComments bool   `json:"allowComments"`
+	CommentCount  int    `json:"commentCount"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+type restComment struct {
+	ID         string        `json:"id"`
+	Text       string        `json:"text"`
+	PostID     string        `json:"postId"`
+	ParentID   *string       `json:"parentId"`
+	ReplyCount int           `json:"replyCount"`
+	Children   []restComment `json:"children"`
+}
+
+func (s *restServer) createPost(body string) restPost {
+	s.t.Helper()
+	var post restPost
+	if rec := s.do(http.MethodPost, "/api/posts", body, &post); rec.Code != http.StatusCreated {
+		s.t.Fatalf("failed to create a post: %d %s", rec.Code, rec.Body)
+	}
+	return post
+}
+
+func (s *restServer) createComment(postID, body string) restComment {
+	s.t.Helper()
+	var comment restComment
+	if rec := s.do(http.MethodPost, "/api/posts/"+postID+"/comments", body, &comment); rec.Code != http.StatusCreated {
+		s.t.Fatalf("failed to create a comment: %d %s", rec.Code, rec.Body)
+	}
+	return comment
+}
+
+func testRESTPosts(t *testing.T) {
+	s := newRESTServer(t, nil)
+	created := s.createPost(`{"text": "First", "allowComments": false}`)
+	if created.Text != "First" || created.AllowComments || created.ID == "" || created.CreatedAt == "" {
+		t.Errorf("unexpected created post %+v", created)
+	}
+	s.createPost(`{"text": "Second"}`)
+	s.createPost(`{"text": "Third"}`)
+
+	var got restPost
+	if rec := s.do(http.MethodGet, "/api/posts/"+created.ID, "", &got); rec.Code != http.StatusOK || got != created {
+		t.Errorf("expected the created post, got %d %+v", rec.Code, got)
+	}
+
+	// Курсор ведёт по страницам того же размера, пока они не кончатся
+	var texts []string
+	path := "/api/posts?limit=2"
+	for i := 0; path != ""; i++ {
+		if i > 3 {
+			t.Fatal("the cursors do not end")
+		}
+		var page struct {
+			Posts      []restPost `json:"posts"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if rec := s.do(http.MethodGet, path, "", &page); rec.Code != http.StatusOK {
+			t.Fatalf("failed to list posts: %d %s", rec.Code, rec.Body)
+		}
+		for _, post := range page.Posts {
+			texts = append(texts, post.Text)
+		}
+		path = ""
+		if page.NextCursor != "" {
+			path = "/api/posts?limit=100&cursor=" + page.NextCursor
+		}
+	}
+	if strings.Join(texts, ",") != "First,Second,Third" {
+		t.Errorf("expected every post once, got %v", texts)
+	}
+}
+
+func testRESTComments(t *testing.T) {
+	s := newRESTServer(t, nil)
+	post := s.createPost(`{"text": "Post"}`)
+	first := s.createComment(post.ID, `{"text": "First"}`)
+	reply := s.createComment(post.ID, `{"text": "Reply", "parentId": "`+first.ID+`"}`)
+	s.createComment(post.ID, `{"text": "Second"}`)
+	if first.PostID != post.ID || first.ParentID != nil || reply.ParentID == nil || *reply.ParentID != first.ID {
+		t.Errorf("unexpected comments %+v %+v", first, reply)
+	}
+
+	var page struct {
+		Comments   []restComment `json:"comments"`
+		NextCursor string        `json:"nextCursor"`
+	}
+	s.do(http.MethodGet, "/api/posts/"+post.ID+"/comments?limit=1", "", &page)
+	if len(page.Comments) != 1 || page.Comments[0].ID != first.ID || page.Comments[0].ReplyCount != 1 {
+		t.Fatalf("expected the first thread, got %+v", page.Comments)
+	}
+	if children := page.Comments[0].Children; len(children) != 1 || children[0].ID != reply.ID {
+		t.Errorf("expected the reply in the thread, got %+v", children)
+	}
+
+	cursor := page.NextCursor
+	page.NextCursor = ""
+	s.do(http.MethodGet, "/api/posts/"+post.ID+"/comments?cursor="+cursor, "", &page)
+	if len(page.Comments) != 1 || page.Comments[0].Text != "Second" || page.NextCursor == "" {
+		t.Errorf("expected the second thread and a cursor, got %+v", page)
+	}
+
+	var got restPost
+	s.do(http.MethodGet, "/api/posts/"+post.ID, "", &got)
+	if got.CommentCount != 3 {
+		t.Errorf("expected commentCount 3, got %d", got.CommentCount)
+	}
+}
+
+// testRESTErrors проверяет статусы и коды ошибок, общие с GraphQL
+func testRESTErrors(t *testing.T) {
+	s := newRESTServer(t, nil)
+	closed := s.createPost(`{"text": "Closed", "allowComments": false}`)
+	const missing = "00000000-0000-0000-0000-000000000000"
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		code, field              string
+	}{
+		{"InvalidID", http.MethodGet, "/api/posts/nope", "", http.StatusBadRequest, domain.CodeValidation, "id"},
+		{"MissingPost", http.MethodGet, "/api/posts/" + missing, "", http.StatusNotFound, domain.CodeNotFound, ""},
+		{"MissingPostComments", http.MethodGet, "/api/posts/" + missing + "/comments", "", http.StatusNotFound, domain.CodeNotFound, ""},
+		{"InvalidLimit", http.MethodGet, "/api/posts?limit=0", "", http.StatusBadRequest, domain.CodeValidation, "limit"},
+		{"InvalidCursor", http.MethodGet, "/api/posts?cursor=nope", "", http.StatusBadRequest, domain.CodeValidation, "cursor"},
+		{"EmptyText", http.MethodPost, "/api/posts", `{"text": ""}`, http.StatusBadRequest, domain.CodeValidation, "text"},
+		{"InvalidJSON", http.MethodPost, "/api/posts", `{"text":`, http.StatusBadRequest, domain.CodeValidation, ""},
+		{"CommentsDisabled", http.MethodPost, "/api/posts/" + closed.ID + "/comments", `{"text": "Hi"}`, http.StatusForbidden, domain.CodeCommentsDisabled, ""},
+		{"InvalidParent", http.MethodPost, "/api/posts/" + closed.ID + "/comments", `{"text": "Hi", "parentId": "nope"}`, http.StatusBadRequest, domain.CodeValidation, "parentId"},
+		{"UnknownPath", http.MethodGet, "/api/users", "", http.StatusNotFound, domain.CodeNotFound, ""},
+		{"WrongMethod", http.MethodDelete, "/api/posts/" + closed.ID, "", http.StatusMethodNotAllowed, domain.CodeValidation, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body restErrorBody
+			rec := s.do(tt.method, tt.path, tt.body, &body)
+			if rec.Code != tt.status || body.Error.Code != tt.code || body.Error.Field != tt.field {
+				t.Errorf("expected %d %s field %q, got %d %s", tt.status, tt.code, tt.field, rec.Code, rec.Body)
+			}
+			if body.Error.Message == "" {
+				t.Error("expected an error message")
+			}
+		})
+	}
+}
+
+// testRESTRateLimit проверяет, что REST и GraphQL тратят общий бюджет мутации
+func testRESTRateLimit(t *testing.T) {
+	s := newRESTServer(t, map[string]ratelimit.Limit{"createPost": {Count: 2, Period: time.Minute}})
+
+	s.createPost(`{"text": "REST"}`)
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(createPost))
+	req.Header.Set("Content-Type", "application/json")
+	s.graphql.ServeHTTP(httptest.NewRecorder(), req)
+
+	var body restErrorBody
+	rec := s.do(http.MethodPost, "/api/posts", `{"text": "Over"}`, &body)
+	if rec.Code != http.StatusTooManyRequests || body.Error.Code != domain.CodeRateLimited {
+		t.Fatalf("expected 429 %s, got %d %s", domain.CodeRateLimited, rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" || body.Error.RetryAfter < 1 {
+		t.Errorf("expected Retry-After, got %q and %d", rec.Header().Get("Retry-After"), body.Error.RetryAfter)
+	}
+	if rec := s.do(http.MethodGet, "/api/posts", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("reads must not be limited, got %d", rec.Code)
+	}
+}
+
+// testRESTSubscription проверяет, что подписчики newComment видят комментарии из REST
+func testRESTSubscription(t *testing.T) {
+	s := newRESTServer(t, nil)
+	post := s.createPost(`{"text": "Post"}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := s.comments.Subscribe(ctx, post.ID)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	created := s.createComment(post.ID, `{"text": "Hi"}`)
+	select {
+	case comment := <-ch:
+		if comment.ID.String() != created.ID {
+			t.Errorf("expected comment %s, got %s", created.ID, comment.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the comment was not published")
+	}
+}
+
+// testRESTOpenAPI проверяет, что спецификация описывает все маршруты и ссылки в ней разрешаются
+func testRESTOpenAPI(t *testing.T) {
+	s := newRESTServer(t, nil)
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	rec := s.do(http.MethodGet, "/api/openapi.json", "", &spec)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Fatalf("expected an OpenAPI 3 document, got %d %q", rec.Code, spec.OpenAPI)
+	}
+
+	for path, methods := range map[string][]string{
+		"/api/posts":               {"get", "post"},
+		"/api/posts/{id}":          {"get"},
+		"/api/posts/{id}/comments": {"get", "post"},
+	} {
+		for _, method := range methods {
+			if _, ok := spec.Paths[path][method]; !ok {
+				t.Errorf("missing %s %s", method, path)
+			}
+		}
+	}
+	if _, ok := spec.Paths["/api/posts"]["post"]["requestBody"]; !ok {
+		t.Error("createPost must describe its body")
+	}
+
+	for _, ref := range strings.Split(rec.Body.String(), `"$ref": "#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("unresolved schema %s", name)
+		}
+	}
+	for _, name := range []string{"Post", "Comment", "PostPage", "CommentPage", "CreatePost", "CreateComment", "Error"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("missing schema %s", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package bench
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository/memory"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+// Каждый пост получает commentsPerPost комментариев: rootsPerPost корневых,
+// у каждого из которых цепочка ответов, так что дерево не плоское.
+const (
+	commentsPerPost = 100
+	rootsPerPost    = 10
+)
+
+var sizes = []int{10_000, 100_000, 1_000_000}
+
+type dataset struct {
+	repo    *memory.InMemoryRepository
+	postIDs []uuid.UUID
+}
+
+func newDataset(b *testing.B, comments int) *dataset {
+	b.Helper()
+	repo := memory.NewInMemoryRepository()
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	posts := comments / commentsPerPost
+	ds := &dataset{repo: repo, postIDs: make([]uuid.UUID, 0, posts)}
+	tick := 0
+	next := func() *time.Time {
+		tick++
+		ts := base.Add(time.Duration(tick) * time.Millisecond)
+		return &ts
+	}
+
+	for p := 0; p < posts; p++ {
+		post, err := repo.CreatePost(ctx, &domain.Post{Text: fmt.Sprintf("Post %d", p), CreatedAt: next()}, nil)
+		if err != nil {
+			b.Fatalf("failed to create post: %v", err)
+		}
+		ds.postIDs = append(ds.postIDs, post.ID)
+		for r := 0; r < rootsPerPost; r++ {
+			var parentID *uuid.UUID
+			for c := 0; c < commentsPerPost/rootsPerPost; c++ {
+				comment, err := repo.CreateComment(ctx, &domain.Comment{PostID: post.ID, ParentID: parentID, Text: "Comment", CreatedAt: next()})
+				if err != nil {
+					b.Fatalf("failed to create comment: %v", err)
+				}
+				parentID = &comment.ID
+			}
+		}
+	}
+	return ds
+}
+
+// BenchmarkGetCommentsForPost измеряет чтение первой страницы дерева комментариев поста
+func BenchmarkGetCommentsForPost(b *testing.B) {
+	for _, size := range sizes {
+		ds := newDataset(b, size)
+		b.Run(fmt.Sprintf("comments=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				postID := ds.postIDs[i%len(ds.postIDs)]
+				if _, err := ds.repo.GetCommentsForPost(ctx, postID, 1, 10); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetPosts измеряет чтение страницы ленты постов
+func BenchmarkGetPosts(b *testing.B) {
+	for _, size := range sizes {
+		ds := newDataset(b, size)
+		b.Run(fmt.Sprintf("comments=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			pages := int32(len(ds.postIDs) / 10)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ds.repo.GetPosts(ctx, int32(i)%pages+1, 10); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCreateComment измеряет добавление ответа в уже заполненное хранилище
+func BenchmarkCreateComment(b *testing.B) {
+	for _, size := range sizes {
+		ds := newDataset(b, size)
+		b.Run(fmt.Sprintf("comments=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				postID := ds.postIDs[i%len(ds.postIDs)]
+				if _, err := ds.repo.CreateComment(ctx, &domain.Comment{PostID: postID, Text: "Reply"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package contract
+
+import (
+	"OZON/internal/repository"
+	"OZON/internal/repository/memory"
+	"OZON/internal/repository/repotest"
+	"testing"
+)
+
+// TestInMemoryContract прогоняет общий набор тестов хранилища для in-memory реализации
+func TestInMemoryContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) (repository.PostRepository, repository.CommentRepository) {
+		repo := memory.NewInMemoryRepository()
+		return repo, repo
+	})
+}
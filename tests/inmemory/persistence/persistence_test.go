@@ -0,0 +1,373 @@
+package persistence
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository"
+	"OZON/internal/repository/memory"
+	"OZON/internal/repository/repotest"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPersistentInMemoryRepository проверяет журнал, снапшоты и восстановление после перезапуска
+func TestPersistentInMemoryRepository(t *testing.T) {
+	t.Run("ReplayAfterRestart", testReplayAfterRestart)
+	t.Run("SnapshotCompaction", testSnapshotCompaction)
+	t.Run("TornTail", testTornTail)
+	t.Run("IntervalSync", testIntervalSync)
+	t.Run("InvalidOptions", testInvalidOptions)
+	t.Run("DeleteAndCounters", testDeleteAndCounters)
+	t.Run("CommentsAllowed", testCommentsAllowed)
+	t.Run("Import", testImport)
+	t.Run("DirInUse", testDirInUse)
+	t.Run("CloseTwice", testCloseTwice)
+}
+
+// TestPersistentContract прогоняет общий набор тестов хранилища для in-memory с журналом
+func TestPersistentContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) (repository.PostRepository, repository.CommentRepository) {
+		repo := open(t, memory.PersistenceOptions{Dir: t.TempDir(), Sync: memory.SyncNever})
+		return repo, repo
+	})
+}
+
+func open(t *testing.T, opts memory.PersistenceOptions) *memory.InMemoryRepository {
+	t.Helper()
+	repo, err := memory.NewPersistentInMemoryRepository(opts)
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func seed(t *testing.T, repo *memory.InMemoryRepository) (*domain.Post, *domain.Comment, *domain.Comment) {
+	t.Helper()
+	closed := false
+	post, err := repo.CreatePost(context.Background(), &domain.Post{Text: "Post"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	if _, err := repo.CreatePost(context.Background(), &domain.Post{Text: "Closed"}, &closed); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	root, err := repo.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, Text: "Root"})
+	if err != nil {
+		t.Fatalf("failed to create comment: %v", err)
+	}
+	reply, err := repo.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, ParentID: &root.ID, Text: "Reply"})
+	if err != nil {
+		t.Fatalf("failed to create reply: %v", err)
+	}
+	return post, root, reply
+}
+
+func verify(t *testing.T, repo *memory.InMemoryRepository, post *domain.Post, root, reply *domain.Comment) {
+	t.Helper()
+	got, err := repo.GetPost(context.Background(), post.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("post lost after restart: %v", err)
+	}
+	if len(got.Comments) != 1 || got.Comments[0].ID != root.ID {
+		t.Fatalf("root comment lost after restart: %+v", got.Comments)
+	}
+	if len(got.Comments[0].Children) != 1 || got.Comments[0].Children[0].ID != reply.ID {
+		t.Fatalf("reply lost after restart: %+v", got.Comments[0].Children)
+	}
+	if !got.CreatedAt.Equal(*post.CreatedAt) {
+		t.Errorf("created_at changed: got %v, want %v", got.CreatedAt, post.CreatedAt)
+	}
+
+	posts, err := repo.GetPosts(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get posts: %v", err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("expected 2 posts, got %d", len(posts))
+	}
+	for _, p := range posts {
+		if p.Text == "Closed" && p.AllowComments {
+			t.Errorf("allow_comments=false lost after restart")
+		}
+	}
+}
+
+// testReplayAfterRestart проверяет восстановление данных только из журнала
+func testReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	post, root, reply := seed(t, repo)
+	if err := repo.Close(); err != nil {
+		t.Fatalf("failed to close repository: %v", err)
+	}
+
+	verify(t, open(t, memory.PersistenceOptions{Dir: dir}), post, root, reply)
+}
+
+// testSnapshotCompaction проверяет, что снапшот заменяет старые сегменты журнала
+func testSnapshotCompaction(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	post, root, _ := seed(t, repo)
+	if err := repo.Snapshot(); err != nil {
+		t.Fatalf("failed to take snapshot: %v", err)
+	}
+	// Запись после снапшота должна попасть в новый сегмент и тоже восстановиться
+	late, err := repo.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, ParentID: &root.ID, Text: "Late"})
+	if err != nil {
+		t.Fatalf("failed to create comment: %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("failed to close repository: %v", err)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if len(segments) != 1 {
+		t.Errorf("expected compacted segments to be removed, found %v", segments)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "snapshot.jsonl")); err != nil {
+		t.Fatalf("snapshot not written: %v", err)
+	}
+
+	reopened := open(t, memory.PersistenceOptions{Dir: dir})
+	comments, err := reopened.GetCommentsForPost(context.Background(), post.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get comments: %v", err)
+	}
+	if len(comments) != 1 || len(comments[0].Children) != 2 || comments[0].Children[1].ID != late.ID {
+		t.Errorf("unexpected comments after restart: %+v", comments)
+	}
+}
+
+// testTornTail проверяет, что недописанная последняя запись журнала игнорируется
+func testTornTail(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	post, root, reply := seed(t, repo)
+	if err := repo.Close(); err != nil {
+		t.Fatalf("failed to close repository: %v", err)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	f.WriteString(`{"op":"create_comment","comment":{"ID":"`)
+	f.Close()
+
+	verify(t, open(t, memory.PersistenceOptions{Dir: dir}), post, root, reply)
+}
+
+// testIntervalSync проверяет фоновые fsync и снапшоты по таймеру
+func testIntervalSync(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{
+		Dir:              dir,
+		Sync:             memory.SyncInterval,
+		SyncInterval:     10 * time.Millisecond,
+		SnapshotInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	post, root, reply := seed(t, repo)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "snapshot.jsonl")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("periodic snapshot was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("failed to close repository: %v", err)
+	}
+
+	verify(t, open(t, memory.PersistenceOptions{Dir: dir}), post, root, reply)
+}
+
+// testInvalidOptions проверяет валидацию параметров
+func testInvalidOptions(t *testing.T) {
+	if _, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{}); err == nil {
+		t.Errorf("expected error for empty directory")
+	}
+	if _, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: t.TempDir(), Sync: "sometimes"}); err == nil {
+		t.Errorf("expected error for unknown sync policy")
+	}
+	if _, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: t.TempDir(), Sync: memory.SyncInterval}); err == nil {
+		t.Errorf("expected error for missing sync interval")
+	}
+}
+
+// testDeleteAndCounters проверяет, что удаление комментария и счётчики
+// восстанавливаются и из журнала, и из снапшота
+func testDeleteAndCounters(t *testing.T) {
+	for _, snapshot := range []bool{false, true} {
+		dir := t.TempDir()
+		repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir})
+		if err != nil {
+			t.Fatalf("failed to open repository: %v", err)
+		}
+		post, root, reply := seed(t, repo)
+		if _, err := repo.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, ParentID: &root.ID, Text: "Kept"}); err != nil {
+			t.Fatalf("failed to create comment: %v", err)
+		}
+		if err := repo.DeleteComment(context.Background(), reply.ID); err != nil {
+			t.Fatalf("failed to delete comment: %v", err)
+		}
+		if snapshot {
+			if err := repo.Snapshot(); err != nil {
+				t.Fatalf("failed to take snapshot: %v", err)
+			}
+		}
+		if err := repo.Close(); err != nil {
+			t.Fatalf("failed to close repository: %v", err)
+		}
+
+		reopened := open(t, memory.PersistenceOptions{Dir: dir})
+		deleted, err := reopened.GetComment(context.Background(), reply.ID)
+		if err != nil {
+			t.Fatalf("snapshot=%v: deleted comment lost: %v", snapshot, err)
+		}
+		if !deleted.IsDeleted() {
+			t.Errorf("snapshot=%v: deletion lost after restart", snapshot)
+		}
+		got, err := reopened.GetPost(context.Background(), post.ID, 1, 10)
+		if err != nil {
+			t.Fatalf("failed to get post: %v", err)
+		}
+		if got.CommentCount != 2 || got.Comments[0].ReplyCount != 1 {
+			t.Errorf("snapshot=%v: expected 2 comments and 1 reply, got %d and %d",
+				snapshot, got.CommentCount, got.Comments[0].ReplyCount)
+		}
+	}
+}
+
+// testCommentsAllowed проверяет, что закрытие комментариев и время изменения
+// поста восстанавливаются и из журнала, и из снапшота
+func testCommentsAllowed(t *testing.T) {
+	for _, snapshot := range []bool{false, true} {
+		dir := t.TempDir()
+		repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir})
+		if err != nil {
+			t.Fatalf("failed to open repository: %v", err)
+		}
+		post, _, _ := seed(t, repo)
+		time.Sleep(time.Millisecond)
+		if err := repo.SetCommentsAllowed(context.Background(), post.ID, false); err != nil {
+			t.Fatalf("failed to close comments: %v", err)
+		}
+		closed, err := repo.LastModified(context.Background(), post.ID)
+		if err != nil {
+			t.Fatalf("failed to get last modification: %v", err)
+		}
+		if snapshot {
+			if err := repo.Snapshot(); err != nil {
+				t.Fatalf("failed to take snapshot: %v", err)
+			}
+		}
+		if err := repo.Close(); err != nil {
+			t.Fatalf("failed to close repository: %v", err)
+		}
+
+		reopened := open(t, memory.PersistenceOptions{Dir: dir})
+		allowed, err := reopened.IsCommentsAllowed(context.Background(), post.ID)
+		if err != nil || allowed {
+			t.Errorf("snapshot=%v: closed comments lost after restart: %v, %v", snapshot, allowed, err)
+		}
+		modified, err := reopened.LastModified(context.Background(), post.ID)
+		if err != nil || !modified.Equal(closed) {
+			t.Errorf("snapshot=%v: expected UpdatedAt %s after restart, got %s, %v", snapshot, closed, modified, err)
+		}
+	}
+}
+
+// testImport проверяет, что импортированные посты и комментарии вместе с
+// временем изменения поста восстанавливаются из журнала
+func testImport(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	post, root, _ := seed(t, repo)
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	imported := &domain.Post{ID: uuid.New(), Text: "Imported", AllowComments: true, CreatedAt: &createdAt}
+	comments := []*domain.Comment{
+		{ID: uuid.New(), PostID: imported.ID, Text: "Imported comment", CreatedAt: &createdAt},
+		{ID: uuid.New(), PostID: post.ID, ParentID: &root.ID, Text: "Old reply", CreatedAt: &createdAt},
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := repo.Import(context.Background(), []*domain.Post{imported}, comments); err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	modified, err := repo.LastModified(context.Background(), post.ID)
+	if err != nil {
+		t.Fatalf("failed to get last modification: %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("failed to close repository: %v", err)
+	}
+
+	reopened := open(t, memory.PersistenceOptions{Dir: dir})
+	got, err := reopened.GetPost(context.Background(), imported.ID, 1, 10)
+	if err != nil || got.CommentCount != 1 || !got.CreatedAt.Equal(createdAt) {
+		t.Errorf("imported post lost after restart: %+v, %v", got, err)
+	}
+	if got, err := reopened.LastModified(context.Background(), post.ID); err != nil || !got.Equal(modified) {
+		t.Errorf("expected UpdatedAt %s after restart, got %s, %v", modified, got, err)
+	}
+}
+
+// testDirInUse проверяет, что каталог журнала нельзя открыть второй раз, пока он не закрыт
+func testDirInUse(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	post, root, reply := seed(t, repo)
+
+	if _, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir}); !errors.Is(err, memory.ErrDirInUse) {
+		t.Fatalf("expected ErrDirInUse while the directory is open, got %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("failed to close repository: %v", err)
+	}
+	verify(t, open(t, memory.PersistenceOptions{Dir: dir}), post, root, reply)
+}
+
+// testCloseTwice проверяет, что повторный Close не паникует и освобождает каталог
+func testCloseTwice(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := memory.NewPersistentInMemoryRepository(memory.PersistenceOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	post, root, reply := seed(t, repo)
+
+	for i := 0; i < 2; i++ {
+		if err := repo.Close(); err != nil {
+			t.Fatalf("close %d: %v", i+1, err)
+		}
+	}
+	verify(t, open(t, memory.PersistenceOptions{Dir: dir}), post, root, reply)
+}
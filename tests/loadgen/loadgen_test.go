@@ -0,0 +1,234 @@
+package loadgen
+
+import (
+	"OZON/graph"
+	"OZON/internal/admin"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/loadgen"
+	"OZON/internal/repository/memory"
+	"OZON/internal/usecases"
+	"OZON/pkg/pubsub"
+	"bytes"
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadGen проверяет генератор данных и нагрузочный тест
+func TestLoadGen(t *testing.T) {
+	t.Run("Generate", testGenerate)
+	t.Run("Reproducible", testReproducible)
+	t.Run("Skew", testSkew)
+	t.Run("InvalidOptions", testInvalidOptions)
+	t.Run("ParseMix", testParseMix)
+	t.Run("LoadTest", testLoadTest)
+	t.Run("LoadTestWithoutPosts", testLoadTestWithoutPosts)
+	t.Run("LoadTestRate", testLoadTestRate)
+}
+
+func options() loadgen.GenerateOptions {
+	return loadgen.GenerateOptions{Posts: 20, Comments: 5, Branching: 1.5, MaxDepth: 4, Skew: 1, ClosedRatio: 0.2, Seed: 7, Workers: 4}
+}
+
+func generate(t *testing.T, repo *memory.InMemoryRepository, opts loadgen.GenerateOptions) loadgen.GenerateResult {
+	t.Helper()
+	result, err := loadgen.Generate(context.Background(),
+		usecases.NewPostUsecase(repo, repo), usecases.NewCommentUsecase(repo, repo, 0), opts)
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	return result
+}
+
+// testGenerate проверяет, что сгенерированные данные совпадают с отчётом и не глубже предела
+func testGenerate(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	result := generate(t, repo, options())
+	stats, err := admin.CollectStats(context.Background(), repo, repo)
+	if err != nil {
+		t.Fatalf("failed to collect stats: %v", err)
+	}
+	if stats.Posts != 20 || stats.Comments != result.Comments || stats.DeepestThread != result.DeepestThread ||
+		stats.BusiestComments != result.BusiestComments {
+		t.Errorf("result %+v does not match the stored data %+v", result, *stats)
+	}
+	if result.DeepestThread > 4 || result.Comments < 100 {
+		t.Errorf("expected at least 100 comments at most 4 levels deep, got %+v", result)
+	}
+
+	posts, err := repo.GetPosts(context.Background(), 1, 100)
+	if err != nil {
+		t.Fatalf("failed to get posts: %v", err)
+	}
+	closed := 0
+	for _, post := range posts {
+		if !post.AllowComments {
+			closed++
+		}
+	}
+	if closed == 0 || closed == len(posts) {
+		t.Errorf("expected some posts to be closed, got %d of %d", closed, len(posts))
+	}
+}
+
+// testReproducible проверяет, что форма данных зависит только от seed
+func testReproducible(t *testing.T) {
+	first := generate(t, memory.NewInMemoryRepository(), options())
+	opts := options()
+	opts.Workers = 1
+	if second := generate(t, memory.NewInMemoryRepository(), opts); second != first {
+		t.Errorf("expected the same data set with the same seed, got %+v and %+v", first, second)
+	}
+	opts.Seed++
+	if other := generate(t, memory.NewInMemoryRepository(), opts); other == first {
+		t.Errorf("expected another seed to change the data set, got %+v", other)
+	}
+}
+
+// testSkew проверяет, что без перекоса комментарии распределяются поровну, а с перекосом — нет
+func testSkew(t *testing.T) {
+	opts := options()
+	opts.Branching, opts.Posts, opts.Comments = 0, 10, 10
+	opts.Skew = 0
+	if even := generate(t, memory.NewInMemoryRepository(), opts); even.BusiestComments != 10 {
+		t.Errorf("expected 10 comments on every post, busiest has %d", even.BusiestComments)
+	}
+	opts.Skew = 2
+	if skewed := generate(t, memory.NewInMemoryRepository(), opts); skewed.BusiestComments < 50 {
+		t.Errorf("expected the most popular post to get most comments, it has %d of 100", skewed.BusiestComments)
+	}
+}
+
+// testInvalidOptions проверяет отказ при недопустимых параметрах генератора
+func testInvalidOptions(t *testing.T) {
+	for _, change := range []func(o *loadgen.GenerateOptions){
+		func(o *loadgen.GenerateOptions) { o.Posts = 0 },
+		func(o *loadgen.GenerateOptions) { o.Comments = -1 },
+		func(o *loadgen.GenerateOptions) { o.Branching = 11 },
+		func(o *loadgen.GenerateOptions) { o.MaxDepth = 0 },
+		func(o *loadgen.GenerateOptions) { o.Skew = -1 },
+		func(o *loadgen.GenerateOptions) { o.ClosedRatio = 2 },
+		func(o *loadgen.GenerateOptions) { o.Workers = 0 },
+	} {
+		opts := options()
+		change(&opts)
+		if err := opts.Validate(); err == nil {
+			t.Errorf("expected options %+v to be invalid", opts)
+		}
+	}
+}
+
+// testParseMix проверяет разбор весов операций
+func testParseMix(t *testing.T) {
+	mix, err := loadgen.ParseMix("getPosts=1, getPost=3,createComment=0")
+	if err != nil {
+		t.Fatalf("failed to parse mix: %v", err)
+	}
+	if len(mix) != 3 || mix[loadgen.OpGetPosts] != 1 || mix[loadgen.OpGetPost] != 3 {
+		t.Errorf("unexpected mix %v", mix)
+	}
+	for _, s := range []string{"", "getPosts", "getPosts=-1", "deletePost=1", "getPosts=0"} {
+		if _, err := loadgen.ParseMix(s); err == nil {
+			t.Errorf("expected mix %q to be invalid", s)
+		}
+	}
+}
+
+func newServer(t *testing.T, repo *memory.InMemoryRepository) *httptest.Server {
+	t.Helper()
+	resolver := handlers.NewResolver(usecases.NewPostUsecase(repo, repo), usecases.NewCommentUsecase(repo, repo, 0), pubsub.New[*domain.Comment]())
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	server := httptest.NewServer(srv)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testLoadTest проверяет нагрузочный тест против сервера на in-memory хранилище
+func testLoadTest(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	opts := options()
+	opts.ClosedRatio = 0
+	generate(t, repo, opts)
+	server := newServer(t, repo)
+
+	report, err := loadgen.LoadTest(context.Background(), loadgen.LoadOptions{
+		URL:         server.URL,
+		Duration:    300 * time.Millisecond,
+		Concurrency: 4,
+		Mix:         loadgen.Mix{loadgen.OpGetPosts: 1, loadgen.OpGetPost: 1, loadgen.OpCreateComment: 1},
+		Skew:        1,
+	})
+	if err != nil {
+		t.Fatalf("load test failed: %v", err)
+	}
+	if len(report.Ops) != 3 {
+		t.Fatalf("expected a report of 3 operations, got %+v", report.Ops)
+	}
+	for _, op := range report.Ops {
+		if op.Requests == 0 || op.Errors != 0 {
+			t.Errorf("%s: expected requests without errors, got %+v", op.Op, op)
+		}
+		if op.P50 <= 0 || op.P50 > op.P90 || op.P90 > op.P99 || op.P99 > op.Max {
+			t.Errorf("%s: percentiles out of order: %+v", op.Op, op)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := report.Write(&out); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+	for _, want := range []string{"OPERATION", "getPosts", "getPost", "createComment", "P99"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the report:\n%s", want, out.String())
+		}
+	}
+}
+
+// testLoadTestWithoutPosts проверяет, что нагрузочный тест без данных завершается понятной ошибкой
+func testLoadTestWithoutPosts(t *testing.T) {
+	server := newServer(t, memory.NewInMemoryRepository())
+	_, err := loadgen.LoadTest(context.Background(), loadgen.LoadOptions{URL: server.URL, Duration: time.Second, Concurrency: 1})
+	if err == nil || !strings.Contains(err.Error(), "no posts") {
+		t.Errorf("expected an error about missing posts, got %v", err)
+	}
+}
+
+// testLoadTestRate проверяет, что при --rate задержка считается от запланированного
+// времени отправки: запросы, ждавшие медленного сервера, учитывают и это ожидание
+func testLoadTestRate(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	repo := memory.NewInMemoryRepository()
+	generate(t, repo, options())
+	server := newServer(t, repo)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(slow.Close)
+
+	// Сервер отвечает раз в 20 мс, а запросы запланированы раз в 10 мс:
+	// очередь растёт, и поздние запросы ждут своей отправки всё дольше.
+	report, err := loadgen.LoadTest(context.Background(), loadgen.LoadOptions{
+		URL:         slow.URL,
+		Duration:    300 * time.Millisecond,
+		Concurrency: 1,
+		Rate:        100,
+		Mix:         loadgen.Mix{loadgen.OpGetPosts: 1},
+	})
+	if err != nil {
+		t.Fatalf("load test failed: %v", err)
+	}
+	if len(report.Ops) != 1 || report.Ops[0].Requests == 0 {
+		t.Fatalf("expected getPosts requests, got %+v", report.Ops)
+	}
+	if got := report.Ops[0].Max; got < 4*delay {
+		t.Errorf("expected the queueing delay in the latency, got max %s", got)
+	}
+}
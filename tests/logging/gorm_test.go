@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository/sqlite"
+	"OZON/pkg/logging"
+	"OZON/pkg/storage"
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGormLogger проверяет, что SQL пишется в slog с ID запроса и без значений параметров
+func TestGormLogger(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, "debug", "text"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "ozon.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	defer db.Close()
+	repo := sqlite.NewSQLiteRepository(*db)
+
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	if _, err := repo.CreatePost(ctx, &domain.Post{Text: "private text"}, nil); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+
+	var insert string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "INSERT INTO") {
+			insert = line
+		}
+	}
+	if insert == "" {
+		t.Fatalf("statement not logged at debug level:\n%s", buf.String())
+	}
+	if !strings.Contains(insert, "level=DEBUG") || !strings.Contains(insert, "request_id=req-1") {
+		t.Errorf("expected a debug record with the request ID, got %s", insert)
+	}
+	if strings.Contains(buf.String(), "private text") {
+		t.Errorf("statement arguments must not be logged:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	slog.SetDefault(logging.New(&buf, "info", "text"))
+	if _, err := repo.GetPosts(ctx, 1, 10); err != nil {
+		t.Fatalf("failed to get posts: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("statements must not be logged at info level:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"OZON/pkg/logging"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRequestID проверяет присвоение и передачу идентификатора запроса
+func TestRequestID(t *testing.T) {
+	t.Run("Generated", testGenerated)
+	t.Run("FromClient", testFromClient)
+	t.Run("InvalidFromClient", testInvalidFromClient)
+	t.Run("AddedToRecords", testAddedToRecords)
+}
+
+// serve прогоняет запрос через middleware и возвращает ID из контекста и из заголовка ответа
+func serve(t *testing.T, header string) (fromContext, fromResponse string) {
+	t.Helper()
+	handler := logging.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromContext = logging.RequestID(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	if header != "" {
+		req.Header.Set(logging.Header, header)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return fromContext, rec.Header().Get(logging.Header)
+}
+
+func testGenerated(t *testing.T) {
+	ctxID, respID := serve(t, "")
+	if ctxID == "" || ctxID != respID {
+		t.Errorf("expected the same generated ID in context and response, got %q and %q", ctxID, respID)
+	}
+	other, _ := serve(t, "")
+	if other == ctxID {
+		t.Errorf("expected a new ID for every request, got %q twice", ctxID)
+	}
+}
+
+func testFromClient(t *testing.T) {
+	if ctxID, respID := serve(t, "req-42.a:b_c"); ctxID != "req-42.a:b_c" || respID != ctxID {
+		t.Errorf("expected the client's ID, got %q and %q", ctxID, respID)
+	}
+}
+
+// testInvalidFromClient проверяет, что ID с переводом строки или слишком длинный заменяется
+func testInvalidFromClient(t *testing.T) {
+	for _, id := range []string{"forged\nlevel=ERROR", strings.Repeat("a", 129)} {
+		if ctxID, _ := serve(t, id); ctxID == id {
+			t.Errorf("expected %q to be replaced", id)
+		}
+	}
+}
+
+func testAddedToRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, "info", "json")
+
+	logger.DebugContext(context.Background(), "hidden")
+	logger.With("component", "test").InfoContext(logging.WithRequestID(context.Background(), "abc"), "hello")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one record at info level, got %d: %s", len(lines), buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("invalid JSON record: %v", err)
+	}
+	if record["msg"] != "hello" || record["request_id"] != "abc" || record["component"] != "test" {
+		t.Errorf("unexpected record: %v", record)
+	}
+}
+
+// TestRedactVariables проверяет скрытие переменных, переданных в чувствительные аргументы, и чувствительных полей
+func TestRedactVariables(t *testing.T) {
+	vars := map[string]interface{}{
+		"postId":   "5d0c1e5c-1a5b-4c4e-9a8e-1f7e7e3f8b11",
+		"body":     "hello",
+		"text":     "kept",
+		"input":    map[string]interface{}{"commentText": "hi", "limit": 10},
+		"list":     []interface{}{map[string]interface{}{"apiToken": "t"}},
+		"long":     strings.Repeat("x", 100),
+		"Password": "p",
+	}
+	got := logging.RedactVariables(vars, map[string]bool{"body": true, "Password": true})
+
+	if got["postId"] != vars["postId"] || got["text"] != "kept" {
+		t.Errorf("postId and text should be kept, got %v and %v", got["postId"], got["text"])
+	}
+	if got["body"] != logging.Redacted || got["Password"] != logging.Redacted {
+		t.Errorf("body and Password should be redacted, got %v and %v", got["body"], got["Password"])
+	}
+	input := got["input"].(map[string]interface{})
+	if input["commentText"] != logging.Redacted || input["limit"] != 10 {
+		t.Errorf("nested variables not redacted correctly: %v", input)
+	}
+	if token := got["list"].([]interface{})[0].(map[string]interface{})["apiToken"]; token != logging.Redacted {
+		t.Errorf("variables in lists should be redacted, got %v", token)
+	}
+	if long := got["long"].(string); len(long) >= 100 || !strings.Contains(long, "100 characters") {
+		t.Errorf("long strings should be truncated, got %q", long)
+	}
+	if vars["body"] != "hello" {
+		t.Errorf("the original variables were modified")
+	}
+}
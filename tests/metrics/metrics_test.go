@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"OZON/graph"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/metrics"
+	"OZON/internal/repository/backend"
+	"OZON/internal/usecases"
+	"OZON/pkg/pubsub"
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "OZON/internal/repository/memory"
+	_ "OZON/internal/repository/sqlite"
+)
+
+// TestMetrics проверяет метрики репозиториев, GraphQL, пула соединений и брокера
+func TestMetrics(t *testing.T) {
+	t.Run("Repository", testRepository)
+	t.Run("GraphQL", testGraphQL)
+	t.Run("Pool", testPool)
+	t.Run("Broker", testBroker)
+}
+
+// scrape возвращает ответ /metrics
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func expectLine(t *testing.T, body, line string) {
+	t.Helper()
+	for _, l := range strings.Split(body, "\n") {
+		if l == line {
+			return
+		}
+	}
+	t.Errorf("metric line %q not found", line)
+}
+
+func openInMemory(t *testing.T, m *metrics.Metrics) *backend.Storage {
+	t.Helper()
+	s, err := backend.Open("inmemory", backend.Settings{})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	m.InstrumentStorage("inmemory", s)
+	return s
+}
+
+// testRepository проверяет время и ошибки вызовов репозитория с кодом ошибки
+func testRepository(t *testing.T) {
+	m := metrics.New()
+	s := openInMemory(t, m)
+
+	if _, err := s.PostRepository.CreatePost(context.Background(), &domain.Post{Text: "Post"}, nil); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	if _, err := s.CommentRepository.GetComment(context.Background(), uuid.New()); err == nil {
+		t.Fatal("expected an error for a missing comment")
+	}
+
+	body := scrape(t, m)
+	expectLine(t, body, `ozon_repository_call_duration_seconds_count{backend="inmemory",method="CreatePost"} 1`)
+	expectLine(t, body, `ozon_repository_call_duration_seconds_count{backend="inmemory",method="GetComment"} 1`)
+	expectLine(t, body, `ozon_repository_errors_total{backend="inmemory",code="NOT_FOUND",method="GetComment"} 1`)
+}
+
+// testGraphQL проверяет гистограммы операций и резолверов
+func testGraphQL(t *testing.T) {
+	m := metrics.New()
+	s := openInMemory(t, m)
+	resolver := handlers.NewResolver(
+		usecases.NewPostUsecase(s.PostRepository, s.CommentRepository),
+		usecases.NewCommentUsecase(s.PostRepository, s.CommentRepository, 0),
+		pubsub.New[*domain.Comment](),
+	)
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(m.GraphQL([]string{"NewPost"}))
+
+	for _, query := range []string{
+		`{"query":"mutation NewPost { createPost(text: \"hi\") { id text } }"}`,
+		`{"query":"query { getPost(id: \"` + uuid.NewString() + `\") { id } }"}`,
+		`{"query":"query Broken { nope }"}`,
+		`{"query":"query Random1234 { getPosts { id } }"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(query))
+		req.Header.Set("Content-Type", "application/json")
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrape(t, m)
+	expectLine(t, body, `ozon_graphql_operation_duration_seconds_count{operation="NewPost",status="ok",type="mutation"} 1`)
+	expectLine(t, body, `ozon_graphql_operation_duration_seconds_count{operation="anonymous",status="error",type="query"} 1`)
+	// Неизвестные имена не создают новых рядов
+	expectLine(t, body, `ozon_graphql_operation_duration_seconds_count{operation="other",status="ok",type="query"} 1`)
+	if strings.Contains(body, `operation="Random1234"`) {
+		t.Errorf("unknown operation names must not become label values")
+	}
+	// Имя операции, не прошедшей валидацию, известно только из operationName
+	expectLine(t, body, `ozon_graphql_operation_duration_seconds_count{operation="anonymous",status="error",type="invalid"} 1`)
+	expectLine(t, body, `ozon_graphql_resolver_duration_seconds_count{field="createPost",object="Mutation"} 1`)
+	expectLine(t, body, `ozon_graphql_resolver_errors_total{field="getPost",object="Query"} 1`)
+	// Поля без резолвера не создают рядов
+	if strings.Contains(body, `field="text"`) {
+		t.Errorf("struct fields should not be measured")
+	}
+}
+
+// testPool проверяет статистику пула соединений SQL-бэкенда
+func testPool(t *testing.T) {
+	m := metrics.New()
+	s, err := backend.Open("sqlite", backend.Settings{SQLitePath: filepath.Join(t.TempDir(), "ozon.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer s.Close()
+	m.InstrumentStorage("sqlite", s)
+
+	expectLine(t, scrape(t, m), `go_sql_max_open_connections{db_name="sqlite"} 1`)
+}
+
+// testBroker проверяет число подписок и глубину очередей брокера
+func testBroker(t *testing.T) {
+	m := metrics.New()
+	b := pubsub.New[int]()
+	m.RegisterBroker("comments", b)
+
+	if _, err := b.Subscribe(context.Background(), "post"); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	b.Publish("post", 1)
+	b.Publish("post", 2)
+
+	body := scrape(t, m)
+	expectLine(t, body, `ozon_pubsub_subscribers{broker="comments"} 1`)
+	expectLine(t, body, `ozon_pubsub_queued_messages{broker="comments"} 2`)
+	expectLine(t, body, `ozon_pubsub_max_queued_messages{broker="comments"} 2`)
+	expectLine(t, body, `ozon_pubsub_dropped_subscribers_total{broker="comments"} 0`)
+}
@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"OZON/pkg/migrate"
+	"OZON/pkg/storage/migrations"
+	"testing"
+	"testing/fstest"
+)
+
+// TestLoad проверяет разбор файлов миграций
+func TestLoad(t *testing.T) {
+	t.Run("Embedded", testEmbedded)
+	t.Run("Ordering", testOrdering)
+	t.Run("MissingDown", testMissingDown)
+	t.Run("InvalidName", testInvalidName)
+	t.Run("ConflictingNames", testConflictingNames)
+}
+
+func file(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+// testEmbedded проверяет, что встроенные миграции корректны и нумеруются с 1
+func testEmbedded(t *testing.T) {
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("failed to load embedded migrations: %v", err)
+	}
+	if len(all) == 0 || all[0].Version != 1 {
+		t.Fatalf("expected migrations starting at version 1, got %+v", all)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Version != all[i-1].Version+1 {
+			t.Errorf("gap between versions %d and %d", all[i-1].Version, all[i].Version)
+		}
+	}
+}
+
+func testOrdering(t *testing.T) {
+	all, err := migrate.Load(fstest.MapFS{
+		"0010_second.up.sql":   file("SELECT 10"),
+		"0010_second.down.sql": file("SELECT -10"),
+		"0002_first.up.sql":    file("SELECT 2"),
+		"0002_first.down.sql":  file("SELECT -2"),
+		"README.md":            file("ignored"),
+	})
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(all))
+	}
+	if all[0].Version != 2 || all[0].Name != "first" || all[0].Up != "SELECT 2" || all[0].Down != "SELECT -2" {
+		t.Errorf("unexpected first migration: %+v", all[0])
+	}
+	if all[1].Version != 10 || all[1].Name != "second" {
+		t.Errorf("unexpected second migration: %+v", all[1])
+	}
+
+	m := migrate.New(nil, all)
+	if m.Latest() != 10 {
+		t.Errorf("expected latest version 10, got %d", m.Latest())
+	}
+}
+
+func testMissingDown(t *testing.T) {
+	_, err := migrate.Load(fstest.MapFS{"0001_init.up.sql": file("SELECT 1")})
+	if err == nil {
+		t.Errorf("expected error for migration without down file")
+	}
+}
+
+func testInvalidName(t *testing.T) {
+	_, err := migrate.Load(fstest.MapFS{"init.up.sql": file("SELECT 1")})
+	if err == nil {
+		t.Errorf("expected error for unnumbered migration")
+	}
+}
+
+func testConflictingNames(t *testing.T) {
+	_, err := migrate.Load(fstest.MapFS{
+		"0001_init.up.sql":    file("SELECT 1"),
+		"0001_other.down.sql": file("SELECT -1"),
+	})
+	if err == nil {
+		t.Errorf("expected error for two names of one version")
+	}
+}
@@ -0,0 +1,164 @@
+package persisted
+
+import (
+	"OZON/graph"
+	"OZON/internal/repository/cache"
+	"OZON/pkg/persisted"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestPersisted проверяет разбор манифеста, его проверку по схеме и кэш APQ
+func TestPersisted(t *testing.T) {
+	t.Run("Apollo", testApollo)
+	t.Run("Map", testMap)
+	t.Run("Invalid", testInvalid)
+	t.Run("Validate", testValidate)
+	t.Run("OperationNames", testOperationNames)
+	t.Run("Cache", testCache)
+}
+
+const feed = "query Feed { getPosts { id text } }"
+
+func apolloManifest(t *testing.T, ops ...persisted.Operation) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"format":     "apollo-persisted-query-manifest",
+		"version":    1,
+		"operations": ops,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func operation(name, body string) persisted.Operation {
+	return persisted.Operation{ID: persisted.Hash(body), Name: name, Type: "query", Body: body}
+}
+
+func testApollo(t *testing.T) {
+	m, err := persisted.ParseManifest(apolloManifest(t, operation("Feed", feed)))
+	if err != nil {
+		t.Fatalf("failed to parse the manifest: %v", err)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected 1 operation, got %d", m.Len())
+	}
+	if query, ok := m.Lookup(persisted.Hash(feed)); !ok || query != feed {
+		t.Errorf("expected the Feed query by its hash, got %q", query)
+	}
+	if _, ok := m.Lookup(persisted.Hash("{ getPosts { id } }")); ok {
+		t.Error("a query outside the manifest must not be found")
+	}
+}
+
+// testMap проверяет манифест в виде объекта «хеш — запрос»
+func testMap(t *testing.T) {
+	data, _ := json.Marshal(map[string]string{persisted.Hash(feed): feed})
+	m, err := persisted.ParseManifest(data)
+	if err != nil {
+		t.Fatalf("failed to parse the manifest: %v", err)
+	}
+	if _, ok := m.Lookup(persisted.Hash(feed)); !ok {
+		t.Error("expected the Feed query by its hash")
+	}
+}
+
+// testOperationNames проверяет имена операций из тел запросов без повторов и анонимных
+func testOperationNames(t *testing.T) {
+	post := "query Post($id: ID!) { getPost(id: $id) { id } } query Feed { getPosts { id } }"
+	data, _ := json.Marshal(map[string]string{
+		persisted.Hash(feed):                  feed,
+		persisted.Hash(post):                  post,
+		persisted.Hash("{ getPosts { id } }"): "{ getPosts { id } }",
+	})
+	m, err := persisted.ParseManifest(data)
+	if err != nil {
+		t.Fatalf("failed to parse the manifest: %v", err)
+	}
+	if got := strings.Join(m.OperationNames(), ","); got != "Feed,Post" {
+		t.Errorf("expected Feed,Post, got %s", got)
+	}
+}
+
+func testInvalid(t *testing.T) {
+	wrongID := operation("Feed", feed)
+	wrongID.ID = persisted.Hash("something else")
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"NotJSON", []byte("Feed: query Feed { getPosts { id } }")},
+		{"Format", []byte(`{"format": "relay", "version": 1, "operations": []}`)},
+		{"WrongID", apolloManifest(t, wrongID)},
+		{"EmptyBody", apolloManifest(t, persisted.Operation{ID: persisted.Hash("")})},
+		{"MapValue", []byte(`{"abc": 1}`)},
+	}
+	for _, tt := range tests {
+		if _, err := persisted.ParseManifest(tt.data); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+// testValidate проверяет операции манифеста по схеме сервера
+func testValidate(t *testing.T) {
+	schema := graph.NewExecutableSchema(graph.Config{}).Schema()
+
+	m, _ := persisted.ParseManifest(apolloManifest(t,
+		operation("Feed", feed),
+		operation("CreatePost", `mutation CreatePost($text: String!) { createPost(text: $text) { id } }`),
+	))
+	if err := m.Validate(schema); err != nil {
+		t.Errorf("expected a valid manifest, got %v", err)
+	}
+
+	m, _ = persisted.ParseManifest(apolloManifest(t,
+		operation("Feed", feed),
+		operation("Titles", "query Titles { getPosts { title } }"),
+		operation("Renamed", "query Posts { getPosts { id } }"),
+	))
+	err := m.Validate(schema)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{`operation Titles`, `"title"`, `operation Renamed`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error must mention %s, got: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "operation Feed") {
+		t.Errorf("a valid operation must not be reported: %v", err)
+	}
+}
+
+// testCache проверяет кэш APQ: запросы манифеста известны всегда, остальные регистрируются
+func testCache(t *testing.T) {
+	ctx := context.Background()
+	store, err := cache.NewLRU(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := persisted.ParseManifest(apolloManifest(t, operation("Feed", feed)))
+	c := persisted.NewCache(store, m)
+
+	if query, ok := c.Get(ctx, persisted.Hash(feed)); !ok || query != feed {
+		t.Errorf("expected the manifest query, got %q", query)
+	}
+	c.Add(ctx, persisted.Hash(feed), feed)
+	if store.Len() != 0 {
+		t.Error("manifest queries must not be stored")
+	}
+
+	const other = "{ getPosts { id } }"
+	if _, ok := c.Get(ctx, persisted.Hash(other)); ok {
+		t.Fatal("an unregistered query must be a miss")
+	}
+	c.Add(ctx, persisted.Hash(other), other)
+	if query, ok := c.Get(ctx, persisted.Hash(other)); !ok || query != other {
+		t.Errorf("expected the registered query, got %q", query)
+	}
+}
@@ -3,7 +3,7 @@ package comment
 import (
 	"OZON/internal/domain"
 	pg "OZON/internal/repository/postrges"
-	"OZON/pkg/storage"
+	"OZON/tests/postgres/pgtest"
 	"context"
 	"github.com/google/uuid"
 	"testing"
@@ -11,10 +11,7 @@ import (
 
 // TestCommentRepository содержит тесты для CommentRepository
 func TestCommentRepository(t *testing.T) {
-	db, err := storage.NewPostgresDB()
-	if err != nil {
-		t.Fatalf("failed to connect to database: %v", err)
-	}
+	db := pgtest.NewDB(t)
 	repo := pg.NewPostgresRepository(*db)
 
 	if err := db.Exec("TRUNCATE TABLE posts, comments RESTART IDENTITY CASCADE").Error; err != nil {
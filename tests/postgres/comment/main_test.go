@@ -0,0 +1,10 @@
+package comment
+
+import (
+	"OZON/tests/postgres/pgtest"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
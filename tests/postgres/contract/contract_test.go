@@ -0,0 +1,17 @@
+package contract
+
+import (
+	"OZON/internal/repository"
+	pg "OZON/internal/repository/postrges"
+	"OZON/internal/repository/repotest"
+	"OZON/tests/postgres/pgtest"
+	"testing"
+)
+
+// TestPostgresContract прогоняет общий набор тестов хранилища для Postgres
+func TestPostgresContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) (repository.PostRepository, repository.CommentRepository) {
+		repo := pg.NewPostgresRepository(*pgtest.NewDB(t))
+		return repo, repo
+	})
+}
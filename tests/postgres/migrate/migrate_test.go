@@ -0,0 +1,170 @@
+package migrate
+
+import (
+	"OZON/pkg/migrate"
+	"OZON/pkg/storage"
+	"OZON/tests/postgres/pgtest"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// TestMigrations проверяет применение и откат миграций на пустой схеме
+func TestMigrations(t *testing.T) {
+	t.Run("UpDownRoundTrip", testUpDownRoundTrip)
+	t.Run("To", testTo)
+	t.Run("ConcurrentUp", testConcurrentUp)
+	t.Run("NoMigrate", testNoMigrate)
+}
+
+func connect(t *testing.T, url string) (*storage.DB, *migrate.Migrator) {
+	t.Helper()
+	db, err := storage.ConnectPostgres(storage.PostgresConfig{ConnString: url})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := db.Migrator()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	return db, m
+}
+
+func tableExists(t *testing.T, db *storage.DB, table string) bool {
+	t.Helper()
+	var exists bool
+	if err := db.Raw("SELECT to_regclass(?) IS NOT NULL", table).Scan(&exists).Error; err != nil {
+		t.Fatalf("failed to look up %s: %v", table, err)
+	}
+	return exists
+}
+
+func appliedCount(t *testing.T, m *migrate.Migrator) int {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	n := 0
+	for _, s := range statuses {
+		if s.Applied {
+			n++
+		}
+	}
+	return n
+}
+
+func testUpDownRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, m := connect(t, pgtest.NewURL(t))
+
+	if n := appliedCount(t, m); n != 0 {
+		t.Fatalf("fresh schema: expected no applied migrations, got %d", n)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	if !tableExists(t, db, "comments") {
+		t.Fatalf("comments table missing after up")
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Errorf("check after up: %v", err)
+	}
+	// Up is idempotent.
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("second up failed: %v", err)
+	}
+
+	for i := m.Latest(); i > 0; i-- {
+		if err := m.Down(ctx); err != nil {
+			t.Fatalf("down from %d failed: %v", i, err)
+		}
+	}
+	if n := appliedCount(t, m); n != 0 {
+		t.Errorf("expected no applied migrations after rolling back, got %d", n)
+	}
+	if tableExists(t, db, "comments") || tableExists(t, db, "posts") {
+		t.Errorf("tables must be dropped after rolling back everything")
+	}
+	if err := m.Down(ctx); err != nil {
+		t.Errorf("down on an empty schema must be a no-op: %v", err)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up after full rollback failed: %v", err)
+	}
+}
+
+func testTo(t *testing.T) {
+	ctx := context.Background()
+	db, m := connect(t, pgtest.NewURL(t))
+
+	if err := m.To(ctx, 1); err != nil {
+		t.Fatalf("to 1 failed: %v", err)
+	}
+	if n := appliedCount(t, m); n != 1 {
+		t.Errorf("expected 1 applied migration, got %d", n)
+	}
+	if err := m.To(ctx, 0); err != nil {
+		t.Fatalf("to 0 failed: %v", err)
+	}
+	if tableExists(t, db, "posts") {
+		t.Errorf("posts must be dropped by to 0")
+	}
+	if err := m.To(ctx, m.Latest()+1); err == nil {
+		t.Errorf("expected error for an unknown version")
+	}
+}
+
+// testConcurrentUp проверяет, что одновременный запуск нескольких реплик
+// применяет каждую миграцию один раз
+func testConcurrentUp(t *testing.T) {
+	url := pgtest.NewURL(t)
+	const replicas = 5
+	migrators := make([]*migrate.Migrator, replicas)
+	for i := range migrators {
+		_, migrators[i] = connect(t, url)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, replicas)
+	for _, m := range migrators {
+		wg.Add(1)
+		go func(m *migrate.Migrator) {
+			defer wg.Done()
+			errs <- m.Up(context.Background())
+		}(m)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent up failed: %v", err)
+		}
+	}
+	if n := appliedCount(t, migrators[0]); n != migrators[0].Latest() {
+		t.Errorf("expected %d applied migrations, got %d", migrators[0].Latest(), n)
+	}
+}
+
+func testNoMigrate(t *testing.T) {
+	url := pgtest.NewURL(t)
+	_, err := storage.OpenPostgresConfig(storage.PostgresConfig{ConnString: url, NoMigrate: true})
+	if !errors.Is(err, migrate.ErrDirty) {
+		t.Fatalf("expected ErrDirty for an unmigrated schema, got %v", err)
+	}
+
+	db, err := storage.OpenPostgres(url)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	db.Close()
+
+	db, err = storage.OpenPostgresConfig(storage.PostgresConfig{ConnString: url, NoMigrate: true})
+	if err != nil {
+		t.Fatalf("expected migrated schema to open: %v", err)
+	}
+	db.Close()
+}
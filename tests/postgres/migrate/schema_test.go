@@ -0,0 +1,15 @@
+package migrate
+
+import (
+	"OZON/pkg/storage"
+	"OZON/tests/postgres/pgtest"
+	"OZON/tests/schematest"
+	"testing"
+)
+
+// TestPostgresSchema проверяет ограничения, созданные миграциями
+func TestPostgresSchema(t *testing.T) {
+	schematest.Run(t, func(t *testing.T) *storage.DB {
+		return pgtest.NewDB(t)
+	})
+}
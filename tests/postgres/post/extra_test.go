@@ -5,7 +5,7 @@ package post
 import (
 	"OZON/internal/domain"
 	pg "OZON/internal/repository/postrges"
-	"OZON/pkg/storage"
+	"OZON/tests/postgres/pgtest"
 	"context"
 	"fmt"
 	"github.com/google/uuid"
@@ -15,10 +15,7 @@ import (
 
 // TestGetCommentsForPostPagination содержит тесты для пагинации комментариев
 func TestGetCommentsForPostPagination(t *testing.T) {
-	db, err := storage.NewPostgresDB()
-	if err != nil {
-		t.Fatalf("failed to connect to database: %v", err)
-	}
+	db := pgtest.NewDB(t)
 	repo := pg.NewPostgresRepository(*db)
 
 	if err := db.Exec("TRUNCATE TABLE posts, comments RESTART IDENTITY CASCADE").Error; err != nil {
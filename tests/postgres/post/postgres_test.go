@@ -3,7 +3,7 @@ package post
 import (
 	"OZON/internal/domain"
 	pg "OZON/internal/repository/postrges"
-	"OZON/pkg/storage"
+	"OZON/tests/postgres/pgtest"
 	"context"
 	_ "database/sql"
 	"fmt"
@@ -15,11 +15,7 @@ import (
 )
 
 func TestPostgresRepository(t *testing.T) {
-	db, err := storage.NewPostgresDB()
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+	db := pgtest.NewDB(t)
 	PostgresRepo := pg.NewPostgresRepository(*db)
 
 	if err := db.Exec("TRUNCATE TABLE posts, comments RESTART IDENTITY CASCADE").Error; err != nil {
@@ -189,8 +185,7 @@ func testIsCommentsAllowed(repo *pg.PostgresRepository) func(*testing.T) {
 		if err != nil {
 			t.Fatalf("failed to check comments allowed: %v", err)
 		}
-		if !notAllowed {
-
+		if notAllowed {
 			t.Errorf("expected comments to be not allowed, got true")
 		}
 	}
@@ -0,0 +1,10 @@
+package ratelimit
+
+import (
+	"OZON/tests/postgres/pgtest"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
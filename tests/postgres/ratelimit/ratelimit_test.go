@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"OZON/pkg/ratelimit"
+	"OZON/tests/postgres/pgtest"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// TestPostgresStore проверяет корзины токенов в таблице rate_limits
+func TestPostgresStore(t *testing.T) {
+	t.Run("Burst", testBurst)
+	t.Run("SharedByReplicas", testSharedByReplicas)
+	t.Run("Refill", testRefill)
+}
+
+func pool(t *testing.T) *sql.DB {
+	t.Helper()
+	sqlDB, err := pgtest.NewDB(t).DB.DB()
+	if err != nil {
+		t.Fatalf("failed to get connection pool: %v", err)
+	}
+	return sqlDB
+}
+
+func take(t *testing.T, s ratelimit.Store, key string, limit ratelimit.Limit) (bool, time.Duration) {
+	t.Helper()
+	ok, wait, err := s.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("failed to take a token: %v", err)
+	}
+	return ok, wait
+}
+
+// testBurst проверяет Count вызовов подряд, отказ и время ожидания
+func testBurst(t *testing.T) {
+	s := ratelimit.NewPostgres(pool(t))
+	limit := ratelimit.Limit{Count: 3, Period: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := take(t, s, "k", limit); !ok {
+			t.Fatalf("call %d must be allowed", i+1)
+		}
+	}
+	ok, wait := take(t, s, "k", limit)
+	if ok {
+		t.Fatal("the fourth call must be rejected")
+	}
+	if wait <= 15*time.Second || wait > 20*time.Second {
+		t.Errorf("expected to wait for about one token (20s), got %s", wait)
+	}
+	if ok, _ := take(t, s, "other", limit); !ok {
+		t.Error("buckets must be separate per key")
+	}
+}
+
+// testSharedByReplicas проверяет, что два хранилища на одной базе делят бюджет
+func testSharedByReplicas(t *testing.T) {
+	db := pool(t)
+	a, b := ratelimit.NewPostgres(db), ratelimit.NewPostgres(db)
+	limit := ratelimit.Limit{Count: 2, Period: time.Minute}
+
+	take(t, a, "k", limit)
+	take(t, b, "k", limit)
+	if ok, _ := take(t, a, "k", limit); ok {
+		t.Error("the budget must be shared between replicas")
+	}
+}
+
+// testRefill проверяет возврат токена по истечении интервала
+func testRefill(t *testing.T) {
+	s := ratelimit.NewPostgres(pool(t))
+	limit := ratelimit.Limit{Count: 10, Period: time.Second}
+
+	for i := 0; i < 10; i++ {
+		take(t, s, "k", limit)
+	}
+	if ok, _ := take(t, s, "k", limit); ok {
+		t.Fatal("the bucket must be empty")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if ok, _ := take(t, s, "k", limit); !ok {
+		t.Error("a token must be back after the refill interval")
+	}
+}
@@ -0,0 +1,168 @@
+package pubsub
+
+import (
+	"OZON/pkg/pubsub"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBroker проверяет доставку сообщений подписчикам и завершение подписок
+func TestBroker(t *testing.T) {
+	t.Run("DeliversToTopic", testDeliversToTopic)
+	t.Run("ContextCancel", testContextCancel)
+	t.Run("SlowSubscriberDropped", testSlowSubscriberDropped)
+	t.Run("Close", testClose)
+	t.Run("Wait", testWait)
+	t.Run("Stats", testStats)
+}
+
+// testDeliversToTopic проверяет, что сообщение получают только подписчики его темы
+func testDeliversToTopic(t *testing.T) {
+	b := pubsub.New[int]()
+	first := mustSubscribe(t, b, context.Background(), "a")
+	second := mustSubscribe(t, b, context.Background(), "a")
+	other := mustSubscribe(t, b, context.Background(), "b")
+
+	b.Publish("a", 1)
+	for _, ch := range []<-chan int{first, second} {
+		if got := receive(t, ch); got != 1 {
+			t.Errorf("expected 1, got %d", got)
+		}
+	}
+	select {
+	case v := <-other:
+		t.Errorf("unexpected message %d on another topic", v)
+	default:
+	}
+}
+
+// testContextCancel проверяет, что отмена контекста закрывает канал подписки
+func testContextCancel(t *testing.T) {
+	b := pubsub.New[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := mustSubscribe(t, b, ctx, "a")
+
+	cancel()
+	waitClosed(t, ch)
+	// Публикация после отписки не должна паниковать на закрытом канале.
+	b.Publish("a", 1)
+}
+
+// testSlowSubscriberDropped проверяет, что отстающий подписчик не блокирует публикацию
+func testSlowSubscriberDropped(t *testing.T) {
+	b := pubsub.New[int]()
+	slow := mustSubscribe(t, b, context.Background(), "a")
+
+	for i := 0; i < 100; i++ {
+		b.Publish("a", i)
+	}
+	for i := 0; ; i++ {
+		if _, ok := <-slow; !ok {
+			break
+		}
+		if i > 100 {
+			t.Fatal("slow subscriber was not dropped")
+		}
+	}
+}
+
+// testClose проверяет завершение всех подписок при закрытии брокера
+func testClose(t *testing.T) {
+	b := pubsub.New[int]()
+	first := mustSubscribe(t, b, context.Background(), "a")
+	second := mustSubscribe(t, b, context.Background(), "b")
+
+	if n := b.Close(); n != 2 {
+		t.Errorf("expected 2 ended subscriptions, got %d", n)
+	}
+	waitClosed(t, first)
+	waitClosed(t, second)
+
+	if _, err := b.Subscribe(context.Background(), "a"); !errors.Is(err, pubsub.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	b.Publish("a", 1)
+}
+
+// testWait проверяет ожидание завершения подписчиков после закрытия брокера
+func testWait(t *testing.T) {
+	b := pubsub.New[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := mustSubscribe(t, b, ctx, "a")
+	b.Close()
+
+	short, stop := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer stop()
+	if err := b.Wait(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Wait to time out while the subscriber is active, got %v", err)
+	}
+
+	// Подписчик увидел закрытый канал и завершился.
+	waitClosed(t, ch)
+	cancel()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// testStats проверяет счётчики подписчиков, очереди и отключённых подписчиков
+func testStats(t *testing.T) {
+	b := pubsub.New[int]()
+	mustSubscribe(t, b, context.Background(), "a")
+	mustSubscribe(t, b, context.Background(), "b")
+	b.Publish("a", 1)
+	b.Publish("a", 2)
+
+	got := b.Stats()
+	want := pubsub.Stats{Subscribers: 2, Topics: 2, Queued: 2, MaxQueued: 2}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	for i := 0; i < 100; i++ {
+		b.Publish("b", i)
+	}
+	if got := b.Stats(); got.Subscribers != 1 || got.Dropped != 1 {
+		t.Errorf("expected the slow subscriber to be dropped, got %+v", got)
+	}
+}
+
+func mustSubscribe(t *testing.T, b *pubsub.Broker[int], ctx context.Context, topic string) <-chan int {
+	t.Helper()
+	ch, err := b.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	return ch
+}
+
+func receive(t *testing.T, ch <-chan int) int {
+	t.Helper()
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed unexpectedly")
+		}
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return 0
+	}
+}
+
+func waitClosed(t *testing.T, ch <-chan int) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel was not closed")
+		}
+	}
+}
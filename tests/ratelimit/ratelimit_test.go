@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"OZON/pkg/ratelimit"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimit проверяет разбор лимитов, корзины токенов в памяти и определение клиента
+func TestRateLimit(t *testing.T) {
+	t.Run("ParseLimit", testParseLimit)
+	t.Run("Burst", testBurst)
+	t.Run("Refill", testRefill)
+	t.Run("Keys", testKeys)
+	t.Run("Sweep", testSweep)
+	t.Run("Subject", testSubject)
+}
+
+// clock — управляемые часы для хранилища в памяти
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newMemory() (*ratelimit.Memory, *clock) {
+	c := &clock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	return ratelimit.NewMemoryWithClock(c.Now), c
+}
+
+func take(t *testing.T, s ratelimit.Store, key string, limit ratelimit.Limit) (bool, time.Duration) {
+	t.Helper()
+	ok, wait, err := s.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("failed to take a token: %v", err)
+	}
+	return ok, wait
+}
+
+func testParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ratelimit.Limit
+		out  string
+	}{
+		{"5/1m", ratelimit.Limit{Count: 5, Period: time.Minute}, "5/1m"},
+		{"30/m", ratelimit.Limit{Count: 30, Period: time.Minute}, "30/1m"},
+		{"100/1h", ratelimit.Limit{Count: 100, Period: time.Hour}, "100/1h"},
+		{"2/90s", ratelimit.Limit{Count: 2, Period: 90 * time.Second}, "2/1m30s"},
+		{"0", ratelimit.Limit{}, "0"},
+		{"", ratelimit.Limit{}, "0"},
+	}
+	for _, tt := range tests {
+		got, err := ratelimit.ParseLimit(tt.in)
+		if err != nil {
+			t.Errorf("ParseLimit(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want || got.String() != tt.out {
+			t.Errorf("ParseLimit(%q) = %+v (%s), want %+v (%s)", tt.in, got, got, tt.want, tt.out)
+		}
+	}
+	for _, in := range []string{"5", "five/1m", "-1/1m", "5/0s", "5/soon"} {
+		if _, err := ratelimit.ParseLimit(in); err == nil {
+			t.Errorf("ParseLimit(%q): expected an error", in)
+		}
+	}
+}
+
+// testBurst проверяет, что корзина пропускает Count вызовов подряд и сообщает время ожидания
+func testBurst(t *testing.T) {
+	s, _ := newMemory()
+	limit := ratelimit.Limit{Count: 3, Period: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := take(t, s, "k", limit); !ok {
+			t.Fatalf("call %d must be allowed", i+1)
+		}
+	}
+	ok, wait := take(t, s, "k", limit)
+	if ok {
+		t.Fatal("the fourth call must be rejected")
+	}
+	if wait != 20*time.Second {
+		t.Errorf("expected to wait for one token (20s), got %s", wait)
+	}
+}
+
+// testRefill проверяет постепенное восстановление токенов
+func testRefill(t *testing.T) {
+	s, c := newMemory()
+	limit := ratelimit.Limit{Count: 2, Period: time.Minute}
+	take(t, s, "k", limit)
+	take(t, s, "k", limit)
+
+	c.Advance(20 * time.Second)
+	ok, wait := take(t, s, "k", limit)
+	if ok || wait != 10*time.Second {
+		t.Errorf("expected to wait 10s more, got ok=%v wait=%s", ok, wait)
+	}
+	c.Advance(10 * time.Second)
+	if ok, _ := take(t, s, "k", limit); !ok {
+		t.Error("a token must be back after 30s")
+	}
+	if ok, _ := take(t, s, "k", limit); ok {
+		t.Error("only one token must be back after 30s")
+	}
+
+	// Простой дольше периода не накапливает токенов сверх Count
+	c.Advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		if ok, _ := take(t, s, "k", limit); !ok {
+			t.Fatalf("call %d after a pause must be allowed", i+1)
+		}
+	}
+	if ok, _ := take(t, s, "k", limit); ok {
+		t.Error("the bucket must not hold more than Count tokens")
+	}
+}
+
+func testKeys(t *testing.T) {
+	s, _ := newMemory()
+	limit := ratelimit.Limit{Count: 1, Period: time.Minute}
+	take(t, s, "a", limit)
+	if ok, _ := take(t, s, "b", limit); !ok {
+		t.Error("buckets must be separate per key")
+	}
+	if ok, _ := take(t, s, "a", ratelimit.Limit{}); !ok {
+		t.Error("a zero limit must allow every call")
+	}
+}
+
+// testSweep проверяет удаление заполнившихся корзин
+func testSweep(t *testing.T) {
+	s, c := newMemory()
+	limit := ratelimit.Limit{Count: 1, Period: time.Minute}
+	take(t, s, "a", limit)
+	take(t, s, "b", limit)
+	if s.Len() != 2 {
+		t.Fatalf("expected 2 buckets, got %d", s.Len())
+	}
+	c.Advance(2 * time.Minute)
+	take(t, s, "c", limit)
+	if s.Len() != 1 {
+		t.Errorf("full buckets must be dropped, %d left", s.Len())
+	}
+}
+
+// testSubject проверяет ключ клиента: пользователь, адрес, прокси и сети IPv6
+func testSubject(t *testing.T) {
+	serve := func(trustProxy bool, req *http.Request) string {
+		var got string
+		h := ratelimit.ClientMiddleware(trustProxy, "X-User-Id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = ratelimit.Subject(r.Context())
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		return got
+	}
+	subject := func(trustProxy bool, remoteAddr string, forwarded ...string) string {
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.RemoteAddr = remoteAddr
+		for _, f := range forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		return serve(trustProxy, req)
+	}
+	user := func(trustProxy bool, id string) string {
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.RemoteAddr = "10.0.0.2:51000"
+		req.Header.Set("X-User-Id", id)
+		return serve(trustProxy, req)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"Peer", subject(false, "203.0.113.7:51000"), "ip:203.0.113.7"},
+		{"UntrustedForwarded", subject(false, "10.0.0.2:51000", "198.51.100.1"), "ip:10.0.0.2"},
+		{"TrustedForwarded", subject(true, "10.0.0.2:51000", "198.51.100.1, 203.0.113.7"), "ip:203.0.113.7"},
+		{"LastHeader", subject(true, "10.0.0.2:51000", "198.51.100.1", "203.0.113.9"), "ip:203.0.113.9"},
+		{"NoForwarded", subject(true, "10.0.0.2:51000"), "ip:10.0.0.2"},
+		{"IPv6Network", subject(false, "[2001:db8:1:2:aaaa::1]:51000"), "ip:2001:db8:1:2::/64"},
+		{"Unknown", ratelimit.Subject(context.Background()), "unknown"},
+		{"User", user(true, "42"), "user:42"},
+		{"UntrustedUser", user(false, "42"), "ip:10.0.0.2"},
+		{"EmptyUser", user(true, " "), "ip:10.0.0.2"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package schematest checks the constraints that the SQL backends enforce on
+// their own, bypassing the repositories that normally validate input first.
+package schematest
+
+import (
+	"OZON/internal/domain"
+	postgres "OZON/internal/repository/postrges"
+	"OZON/pkg/storage"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Run executes the checks against fresh databases returned by open.
+func Run(t *testing.T, open func(t *testing.T) *storage.DB) {
+	t.Run("CommentRequiresPost", func(t *testing.T) { testCommentRequiresPost(t, open(t)) })
+	t.Run("ParentMustExist", func(t *testing.T) { testParentMustExist(t, open(t)) })
+	t.Run("CrossPostParent", func(t *testing.T) { testCrossPostParent(t, open(t)) })
+	t.Run("ParentWithRepliesCannotBeDeleted", func(t *testing.T) { testParentWithReplies(t, open(t)) })
+	t.Run("PostDeleteCascades", func(t *testing.T) { testPostDeleteCascades(t, open(t)) })
+	t.Run("RebuildCounters", func(t *testing.T) { testRebuildCounters(t, open(t)) })
+}
+
+func createPost(t *testing.T, db *storage.DB) *domain.Post {
+	t.Helper()
+	now := time.Now().UTC()
+	post := &domain.Post{ID: uuid.New(), Text: "post", AllowComments: true, CreatedAt: &now, UpdatedAt: &now}
+	if err := db.Create(post).Error; err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	return post
+}
+
+func newComment(postID uuid.UUID, parentID *uuid.UUID) *domain.Comment {
+	now := time.Now().UTC()
+	return &domain.Comment{ID: uuid.New(), Text: "comment", PostID: postID, ParentID: parentID, CreatedAt: &now}
+}
+
+func createComment(t *testing.T, db *storage.DB, postID uuid.UUID, parentID *uuid.UUID) *domain.Comment {
+	t.Helper()
+	c := newComment(postID, parentID)
+	if err := db.Create(c).Error; err != nil {
+		t.Fatalf("failed to create comment: %v", err)
+	}
+	return c
+}
+
+func testCommentRequiresPost(t *testing.T, db *storage.DB) {
+	if err := db.Create(newComment(uuid.New(), nil)).Error; err == nil {
+		t.Errorf("expected foreign key violation for a comment on a missing post")
+	}
+}
+
+func testParentMustExist(t *testing.T, db *storage.DB) {
+	post := createPost(t, db)
+	missing := uuid.New()
+	if err := db.Create(newComment(post.ID, &missing)).Error; err == nil {
+		t.Errorf("expected foreign key violation for a missing parent")
+	}
+}
+
+func testCrossPostParent(t *testing.T, db *storage.DB) {
+	first := createPost(t, db)
+	second := createPost(t, db)
+	parent := createComment(t, db, first.ID, nil)
+
+	if err := db.Create(newComment(second.ID, &parent.ID)).Error; err == nil {
+		t.Errorf("expected the database to reject a parent from another post")
+	}
+	createComment(t, db, first.ID, &parent.ID)
+}
+
+func testParentWithReplies(t *testing.T, db *storage.DB) {
+	post := createPost(t, db)
+	parent := createComment(t, db, post.ID, nil)
+	createComment(t, db, post.ID, &parent.ID)
+
+	if err := db.Delete(&domain.Comment{}, "id = ?", parent.ID).Error; err == nil {
+		t.Errorf("expected hard delete of a comment with replies to fail")
+	}
+}
+
+func testPostDeleteCascades(t *testing.T, db *storage.DB) {
+	post := createPost(t, db)
+	root := createComment(t, db, post.ID, nil)
+	reply := createComment(t, db, post.ID, &root.ID)
+	createComment(t, db, post.ID, &reply.ID)
+	other := createPost(t, db)
+	createComment(t, db, other.ID, nil)
+
+	if err := db.Delete(&domain.Post{}, "id = ?", post.ID).Error; err != nil {
+		t.Fatalf("failed to delete post: %v", err)
+	}
+	var left int64
+	if err := db.Model(&domain.Comment{}).Where("post_id = ?", post.ID).Count(&left).Error; err != nil {
+		t.Fatalf("failed to count comments: %v", err)
+	}
+	if left != 0 {
+		t.Errorf("expected comments of the deleted post to be removed, %d left", left)
+	}
+	var kept int64
+	if err := db.Model(&domain.Comment{}).Where("post_id = ?", other.ID).Count(&kept).Error; err != nil {
+		t.Fatalf("failed to count comments: %v", err)
+	}
+	if kept != 1 {
+		t.Errorf("comments of other posts must stay, got %d", kept)
+	}
+}
+
+// testRebuildCounters corrupts the counters behind the repository's back and
+// checks that RebuildCounters restores them, ignoring deleted comments.
+func testRebuildCounters(t *testing.T, db *storage.DB) {
+	post := createPost(t, db)
+	root := createComment(t, db, post.ID, nil)
+	createComment(t, db, post.ID, &root.ID)
+	gone := newComment(post.ID, &root.ID)
+	deletedAt := time.Now().UTC()
+	gone.DeletedAt = &deletedAt
+	if err := db.Create(gone).Error; err != nil {
+		t.Fatalf("failed to create deleted comment: %v", err)
+	}
+	if err := db.Model(&domain.Post{}).Where("id = ?", post.ID).Update("comment_count", 42).Error; err != nil {
+		t.Fatalf("failed to corrupt comment_count: %v", err)
+	}
+
+	repaired, err := postgres.NewPostgresRepository(*db).RebuildCounters(context.Background())
+	if err != nil {
+		t.Fatalf("failed to rebuild counters: %v", err)
+	}
+	// The post was corrupted and the root's reply_count was never set.
+	if repaired != 2 {
+		t.Errorf("expected 2 repaired counters, got %d", repaired)
+	}
+
+	var gotPost domain.Post
+	if err := db.First(&gotPost, "id = ?", post.ID).Error; err != nil {
+		t.Fatalf("failed to get post: %v", err)
+	}
+	if gotPost.CommentCount != 2 {
+		t.Errorf("expected comment_count 2, got %d", gotPost.CommentCount)
+	}
+	if !gotPost.UpdatedAt.After(*post.UpdatedAt) {
+		t.Errorf("repairing comment_count must move updated_at forward")
+	}
+	var gotRoot domain.Comment
+	if err := db.First(&gotRoot, "id = ?", root.ID).Error; err != nil {
+		t.Fatalf("failed to get comment: %v", err)
+	}
+	if gotRoot.ReplyCount != 1 {
+		t.Errorf("expected reply_count 1, got %d", gotRoot.ReplyCount)
+	}
+}
@@ -0,0 +1,27 @@
+package contract
+
+import (
+	"OZON/internal/repository"
+	"OZON/internal/repository/repotest"
+	"OZON/internal/repository/sqlite"
+	"OZON/pkg/storage"
+	"path/filepath"
+	"testing"
+)
+
+// TestSQLiteContract прогоняет общий набор тестов хранилища для SQLite
+func TestSQLiteContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) (repository.PostRepository, repository.CommentRepository) {
+		db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "ozon.db"))
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() {
+			if sqlDB, err := db.DB.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		repo := sqlite.NewSQLiteRepository(*db)
+		return repo, repo
+	})
+}
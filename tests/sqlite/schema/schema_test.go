@@ -0,0 +1,20 @@
+package schema
+
+import (
+	"OZON/pkg/storage"
+	"OZON/tests/schematest"
+	"path/filepath"
+	"testing"
+)
+
+// TestSQLiteSchema проверяет ограничения схемы SQLite
+func TestSQLiteSchema(t *testing.T) {
+	schematest.Run(t, func(t *testing.T) *storage.DB {
+		db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "ozon.db"))
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
@@ -0,0 +1,217 @@
+package tracing
+
+import (
+	"OZON/graph"
+	"OZON/internal/domain"
+	"OZON/internal/handlers"
+	"OZON/internal/repository/backend"
+	"OZON/internal/usecases"
+	"OZON/pkg/pubsub"
+	"OZON/pkg/tracing"
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "OZON/internal/repository/sqlite"
+)
+
+const (
+	traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentSpanID = "00f067aa0ba902b7"
+)
+
+// TestTracing проверяет трассировку от HTTP-запроса до SQL и экспорт в файл
+func TestTracing(t *testing.T) {
+	t.Run("Request", testRequest)
+	t.Run("ClientError", testClientError)
+	t.Run("FileExporter", testFileExporter)
+}
+
+// record подменяет глобального провайдера на запись спанов в память
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return rec
+}
+
+// newServer собирает GraphQL-сервер на SQLite так же, как cmd/serve.go
+func newServer(t *testing.T) (http.Handler, *usecases.PostUsecase) {
+	t.Helper()
+	s, err := backend.Open("sqlite", backend.Settings{SQLitePath: filepath.Join(t.TempDir(), "ozon.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	postUsecase := usecases.NewPostUsecase(s.PostRepository, s.CommentRepository)
+	resolver := handlers.NewResolver(
+		postUsecase,
+		usecases.NewCommentUsecase(s.PostRepository, s.CommentRepository, 0),
+		pubsub.New[*domain.Comment](),
+	)
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(handlers.NewErrorPresenter(false))
+	srv.Use(handlers.Tracer{})
+	return otelhttp.NewHandler(srv, "/query"), postUsecase
+}
+
+func post(h http.Handler, body string) {
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// spansByName возвращает завершённые спаны трассы из заголовка traceparent
+func spansByName(t *testing.T, rec *tracetest.SpanRecorder) map[string][]sdktrace.ReadOnlySpan {
+	t.Helper()
+	out := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		if s.SpanContext().TraceID().String() == traceID {
+			out[s.Name()] = append(out[s.Name()], s)
+		}
+	}
+	return out
+}
+
+func single(t *testing.T, spans map[string][]sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	if len(spans[name]) != 1 {
+		names := make([]string, 0, len(spans))
+		for n := range spans {
+			names = append(names, n)
+		}
+		t.Fatalf("expected one span %q, got %d among %v", name, len(spans[name]), names)
+	}
+	return spans[name][0]
+}
+
+func expectParent(t *testing.T, child, parent sdktrace.ReadOnlySpan) {
+	t.Helper()
+	if child.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("span %q must be a child of %q", child.Name(), parent.Name())
+	}
+}
+
+// testRequest проверяет цепочку спанов HTTP → операция → резолвер → usecase → SQL
+func testRequest(t *testing.T) {
+	h, postUsecase := newServer(t)
+	if _, err := postUsecase.CreatePost(context.Background(), "secret text", nil); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	rec := record(t)
+
+	post(h, `{"query":"query Feed { getPosts(page: 1, limit: 10) { id text } }"}`)
+
+	spans := spansByName(t, rec)
+	httpSpan := single(t, spans, "/query")
+	if httpSpan.Parent().SpanID().String() != parentSpanID || !httpSpan.Parent().IsRemote() {
+		t.Errorf("HTTP span must continue the incoming trace context, parent %v", httpSpan.Parent())
+	}
+	operation := single(t, spans, "query Feed")
+	expectParent(t, operation, httpSpan)
+	resolver := single(t, spans, "Query.getPosts")
+	expectParent(t, resolver, operation)
+	usecase := single(t, spans, "PostUsecase.GetPosts")
+	expectParent(t, usecase, resolver)
+
+	// Кроме выборки постов, usecase проверяет существование поста перед загрузкой комментариев
+	var statements []string
+	for _, sql := range spans["gorm.query posts"] {
+		expectParent(t, sql, usecase)
+		for _, a := range sql.Attributes() {
+			if a.Key == "db.statement" {
+				statements = append(statements, a.Value.AsString())
+			}
+		}
+	}
+	if len(statements) != 2 || !strings.Contains(statements[0], "ORDER BY created_at") {
+		t.Errorf("unexpected db.statement values %q", statements)
+	}
+	for _, statement := range statements {
+		if strings.Contains(statement, "secret text") {
+			t.Errorf("db.statement must not contain arguments: %q", statement)
+		}
+	}
+	if len(spans["gorm.query comments"]) != 1 {
+		t.Errorf("expected the comments query of the post to be traced")
+	}
+	// Поля без резолвера не создают спанов
+	if len(spans["Post.text"]) != 0 {
+		t.Errorf("struct fields should not be traced")
+	}
+}
+
+// testClientError проверяет, что ошибки клиента записываются, но не помечают спаны как сбойные
+func testClientError(t *testing.T) {
+	h, _ := newServer(t)
+	rec := record(t)
+
+	post(h, `{"query":"query { getPost(id: \"`+uuid.NewString()+`\") { id } }"}`)
+
+	spans := spansByName(t, rec)
+	for _, name := range []string{"query", "Query.getPost", "PostUsecase.GetPost", "gorm.query posts"} {
+		s := single(t, spans, name)
+		if s.Status().Code == codes.Error {
+			t.Errorf("span %q must not fail on a missing post", name)
+		}
+	}
+	if events := single(t, spans, "Query.getPost").Events(); len(events) == 0 || events[0].Name != "exception" {
+		t.Errorf("the resolver span must record the error, got %v", events)
+	}
+}
+
+// testFileExporter проверяет запись спанов в файл в формате JSON lines
+func testFileExporter(t *testing.T) {
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: "file", File: path, SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("failed to set up tracing: %v", err)
+	}
+	for _, name := range []string{"first", "second"} {
+		_, span := tracing.Start(context.Background(), name)
+		span.End()
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shut down tracing: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read traces: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"Name":"first"`) || !strings.Contains(lines[1], `"Name":"second"`) {
+		t.Errorf("unexpected trace file:\n%s", data)
+	}
+	if !strings.Contains(lines[0], `"Value":"ozon"`) {
+		t.Errorf("spans must carry the service name:\n%s", lines[0])
+	}
+}
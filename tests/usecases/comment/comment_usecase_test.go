@@ -0,0 +1,122 @@
+package comment
+
+import (
+	"OZON/internal/domain"
+	"OZON/internal/repository/memory"
+	"OZON/internal/usecases"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"testing"
+)
+
+// TestCreateCommentParentValidation проверяет валидацию родительского комментария
+func TestCreateCommentParentValidation(t *testing.T) {
+	t.Run("ParentNotFound", testParentNotFound)
+	t.Run("ParentFromAnotherPost", testParentFromAnotherPost)
+	t.Run("ParentDeleted", testParentDeleted)
+	t.Run("MaxDepth", testMaxDepth)
+	t.Run("CommentsNotAllowed", testCommentsNotAllowed)
+}
+
+func newPost(t *testing.T, repo *memory.InMemoryRepository, allow bool) *domain.Post {
+	post, err := repo.CreatePost(context.Background(), &domain.Post{Text: "Test Post"}, &allow)
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	return post
+}
+
+// testParentNotFound проверяет ответ на несуществующий комментарий
+func testParentNotFound(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	uc := usecases.NewCommentUsecase(repo, repo, 0)
+	post := newPost(t, repo, true)
+
+	parentID := uuid.New()
+	_, err := uc.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, Text: "Reply", ParentID: &parentID})
+	if !errors.Is(err, domain.ErrParentNotFound) {
+		t.Errorf("expected ErrParentNotFound, got %v", err)
+	}
+}
+
+// testParentFromAnotherPost проверяет, что родитель должен принадлежать тому же посту
+func testParentFromAnotherPost(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	uc := usecases.NewCommentUsecase(repo, repo, 0)
+	first := newPost(t, repo, true)
+	second := newPost(t, repo, true)
+
+	parent, err := uc.CreateComment(context.Background(), &domain.Comment{PostID: first.ID, Text: "Root"})
+	if err != nil {
+		t.Fatalf("failed to create root comment: %v", err)
+	}
+
+	_, err = uc.CreateComment(context.Background(), &domain.Comment{PostID: second.ID, Text: "Reply", ParentID: &parent.ID})
+	if !errors.Is(err, domain.ErrParentPostMismatch) {
+		t.Errorf("expected ErrParentPostMismatch, got %v", err)
+	}
+
+	_, err = repo.CreateComment(context.Background(), &domain.Comment{PostID: second.ID, Text: "Reply", ParentID: &parent.ID})
+	if !errors.Is(err, domain.ErrParentPostMismatch) {
+		t.Errorf("expected ErrParentPostMismatch from repository, got %v", err)
+	}
+}
+
+// testParentDeleted проверяет, что нельзя ответить на удалённый комментарий
+func testParentDeleted(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	uc := usecases.NewCommentUsecase(repo, repo, 0)
+	post := newPost(t, repo, true)
+
+	parent, err := uc.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, Text: "Root"})
+	if err != nil {
+		t.Fatalf("failed to create root comment: %v", err)
+	}
+	if err := uc.DeleteComment(context.Background(), parent.ID.String()); err != nil {
+		t.Fatalf("failed to delete root comment: %v", err)
+	}
+
+	_, err = uc.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, Text: "Reply", ParentID: &parent.ID})
+	if !errors.Is(err, domain.ErrParentDeleted) {
+		t.Errorf("expected ErrParentDeleted, got %v", err)
+	}
+}
+
+// testMaxDepth проверяет ограничение глубины вложенности
+func testMaxDepth(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	uc := usecases.NewCommentUsecase(repo, repo, 3)
+	post := newPost(t, repo, true)
+
+	var parentID *uuid.UUID
+	for depth := 1; depth <= 3; depth++ {
+		c, err := uc.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, Text: "Comment", ParentID: parentID})
+		if err != nil {
+			t.Fatalf("failed to create comment at depth %d: %v", depth, err)
+		}
+		parentID = &c.ID
+	}
+
+	_, err := uc.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, Text: "Too deep", ParentID: parentID})
+	if !errors.Is(err, domain.ErrMaxDepthExceeded) {
+		t.Errorf("expected ErrMaxDepthExceeded, got %v", err)
+	}
+}
+
+// testCommentsNotAllowed проверяет запрет комментариев для поста
+func testCommentsNotAllowed(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	uc := usecases.NewCommentUsecase(repo, repo, 0)
+	post := newPost(t, repo, false)
+
+	_, err := uc.CreateComment(context.Background(), &domain.Comment{PostID: post.ID, Text: "Comment"})
+	if !errors.Is(err, domain.ErrCommentsDisabled) {
+		t.Errorf("expected ErrCommentsDisabled, got %v", err)
+	}
+
+	_, err = uc.CreateComment(context.Background(), &domain.Comment{PostID: uuid.New(), Text: "Comment"})
+	if !errors.Is(err, domain.ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+	}
+}